@@ -5,6 +5,7 @@ import (
 	"github.com/devlibx/gox-base/v2"
 	"github.com/devlibx/gox-base/v2/errors"
 	"github.com/devlibx/gox-http/v4/command"
+	httpCommand "github.com/devlibx/gox-http/v4/command/http"
 	"github.com/go-resty/resty/v2"
 	"sync"
 )
@@ -17,6 +18,38 @@ var ErrCommandNotRegisteredForApi = errors.New("api not found")
 type GoxHttpContext interface {
 	ReloadApi(apiToReload string) error
 	Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)
+
+	// ExecuteAsync executes the request in background and delivers the response (or error in GoxResponse.Err) on the
+	// returned channel. The channel always gets exactly one response and never blocks the sender, so it is safe to
+	// stop listening e.g. when ctx is cancelled. APIs marked with "async: true" run on a bounded worker pool.
+	ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse
+
+	// ExecuteStream executes the request and gives the response body as a stream, which is read from the server while
+	// the caller reads it (e.g. a large download). Timeout, retries and circuit breaker of the api apply until the
+	// response headers are received; after that the body can be read until ctx is done. Caller must close the body.
+	ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error)
+
+	// OnCircuitStateChange registers a listener which is called when the circuit breaker of any api changes its state
+	// (open, half-open or closed). Listener is called in the goroutine of the request which caused the change, so it
+	// should not block. A circuit breaker shared by all APIs of a server sends one event with empty api name. Hystrix
+	// circuits report only open and closed.
+	OnCircuitStateChange(listener httpCommand.CircuitListener)
+
+	// CircuitState gives the current state of the circuit breaker of an api. An api without circuit breaker (hystrix
+	// disabled) is always closed.
+	CircuitState(api string) (httpCommand.CircuitState, error)
+
+	// RegisterFallback sets the func which gives the response when a request of the api fails due to open circuit,
+	// timeout or 5xx (see fallback in api config for the failures which use it). It is kept when the api is reloaded.
+	RegisterFallback(api string, fallback command.FallbackFunc)
+
+	// Health gives the health of all servers and their endpoints (as seen by health check and outlier detection), it
+	// can be used by readiness probes
+	Health() *httpCommand.HealthReport
+
+	// Close stops the background work of this context (health checks, service discovery refresh and async workers).
+	// Requests already running are not cancelled.
+	Close()
 }
 
 // RestyClientProvider - Interface to get resty client
@@ -24,14 +57,23 @@ type RestyClientProvider interface {
 	GetRestyClient(api string) (*resty.Client, bool)
 }
 
+// ResponseCodecProvider - Interface to get the codec of response_codec of an api
+type ResponseCodecProvider interface {
+	ResponseCodec(api string) (command.Codec, bool)
+}
+
 // NewGoxHttpContext - Create a new http context to be used
 func NewGoxHttpContext(cf gox.CrossFunction, config *command.Config) (GoxHttpContext, error) {
 	c := &goxHttpContextImpl{
-		CrossFunction: cf,
-		logger:        cf.Logger().Named("gox-http"),
-		config:        config,
-		commands:      map[string]command.Command{},
-		lock:          &sync.Mutex{},
+		CrossFunction:  cf,
+		logger:         cf.Logger().Named("gox-http"),
+		config:         config,
+		commands:       map[string]command.Command{},
+		asyncPools:     map[string]*asyncWorkerPool{},
+		serverRuntimes: map[string]*httpCommand.ServerRuntime{},
+		fallbacks:      map[string]command.FallbackFunc{},
+		lock:           &sync.RWMutex{},
+		listenersLock:  &sync.RWMutex{},
 	}
 
 	if err := c.setup(); err != nil {
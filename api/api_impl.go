@@ -21,12 +21,25 @@ type goxHttpContextImpl struct {
 	config   *command.Config
 	commands map[string]command.Command
 	timeouts map[string]int
-	lock     *sync.Mutex
+	lock     *sync.RWMutex
+
+	// asyncPools has a worker pool for each api marked with "async: true"
+	asyncPools map[string]*asyncWorkerPool
+
+	// serverRuntimes has shared resources (connection pool) of each server, shared by all APIs of the server
+	serverRuntimes map[string]*httpCommand.ServerRuntime
+
+	// fallbacks are the fallback funcs registered for APIs, they are set again on the command when an api is reloaded
+	fallbacks map[string]command.FallbackFunc
+
+	// circuitListeners get state changes of circuit breakers of all APIs
+	circuitListeners []httpCommand.CircuitListener
+	listenersLock    *sync.RWMutex
 }
 
 func (g *goxHttpContextImpl) Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
 	api := request.Api
-	if cmd, ok := g.commands[api]; !ok {
+	if cmd, timeout, ok := g.command(api); !ok {
 		return nil, &command.GoxHttpError{
 			Err:        ErrCommandNotRegisteredForApi,
 			StatusCode: http.StatusBadRequest,
@@ -37,7 +50,6 @@ func (g *goxHttpContextImpl) Execute(ctx context.Context, request *command.GoxRe
 	} else {
 
 		// Setup context with timeout
-		timeout := g.timeouts[api]
 		newCtx, ctxCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
 		defer ctxCancel()
 
@@ -45,6 +57,154 @@ func (g *goxHttpContextImpl) Execute(ctx context.Context, request *command.GoxRe
 	}
 }
 
+func (g *goxHttpContextImpl) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
+	// Submit is done with the read lock, so a reload of the api does not close the pool while we submit to it
+	g.lock.RLock()
+	if pool, ok := g.asyncPools[request.Api]; ok {
+		defer g.lock.RUnlock()
+		return pool.submit(ctx, request)
+	}
+	g.lock.RUnlock()
+
+	responseChannel := make(chan *command.GoxResponse, 1)
+	go func() {
+		responseChannel <- command.NewGoxResponseFromResult(g.Execute(ctx, request))
+	}()
+	return responseChannel
+}
+
+func (g *goxHttpContextImpl) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	api := request.Api
+	cmd, _, ok := g.command(api)
+	if !ok {
+		return nil, &command.GoxHttpError{
+			Err:        ErrCommandNotRegisteredForApi,
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("command to execute not found: name=%s", api),
+			ErrorCode:  "command_not_found",
+		}
+	}
+	streamCommand, ok := cmd.(httpCommand.StreamCommand)
+	if !ok {
+		return nil, &command.GoxHttpError{
+			Err:        errors.New("stream is not supported by command of api=%s", api),
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("stream is not supported by command: name=%s", api),
+			ErrorCode:  "stream_not_supported",
+		}
+	}
+
+	// Timeout of the api is applied by the command until the response headers are received
+	return streamCommand.ExecuteStream(ctx, request)
+}
+
+func (g *goxHttpContextImpl) OnCircuitStateChange(listener httpCommand.CircuitListener) {
+	g.listenersLock.Lock()
+	defer g.listenersLock.Unlock()
+	g.circuitListeners = append(g.circuitListeners, listener)
+}
+
+func (g *goxHttpContextImpl) CircuitState(api string) (httpCommand.CircuitState, error) {
+	cmd, _, ok := g.command(api)
+	if !ok {
+		return "", errors.Wrap(ErrCommandNotRegisteredForApi, "failed to get circuit state: api=%s", api)
+	}
+	if provider, ok := cmd.(httpCommand.CircuitStateProvider); ok {
+		return provider.CircuitState(), nil
+	}
+	return httpCommand.CircuitClosed, nil
+}
+
+func (g *goxHttpContextImpl) RegisterFallback(api string, fallback command.FallbackFunc) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.fallbacks[api] = fallback
+	if cmd, ok := g.commands[api]; ok {
+		g.setupFallback(api, cmd)
+	}
+}
+
+func (g *goxHttpContextImpl) Health() *httpCommand.HealthReport {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	report := &httpCommand.HealthReport{Healthy: true, Servers: map[string]*httpCommand.ServerHealth{}}
+	for name, runtime := range g.serverRuntimes {
+		health := runtime.Health()
+		report.Servers[name] = health
+		report.Healthy = report.Healthy && health.Healthy
+	}
+	return report
+}
+
+func (g *goxHttpContextImpl) Close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, runtime := range g.serverRuntimes {
+		runtime.Close()
+	}
+	for _, pool := range g.asyncPools {
+		pool.close()
+	}
+}
+
+// command gives the command of the api and its timeout, they are changed when the api is reloaded
+func (g *goxHttpContextImpl) command(api string) (command.Command, int, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	cmd, ok := g.commands[api]
+	return cmd, g.timeouts[api], ok
+}
+
+// dispatchCircuitEvent sends a circuit state change to all registered listeners
+func (g *goxHttpContextImpl) dispatchCircuitEvent(event httpCommand.CircuitEvent) {
+	g.listenersLock.RLock()
+	listeners := g.circuitListeners
+	g.listenersLock.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// setupFallback sets the fallback func registered for the api (if any) on its command
+func (g *goxHttpContextImpl) setupFallback(api string, cmd command.Command) {
+	if fallback, ok := g.fallbacks[api]; ok {
+		if setter, ok := cmd.(httpCommand.FallbackSetter); ok {
+			setter.SetFallback(fallback)
+		}
+	}
+}
+
+// setupAsyncPool creates the worker pool for an api marked with "async: true". Existing pool of this api (if any) is
+// drained - new requests go to the new pool, and the old pool completes its queued requests before it stops. Must be
+// called with the lock held.
+func (g *goxHttpContextImpl) setupAsyncPool(api *command.Api) {
+	old, ok := g.asyncPools[api.Name]
+	delete(g.asyncPools, api.Name)
+	if api.Async {
+		g.asyncPools[api.Name] = newAsyncWorkerPool(api, g.Execute)
+	}
+	if ok {
+		old.close()
+	}
+}
+
+// serverRuntime gives the shared runtime (connection pool) of a server, it is created on first use
+func (g *goxHttpContextImpl) serverRuntime(server *command.Server) (*httpCommand.ServerRuntime, error) {
+	if runtime, ok := g.serverRuntimes[server.Name]; ok {
+		return runtime, nil
+	}
+	runtime, err := httpCommand.NewServerRuntime(g.CrossFunction, server)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create server runtime: server=%s", server.Name)
+	}
+	runtime.SetCircuitListener(g.dispatchCircuitEvent)
+	runtime.Start()
+	g.serverRuntimes[server.Name] = runtime
+	return runtime, nil
+}
+
 // Internal setup method
 func (g *goxHttpContextImpl) setup() error {
 	g.config.SetupDefaults()
@@ -60,13 +220,12 @@ func (g *goxHttpContextImpl) setup() error {
 			return errors.Wrap(err, "failed to create http command (server not found): api=%s", apiName)
 		}
 
-		// Create http command for this API
-		var cmd command.Command
-		if api.DisableHystrix {
-			cmd, err = httpCommand.NewHttpCommand(g.CrossFunction, server, api)
-		} else {
-			cmd, err = httpCommand.NewHttpHystrixCommand(g.CrossFunction, server, api)
+		// Create http command for this API (using the shared connection pool of the server)
+		runtime, err := g.serverRuntime(server)
+		if err != nil {
+			return err
 		}
+		cmd, err := httpCommand.NewCommandWithRuntime(g.CrossFunction, runtime, api)
 		if err != nil {
 			return errors.Wrap(err, "failed to create http command: api=%s", apiName)
 		}
@@ -75,6 +234,8 @@ func (g *goxHttpContextImpl) setup() error {
 		g.commands[apiName] = cmd
 		// g.timeouts[apiName] = api.Timeout
 		g.timeouts[apiName] = api.GetTimeoutWithRetryIncluded()
+		g.setupFallback(apiName, cmd)
+		g.setupAsyncPool(api)
 
 	}
 	return nil
@@ -93,6 +254,9 @@ func (g *goxHttpContextImpl) ReloadApi(apiToReload string) error {
 	var err error
 	for apiName, api := range g.config.Apis {
 		if apiName == apiToReload {
+			if err = g.reloadServerRuntime(api); err != nil {
+				return err
+			}
 			if _, ok := g.commands[apiName]; ok {
 				err = g.updateAPi(api)
 			} else {
@@ -103,6 +267,35 @@ func (g *goxHttpContextImpl) ReloadApi(apiToReload string) error {
 	return err
 }
 
+// reloadServerRuntime creates a new runtime for the server of the api, if the server config is changed since its
+// runtime was created. Other APIs of this server are moved to the new runtime, and the old runtime is closed. Must be
+// called with the lock held.
+func (g *goxHttpContextImpl) reloadServerRuntime(api *command.Api) error {
+	server, err := g.config.FindServerByName(api.Server)
+	if err != nil {
+		return errors.Wrap(err, "failed to create http command (server not found): api=%s", api.Name)
+	}
+	old, ok := g.serverRuntimes[server.Name]
+	if !ok || !old.IsChanged(server) {
+		return nil
+	}
+
+	delete(g.serverRuntimes, server.Name)
+	if _, err = g.serverRuntime(server); err != nil {
+		g.serverRuntimes[server.Name] = old
+		return err
+	}
+	for apiName, other := range g.config.Apis {
+		if _, ok := g.commands[apiName]; ok && apiName != api.Name && other.Server == server.Name {
+			if err = g.updateAPi(other); err != nil {
+				return err
+			}
+		}
+	}
+	old.Close()
+	return nil
+}
+
 func (g *goxHttpContextImpl) addNewAPi(api *command.Api) error {
 	apiName := api.Name
 
@@ -112,13 +305,12 @@ func (g *goxHttpContextImpl) addNewAPi(api *command.Api) error {
 		return errors.Wrap(err, "failed to create http command (server not found): api=%s", apiName)
 	}
 
-	// Create http command for this API
-	var cmd command.Command
-	if api.DisableHystrix {
-		cmd, err = httpCommand.NewHttpCommand(g.CrossFunction, server, api)
-	} else {
-		cmd, err = httpCommand.NewHttpHystrixCommand(g.CrossFunction, server, api)
+	// Create http command for this API (using the shared connection pool of the server)
+	runtime, err := g.serverRuntime(server)
+	if err != nil {
+		return err
 	}
+	cmd, err := httpCommand.NewCommandWithRuntime(g.CrossFunction, runtime, api)
 	if err != nil {
 		return errors.Wrap(err, "failed to create http command: api=%s", apiName)
 	}
@@ -126,6 +318,8 @@ func (g *goxHttpContextImpl) addNewAPi(api *command.Api) error {
 	// Store this http command to use
 	g.commands[apiName] = cmd
 	g.timeouts[apiName] = api.Timeout
+	g.setupFallback(apiName, cmd)
+	g.setupAsyncPool(api)
 
 	return nil
 }
@@ -139,12 +333,24 @@ func (g *goxHttpContextImpl) updateAPi(api *command.Api) error {
 		return errors.Wrap(err, "failed to create http command (server not found): api=%s", apiName)
 	}
 
+	runtime, err := g.serverRuntime(server)
+	if err != nil {
+		return err
+	}
+
 	var updatedCommand command.Command
 	if _, ok := g.commands[apiName].(*httpCommand.HttpCommand); ok {
-		updatedCommand, err = httpCommand.NewHttpCommand(g.CrossFunction, server, api)
+		updatedCommand, err = httpCommand.NewHttpCommandWithRuntime(g.CrossFunction, runtime, api)
 	} else if _cmd, ok := g.commands[apiName].(*httpCommand.HttpHystrixCommand); ok {
 		var cmd command.Command
-		cmd, err = httpCommand.NewHttpCommand(g.CrossFunction, server, api)
+		cmd, err = httpCommand.NewHttpCommandWithRuntime(g.CrossFunction, runtime, api)
+		if err == nil {
+			_cmd.UpdateCommand(cmd)
+			updatedCommand = _cmd
+		}
+	} else if _cmd, ok := g.commands[apiName].(*httpCommand.HttpBreakerCommand); ok {
+		var cmd command.Command
+		cmd, err = httpCommand.NewHttpCommandWithRuntime(g.CrossFunction, runtime, api)
 		if err == nil {
 			_cmd.UpdateCommand(cmd)
 			updatedCommand = _cmd
@@ -158,10 +364,22 @@ func (g *goxHttpContextImpl) updateAPi(api *command.Api) error {
 	// Store this http command to use
 	g.commands[apiName] = updatedCommand
 	g.timeouts[apiName] = api.Timeout
+	g.setupFallback(apiName, updatedCommand)
+	g.setupAsyncPool(api)
 
 	return nil
 }
 
+// ResponseCodec gives the codec of response_codec of the api, returns false if the api does not have response_codec
+func (g *goxHttpContextImpl) ResponseCodec(api string) (command.Codec, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if a, ok := g.config.Apis[api]; ok && a.ResponseCodec != "" {
+		return command.GetCodec(a.ResponseCodec)
+	}
+	return nil, false
+}
+
 // GetRestyClient method will return underlying resty client if it uses it, provided the
 // api name
 //
@@ -171,12 +389,18 @@ func (g *goxHttpContextImpl) updateAPi(api *command.Api) error {
 // Returns:
 // - resty client if this command is implemented using resty client under the hood
 // - bool - true if resty client is returned otherwise false
+//
+// The client uses the connection pool which is shared by all APIs of the server, it is not reachable through the client:
+// resty methods which change the transport (SetTLSClientConfig, SetProxy etc.) log an error and do nothing - use the
+// server config instead. Client is replaced when the api is reloaded.
 func (g *goxHttpContextImpl) GetRestyClient(api string) (*resty.Client, bool) {
-	if cmd, ok := g.commands[api]; ok {
+	if cmd, _, ok := g.command(api); ok {
 		if hc, ok := cmd.(*httpCommand.HttpCommand); ok {
 			return hc.GetRestyClient()
 		} else if hhc, ok := cmd.(*httpCommand.HttpHystrixCommand); ok {
 			return hhc.GetRestyClient()
+		} else if hbc, ok := cmd.(*httpCommand.HttpBreakerCommand); ok {
+			return hbc.GetRestyClient()
 		} else {
 			return nil, false
 		}
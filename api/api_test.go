@@ -3,6 +3,7 @@ package goxHttpApi
 import (
 	"context"
 	"errors"
+	"github.com/devlibx/gox-base/v2/serialization"
 	"github.com/devlibx/gox-base/v2/test"
 	"github.com/devlibx/gox-http/v4/command"
 	"github.com/devlibx/gox-http/v4/testhelper"
@@ -24,3 +25,25 @@ func TestGoxHttpContext_WithNonExistingApiName(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, ErrCommandNotRegisteredForApi))
 }
+
+func TestGoxHttpContext_WithInvalidMethod(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  getUser:
+    path: /users
+    method: GTE
+    server: testServer
+`, &config)
+	assert.NoError(t, err)
+
+	_, err = NewGoxHttpContext(cf, &config)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid method=GTE for api=getUser")
+	}
+}
@@ -0,0 +1,104 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"net/http"
+	"sync"
+)
+
+var errAsyncQueueFull = errors.New("async queue is full")
+var errAsyncPoolClosed = errors.New("async worker pool is closed")
+
+type asyncJob struct {
+	ctx             context.Context
+	request         *command.GoxRequest
+	responseChannel chan *command.GoxResponse
+}
+
+// asyncWorkerPool runs requests of an api marked with "async: true" on a fixed number of workers (api concurrency).
+// At most api async_queue_size requests can wait for a worker, more requests are rejected.
+type asyncWorkerPool struct {
+	execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)
+	jobs    chan *asyncJob
+	lock    *sync.RWMutex
+	closed  bool
+}
+
+func newAsyncWorkerPool(api *command.Api, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) *asyncWorkerPool {
+	workers := api.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	queueSize := api.AsyncQueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &asyncWorkerPool{
+		execute: execute,
+		jobs:    make(chan *asyncJob, queueSize),
+		lock:    &sync.RWMutex{},
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *asyncWorkerPool) work() {
+	for job := range p.jobs {
+
+		// Caller is gone (cancelled or timed out) while this job was waiting - do not make the call
+		if job.ctx.Err() != nil {
+			job.responseChannel <- asyncErrorResponse(job.ctx.Err(), http.StatusRequestTimeout, "request timeout on client while waiting for async worker", "request_timeout_on_client")
+			continue
+		}
+
+		job.responseChannel <- command.NewGoxResponseFromResult(p.execute(job.ctx, job.request))
+	}
+}
+
+// submit schedules the request and returns the channel which will get the response. It never blocks - if the queue
+// is full then the channel will get an error response.
+func (p *asyncWorkerPool) submit(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
+	responseChannel := make(chan *command.GoxResponse, 1)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.closed {
+		responseChannel <- asyncErrorResponse(errAsyncPoolClosed, http.StatusBadRequest, "async worker pool is closed", "async_pool_closed")
+		return responseChannel
+	}
+
+	select {
+	case p.jobs <- &asyncJob{ctx: ctx, request: request, responseChannel: responseChannel}:
+	default:
+		responseChannel <- asyncErrorResponse(errAsyncQueueFull, http.StatusBadRequest, "request rejected - async queue is full", command.ErrorCodeRequestQueueFull)
+	}
+	return responseChannel
+}
+
+// close stops the workers once the already queued requests are processed
+func (p *asyncWorkerPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+func asyncErrorResponse(err error, statusCode int, message string, errorCode string) *command.GoxResponse {
+	return &command.GoxResponse{
+		StatusCode: statusCode,
+		Err: &command.GoxHttpError{
+			Err:        err,
+			StatusCode: statusCode,
+			Message:    message,
+			ErrorCode:  errorCode,
+		},
+	}
+}
@@ -0,0 +1,161 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	httpCommand "github.com/devlibx/gox-http/v4/command/http"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoxHttpContext_OnCircuitStateChange(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  getUser:
+    path: /users
+    server: testServer
+    timeout: 1000
+    circuit_breaker:
+      type: native
+      request_volume_threshold: 2
+      error_percent_threshold: 50
+      sleep_window_ms: 10000
+  getOrder:
+    path: /orders
+    server: testServer
+    timeout: 1000
+    disable_hystrix: true
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	lock := &sync.Mutex{}
+	var events []httpCommand.CircuitEvent
+	goxHttpCtx.OnCircuitStateChange(func(event httpCommand.CircuitEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, event)
+	})
+
+	state, err := goxHttpCtx.CircuitState("getUser")
+	assert.NoError(t, err)
+	assert.Equal(t, httpCommand.CircuitClosed, state)
+
+	for i := 0; i < 2; i++ {
+		_, err = goxHttpCtx.Execute(context.Background(), &command.GoxRequest{Api: "getUser"})
+		assert.Error(t, err)
+	}
+
+	state, err = goxHttpCtx.CircuitState("getUser")
+	assert.NoError(t, err)
+	assert.Equal(t, httpCommand.CircuitOpen, state)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "getUser", events[0].Api)
+		assert.Equal(t, "testServer", events[0].Server)
+		assert.Equal(t, httpCommand.CircuitClosed, events[0].From)
+		assert.Equal(t, httpCommand.CircuitOpen, events[0].To)
+		assert.NotEmpty(t, events[0].Reason)
+	}
+
+	// Api without circuit breaker is always closed
+	state, err = goxHttpCtx.CircuitState("getOrder")
+	assert.NoError(t, err)
+	assert.Equal(t, httpCommand.CircuitClosed, state)
+
+	_, err = goxHttpCtx.CircuitState("unknown")
+	assert.Error(t, err)
+}
+
+func TestGoxHttpContext_OnCircuitStateChange_ServerScope(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	for _, breakerType := range []string{"native", "hystrix"} {
+		t.Run(breakerType, func(t *testing.T) {
+			cf, _ := test.MockCf(t)
+			config := command.Config{}
+			err := serialization.ReadYamlFromString(strings.ReplaceAll(`
+servers:
+  sharedServer_TYPE:
+    host: localhost
+    circuit_breaker:
+      type: TYPE
+      scope: server
+      request_volume_threshold: 2
+      error_percent_threshold: 50
+      sleep_window_ms: 10000
+apis:
+  getUser:
+    path: /users
+    server: sharedServer_TYPE
+    timeout: 1000
+  getOrder:
+    path: /orders
+    server: sharedServer_TYPE
+    timeout: 1000
+`, "TYPE", breakerType), &config)
+			assert.NoError(t, err)
+			config.UpdateServerWithUrl("sharedServer_"+breakerType, ts.URL)
+
+			goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+			assert.NoError(t, err)
+
+			lock := &sync.Mutex{}
+			var events []httpCommand.CircuitEvent
+			goxHttpCtx.OnCircuitStateChange(func(event httpCommand.CircuitEvent) {
+				lock.Lock()
+				defer lock.Unlock()
+				events = append(events, event)
+			})
+
+			// Hystrix updates its metrics in background, so keep calling until circuit is open
+			for i := 0; i < 20; i++ {
+				for _, api := range []string{"getUser", "getOrder"} {
+					_, _ = goxHttpCtx.Execute(context.Background(), &command.GoxRequest{Api: api})
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, api := range []string{"getUser", "getOrder"} {
+				state, err := goxHttpCtx.CircuitState(api)
+				assert.NoError(t, err)
+				assert.Equal(t, httpCommand.CircuitOpen, state)
+			}
+
+			// Circuit shared by both apis sends a single event for the server
+			lock.Lock()
+			defer lock.Unlock()
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, "", events[0].Api)
+				assert.Equal(t, "sharedServer_"+breakerType, events[0].Server)
+				assert.Equal(t, httpCommand.CircuitClosed, events[0].From)
+				assert.Equal(t, httpCommand.CircuitOpen, events[0].To)
+			}
+		})
+	}
+}
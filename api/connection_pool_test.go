@@ -0,0 +1,167 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApisOfSameServerShareConnectionPool(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	// Count the connections opened to this server
+	newConnections := int32(0)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status": "ok"}`))
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConnections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  first:
+    path: /first
+    server: testServer
+    timeout: 1000
+    disable_hystrix: true
+  second:
+    path: /second
+    server: testServer
+    timeout: 1000
+  third:
+    path: /third
+    server: testServer
+    timeout: 1000
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	for _, api := range []string{"first", "second", "third", "first"} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err = goxHttpCtx.Execute(ctx, command.NewGoxRequestBuilder(api).Build())
+		cancel()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+}
+
+func TestReloadApi_ServerChanged(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	newConnections := int32(0)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "ok"}`))
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConnections, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  first:
+    path: /first
+    server: testServer
+    timeout: 1000
+    disable_hystrix: true
+  second:
+    path: /second
+    server: testServer
+    timeout: 1000
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+	defer goxHttpCtx.Close()
+
+	execute := func() {
+		for _, api := range []string{"first", "second"} {
+			_, err := goxHttpCtx.Execute(context.Background(), command.NewGoxRequestBuilder(api).Build())
+			assert.NoError(t, err)
+		}
+	}
+	execute()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+
+	// Reload without a change of server keeps the connection pool
+	assert.NoError(t, goxHttpCtx.ReloadApi("first"))
+	execute()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+
+	// Change of server creates a new pool - both apis move to it, and idle connections of old pool are closed
+	config.Servers["testServer"].IdleConnectionTimeout = 30000
+	assert.NoError(t, goxHttpCtx.ReloadApi("first"))
+	execute()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&newConnections))
+}
+
+func TestGetRestyClient_SharedTransportIsNotChanged(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  first:
+    path: /first
+    server: testServer
+    timeout: 1000
+    disable_hystrix: true
+  second:
+    path: /second
+    server: testServer
+    timeout: 1000
+    disable_hystrix: true
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	// Proxy set on the client of one api must not change the shared transport used by the other api
+	rc, ok := GetRestyClientFromGoxHttpCtx(goxHttpCtx, "first")
+	assert.True(t, ok)
+	_, isTransport := rc.GetClient().Transport.(*http.Transport)
+	assert.False(t, isTransport)
+	rc.SetProxy("http://127.0.0.1:1")
+
+	_, err = goxHttpCtx.Execute(context.Background(), command.NewGoxRequestBuilder("second").Build())
+	assert.NoError(t, err)
+}
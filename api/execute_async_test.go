@@ -0,0 +1,137 @@
+package goxHttpApi
+
+import (
+	"context"
+	"fmt"
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	httpCommand "github.com/devlibx/gox-http/v4/command/http"
+	"github.com/devlibx/gox-http/v4/testhelper"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func setupAsyncTestContext(t *testing.T, delay time.Duration, update func(config *command.Config)) GoxHttpContext {
+	cf, _ := test.MockCf(t)
+	httpCommand.HystrixConfigMap = gox.StringObjectMap{}
+	hystrix.Flush()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		data := gox.StringObjectMap{"status": "ok"}
+		_, _ = fmt.Fprintln(w, serialization.StringifySuppressError(data, "{}"))
+	}))
+	t.Cleanup(ts.Close)
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(testhelper.TestConfigWithRealServer, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.Apis["delay_timeout_10"].Timeout = 1000
+	if update != nil {
+		update(&config)
+	}
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+	return goxHttpCtx
+}
+
+func TestExecuteAsync_HystrixAndNonHystrix(t *testing.T) {
+	for _, disableHystrix := range []bool{false, true} {
+		goxHttpCtx := setupAsyncTestContext(t, 0, func(config *command.Config) {
+			config.Apis["delay_timeout_10"].DisableHystrix = disableHystrix
+		})
+
+		request := command.NewGoxRequestBuilder("delay_timeout_10").
+			WithResponseBuilder(command.NewJsonToObjectResponseBuilder(&gox.StringObjectMap{})).
+			Build()
+		response := <-goxHttpCtx.ExecuteAsync(context.Background(), request)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, "ok", response.AsStringObjectMapOrEmpty().StringOrEmpty("status"))
+	}
+}
+
+func TestExecuteAsync_AsyncApiRunsOnBoundedPool(t *testing.T) {
+	goxHttpCtx := setupAsyncTestContext(t, 50*time.Millisecond, func(config *command.Config) {
+		config.Apis["delay_timeout_10"].Async = true
+		config.Apis["delay_timeout_10"].Concurrency = 1
+		config.Apis["delay_timeout_10"].AsyncQueueSize = 1
+	})
+
+	// 1 request runs on the worker, 1 waits in queue and the rest are rejected (api has no wait queue, queue_size is not
+	// used by the worker pool)
+	channels := make([]chan *command.GoxResponse, 0)
+	for i := 0; i < 5; i++ {
+		request := command.NewGoxRequestBuilder("delay_timeout_10").Build()
+		channels = append(channels, goxHttpCtx.ExecuteAsync(context.Background(), request))
+	}
+
+	success, rejected := 0, 0
+	for _, ch := range channels {
+		response := <-ch
+		if response.Err == nil {
+			success++
+		} else if e, ok := response.Err.(*command.GoxHttpError); ok && e.IsRequestQueueFullError() {
+			rejected++
+		}
+	}
+	assert.True(t, success >= 1)
+	assert.True(t, rejected >= 2)
+	assert.Equal(t, 5, success+rejected)
+}
+
+func TestExecuteAsync_Cancel(t *testing.T) {
+	goxHttpCtx := setupAsyncTestContext(t, 200*time.Millisecond, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := command.NewGoxRequestBuilder("delay_timeout_10").Build()
+	responseChannel := goxHttpCtx.ExecuteAsync(ctx, request)
+	cancel()
+
+	select {
+	case response := <-responseChannel:
+		assert.Error(t, response.Err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "cancelled async request did not complete")
+	}
+}
+
+func TestExecuteAsync_WithReloadApi(t *testing.T) {
+	goxHttpCtx := setupAsyncTestContext(t, time.Millisecond, func(config *command.Config) {
+		config.Apis["delay_timeout_10"].Async = true
+		config.Apis["delay_timeout_10"].DisableHystrix = true
+		config.Apis["delay_timeout_10"].Concurrency = 4
+		config.Apis["delay_timeout_10"].AsyncQueueSize = 1000
+	})
+
+	// Api is reloaded while requests are submitted - requests go to the old pool (which is drained) or the new pool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, goxHttpCtx.ReloadApi("delay_timeout_10"))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	channels := make([]chan *command.GoxResponse, 0)
+	for i := 0; i < 200; i++ {
+		channels = append(channels, goxHttpCtx.ExecuteAsync(context.Background(), command.NewGoxRequestBuilder("delay_timeout_10").Build()))
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	<-done
+
+	for _, ch := range channels {
+		response := <-ch
+		assert.NoError(t, response.Err)
+	}
+}
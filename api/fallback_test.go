@@ -0,0 +1,67 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoxHttpContext_RegisterFallback(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  getUser:
+    path: /users
+    server: testServer
+    timeout: 1000
+    circuit_breaker:
+      type: native
+      request_volume_threshold: 2
+      error_percent_threshold: 50
+      sleep_window_ms: 10000
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	var errorCodes []string
+	goxHttpCtx.RegisterFallback("getUser", func(ctx context.Context, request *command.GoxRequest, err error) (*command.GoxResponse, error) {
+		var goxErr *command.GoxHttpError
+		if assert.ErrorAs(t, err, &goxErr) {
+			errorCodes = append(errorCodes, goxErr.ErrorCode)
+		}
+		return &command.GoxResponse{StatusCode: http.StatusOK, Body: []byte("fallback")}, nil
+	})
+
+	// 5xx opens the circuit, and then requests fail with open circuit - fallback is used for all of them
+	for i := 0; i < 3; i++ {
+		response, err := goxHttpCtx.Execute(context.Background(), &command.GoxRequest{Api: "getUser"})
+		assert.NoError(t, err)
+		assert.True(t, response.FromFallback)
+		assert.Equal(t, "fallback", string(response.Body))
+	}
+	assert.Equal(t, []string{"server_response_with_error", "server_response_with_error", "hystrix_circuit_open"}, errorCodes)
+
+	// Fallback is kept after reload
+	assert.NoError(t, goxHttpCtx.ReloadApi("getUser"))
+	response, err := goxHttpCtx.Execute(context.Background(), &command.GoxRequest{Api: "getUser"})
+	assert.NoError(t, err)
+	assert.True(t, response.FromFallback)
+}
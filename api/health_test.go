@@ -0,0 +1,75 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoxHttpContext_HealthAndClose(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var healthChecks int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			atomic.AddInt32(&healthChecks, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  checkedServer:
+    host: localhost
+    health_check:
+      interval_ms: 10
+      unhealthy_threshold: 1
+  otherServer:
+    host: localhost
+apis:
+  getUser:
+    path: /users
+    server: checkedServer
+    timeout: 1000
+  getOrder:
+    path: /orders
+    server: otherServer
+    timeout: 1000
+    async: true
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("checkedServer", ts.URL)
+	config.UpdateServerWithUrl("otherServer", ts.URL)
+
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	report := goxHttpCtx.Health()
+	assert.False(t, report.Healthy)
+	assert.False(t, report.Servers["checkedServer"].Healthy)
+	assert.True(t, report.Servers["otherServer"].Healthy)
+
+	// After close health checks are stopped, but requests still work
+	goxHttpCtx.Close()
+	time.Sleep(20 * time.Millisecond)
+	checks := atomic.LoadInt32(&healthChecks)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, checks, atomic.LoadInt32(&healthChecks))
+
+	_, err = goxHttpCtx.Execute(context.Background(), &command.GoxRequest{Api: "getUser"})
+	assert.NoError(t, err)
+	response := <-goxHttpCtx.ExecuteAsync(context.Background(), &command.GoxRequest{Api: "getOrder"})
+	assert.Error(t, response.Err)
+}
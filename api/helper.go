@@ -3,7 +3,6 @@ package goxHttpApi
 import (
 	"context"
 	"github.com/devlibx/gox-base/v2/errors"
-	"github.com/devlibx/gox-base/v2/serialization"
 	"github.com/devlibx/gox-http/v4/command"
 	"github.com/opentracing/opentracing-go"
 	"log/slog"
@@ -18,6 +17,9 @@ type GoxSuccessResponse[SuccessResp any] struct {
 	Body       []byte `json:"-"`
 	Response   SuccessResp
 	StatusCode int
+
+	// ResponseMetadata has the headers and protocol details of the response from server
+	command.ResponseMetadata
 }
 
 // GoxSuccessListResponse is the typed response after successful http call and parsing response to success object
@@ -25,6 +27,9 @@ type GoxSuccessListResponse[SuccessResp any] struct {
 	Body       []byte
 	Response   []SuccessResp
 	StatusCode int
+
+	// ResponseMetadata has the headers and protocol details of the response from server
+	command.ResponseMetadata
 }
 
 // GoxError is the typed response after successful http call and parsing response to success object
@@ -33,6 +38,10 @@ type GoxError[ErrorResp any] struct {
 	Response   ErrorResp
 	StatusCode int
 	Err        error
+
+	// ResponseMetadata has the headers and protocol details of the response from server (empty if there was no
+	// response e.g. timeout)
+	command.ResponseMetadata
 }
 
 // ExecuteHttp is a helper function to execute http request and parse response to success or error object
@@ -75,52 +84,71 @@ func internalExecuteHttp[SuccessResp any, ErrorResp any](
 
 	// Execute request and process response
 	resp, err := goxHttpCtx.Execute(ctx, request)
+	codec := responseCodec(goxHttpCtx, request.Api, resp)
 	if err == nil {
 		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
-			return processSuccess[SuccessResp, ErrorResp](resp, isList, err)
+			return processSuccess[SuccessResp, ErrorResp](resp, codec, isList, err)
 		} else {
 			logSpanOnError(span, err, request)
-			return processError[SuccessResp, ErrorResp](err, resp)
+			return processError[SuccessResp, ErrorResp](err, codec, resp)
 		}
 	} else {
 		logSpanOnError(span, err, request)
-		return processError[SuccessResp, ErrorResp](err, resp)
+		return processError[SuccessResp, ErrorResp](err, codec, resp)
+	}
+}
+
+// responseCodec gives the codec to decode the response body - the codec of the Content-Type of the response, otherwise
+// the codec of response_codec of the api if the response has no Content-Type (or one without a codec), otherwise json
+func responseCodec(goxHttpCtx GoxHttpContext, api string, resp *command.GoxResponse) command.Codec {
+	if resp != nil {
+		if codec, ok := command.GetCodec(resp.Header.Get("Content-Type")); ok {
+			return codec
+		}
+	}
+	if provider, ok := goxHttpCtx.(ResponseCodecProvider); ok {
+		if codec, ok := provider.ResponseCodec(api); ok {
+			return codec
+		}
 	}
+	return command.JsonCodec{}
 }
 
-func processSuccess[SuccessResp any, ErrorResp any](resp *command.GoxResponse, isList bool, err error) (*GoxSuccessResponse[SuccessResp], *GoxSuccessListResponse[SuccessResp], error) {
+func processSuccess[SuccessResp any, ErrorResp any](resp *command.GoxResponse, codec command.Codec, isList bool, err error) (*GoxSuccessResponse[SuccessResp], *GoxSuccessListResponse[SuccessResp], error) {
 
 	// If status is StatusNoContent then we will do special handling
 	if resp.StatusCode == http.StatusNoContent {
-		return &GoxSuccessResponse[SuccessResp]{StatusCode: http.StatusNoContent},
-			&GoxSuccessListResponse[SuccessResp]{StatusCode: http.StatusNoContent},
+		return &GoxSuccessResponse[SuccessResp]{StatusCode: http.StatusNoContent, ResponseMetadata: resp.ResponseMetadata},
+			&GoxSuccessListResponse[SuccessResp]{StatusCode: http.StatusNoContent, ResponseMetadata: resp.ResponseMetadata},
 			nil
 	} else if resp.StatusCode == http.StatusOK && (resp.Body == nil || len(resp.Body) == 0) {
 		// There are cases where we get http status = 200 but no response body
-		return &GoxSuccessResponse[SuccessResp]{StatusCode: http.StatusNoContent},
-			&GoxSuccessListResponse[SuccessResp]{StatusCode: http.StatusNoContent},
+		return &GoxSuccessResponse[SuccessResp]{StatusCode: http.StatusNoContent, ResponseMetadata: resp.ResponseMetadata},
+			&GoxSuccessListResponse[SuccessResp]{StatusCode: http.StatusNoContent, ResponseMetadata: resp.ResponseMetadata},
 			nil
 	}
 
 	// If this is other status then based on the list/not-list process the response
 	if isList {
 		var successResp []SuccessResp
-		if serializationErr := serialization.JsonBytesToObject(resp.Body, &successResp); serializationErr == nil {
+		if serializationErr := codec.Decode(resp.Body, &successResp); serializationErr == nil {
 			return nil, &GoxSuccessListResponse[SuccessResp]{
-				Body:       resp.Body,
-				StatusCode: resp.StatusCode,
-				Response:   successResp,
+				Body:             resp.Body,
+				StatusCode:       resp.StatusCode,
+				Response:         successResp,
+				ResponseMetadata: resp.ResponseMetadata,
 			}, nil
 		} else {
 			err = serializationErr
 		}
 	} else {
 		var successResp SuccessResp
-		if serializationErr := serialization.JsonBytesToObject(resp.Body, &successResp); serializationErr == nil {
+		if serializationErr := codec.Decode(resp.Body, &successResp); serializationErr == nil {
 			return &GoxSuccessResponse[SuccessResp]{
-				Body:       resp.Body,
-				StatusCode: resp.StatusCode,
-				Response:   successResp,
+				Body:             resp.Body,
+				StatusCode:       resp.StatusCode,
+				Response:         successResp,
+				ResponseMetadata: resp.ResponseMetadata,
 			}, nil, nil
 		} else {
 			err = serializationErr
@@ -129,38 +157,44 @@ func processSuccess[SuccessResp any, ErrorResp any](resp *command.GoxResponse, i
 
 	// We must have got error in parsing payload
 	return nil, nil, &GoxError[ErrorResp]{
-		Body:       resp.Body,
-		StatusCode: resp.StatusCode,
-		Err:        errors.Wrap(err, "http request passed but failed to parse response into response object"),
+		Body:             resp.Body,
+		StatusCode:       resp.StatusCode,
+		Err:              errors.Wrap(err, "http request passed but failed to parse response into response object"),
+		ResponseMetadata: resp.ResponseMetadata,
 	}
 }
 
-func processError[SuccessResp any, ErrorResp any](err error, resp *command.GoxResponse) (*GoxSuccessResponse[SuccessResp], *GoxSuccessListResponse[SuccessResp], error) {
+func processError[SuccessResp any, ErrorResp any](err error, codec command.Codec, resp *command.GoxResponse) (*GoxSuccessResponse[SuccessResp], *GoxSuccessListResponse[SuccessResp], error) {
 	var goxError *command.GoxHttpError
 	if errors.As(err, &goxError) || (resp != nil && resp.Body != nil && len(resp.Body) > 0) {
 		var errorResp ErrorResp
 		if resp == nil || resp.Body == nil || len(resp.Body) == 0 {
 			code := http.StatusInternalServerError
+			var metadata command.ResponseMetadata
 			if resp != nil {
 				code = resp.StatusCode
+				metadata = resp.ResponseMetadata
 			}
 			return nil, nil, &GoxError[ErrorResp]{
-				Body:       nil,
-				StatusCode: code,
-				Err:        err,
+				Body:             nil,
+				StatusCode:       code,
+				Err:              err,
+				ResponseMetadata: metadata,
 			}
-		} else if serializationErr := serialization.JsonBytesToObject(resp.Body, &errorResp); serializationErr == nil {
+		} else if serializationErr := codec.Decode(resp.Body, &errorResp); serializationErr == nil {
 			return nil, nil, &GoxError[ErrorResp]{
-				Response:   errorResp,
-				Body:       resp.Body,
-				StatusCode: resp.StatusCode,
-				Err:        err,
+				Response:         errorResp,
+				Body:             resp.Body,
+				StatusCode:       resp.StatusCode,
+				Err:              err,
+				ResponseMetadata: resp.ResponseMetadata,
 			}
 		} else {
 			return nil, nil, &GoxError[ErrorResp]{
-				Body:       resp.Body,
-				StatusCode: resp.StatusCode,
-				Err:        errors.Wrap(err, "http request got error with response but failed to parse response into response object"),
+				Body:             resp.Body,
+				StatusCode:       resp.StatusCode,
+				Err:              errors.Wrap(err, "http request got error with response but failed to parse response into response object"),
+				ResponseMetadata: resp.ResponseMetadata,
 			}
 		}
 	}
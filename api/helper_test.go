@@ -5,6 +5,7 @@ import (
 	"github.com/devlibx/gox-base/v2"
 	"github.com/devlibx/gox-base/v2/errors"
 	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-base/v2/test"
 	"github.com/devlibx/gox-http/v4/command"
 	"github.com/gin-gonic/gin"
 	"github.com/go-json-experiment/json"
@@ -308,3 +309,106 @@ type successPojo struct {
 type errorPojo struct {
 	Status string `json:"status"`
 }
+
+func TestExecuteHttp_ResponseMetadata(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/posts/2")
+		if r.URL.Path == "/posts/bad" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  getPosts:
+    path: /posts/{id}
+    server: testServer
+    timeout: 1000
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	success, err := ExecuteHttp[gox.StringObjectMap, gox.StringObjectMap](context.Background(), goxHttpCtx, command.NewGoxRequestBuilder("getPosts").WithPathParam("id", 1).Build())
+	assert.NoError(t, err)
+	assert.Equal(t, "/posts/2", success.Header.Get("Location"))
+	assert.Equal(t, "HTTP/1.1", success.Proto)
+	assert.Equal(t, 1, success.Attempts)
+
+	_, err = ExecuteHttp[gox.StringObjectMap, gox.StringObjectMap](context.Background(), goxHttpCtx, command.NewGoxRequestBuilder("getPosts").WithPathParam("id", "bad").Build())
+	goxError, _, ok := ExtractError[gox.StringObjectMap](err)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, goxError.StatusCode)
+		assert.Equal(t, "/posts/2", goxError.Header.Get("Location"))
+		assert.Equal(t, ts.URL+"/posts/bad", goxError.Url)
+	}
+}
+
+type codecTestPost struct {
+	Id    int    `xml:"id"`
+	Title string `xml:"title"`
+}
+
+func TestExecuteHttp_ResponseCodec(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/posts/1" {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/vnd.unknown")
+		}
+		_, _ = w.Write([]byte(`<post><id>1</id><title>hello</title></post>`))
+	}))
+	defer ts.Close()
+
+	config := command.Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  getPost:
+    path: /posts/1
+    server: testServer
+    timeout: 1000
+  getPostJson:
+    path: /posts/1
+    server: testServer
+    timeout: 1000
+    response_codec: application/json
+  getPostUnknownType:
+    path: /posts/2
+    server: testServer
+    timeout: 1000
+    response_codec: application/xml
+`, &config)
+	assert.NoError(t, err)
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+	assert.NoError(t, err)
+
+	// Decoded by the content type of the response
+	post, err := ExecuteHttp[codecTestPost, gox.StringObjectMap](context.Background(), goxHttpCtx, command.NewGoxRequestBuilder("getPost").Build())
+	assert.NoError(t, err)
+	assert.Equal(t, codecTestPost{Id: 1, Title: "hello"}, post.Response)
+
+	// Content type of the response is used over response_codec of the api
+	post, err = ExecuteHttp[codecTestPost, gox.StringObjectMap](context.Background(), goxHttpCtx, command.NewGoxRequestBuilder("getPostJson").Build())
+	assert.NoError(t, err)
+	assert.Equal(t, codecTestPost{Id: 1, Title: "hello"}, post.Response)
+
+	// response_codec of the api is used if the content type has no codec
+	post, err = ExecuteHttp[codecTestPost, gox.StringObjectMap](context.Background(), goxHttpCtx, command.NewGoxRequestBuilder("getPostUnknownType").Build())
+	assert.NoError(t, err)
+	assert.Equal(t, codecTestPost{Id: 1, Title: "hello"}, post.Response)
+}
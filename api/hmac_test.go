@@ -2,6 +2,9 @@ package goxHttpApi
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"github.com/devlibx/gox-base/v2"
 	"github.com/devlibx/gox-base/v2/serialization"
@@ -10,6 +13,7 @@ import (
 	"github.com/devlibx/gox-http/v4/interceptor"
 	"github.com/devlibx/gox-http/v4/testhelper"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -202,3 +206,62 @@ func Test_Post_Success_With_Hmac_Struct(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "ok", response.AsStringObjectMapOrEmpty().StringOrEmpty("status"))
 }
+
+func Test_Post_Multipart_With_Hmac(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, []byte("secret_123"))
+		mac.Write([]byte(payload))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	// Server checks the digest of the body, and the hash of (digest, timestamp) or only timestamp
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		digest := sha256.Sum256(body)
+		encodedDigest := base64.StdEncoding.EncodeToString(digest[:])
+		if r.Header.Get("Content-Digest") != "" {
+			assert.Equal(t, "sha-256=:"+encodedDigest+":", r.Header.Get("Content-Digest"))
+			assert.Equal(t, sign(encodedDigest+"#1704067200000"), r.Header.Get("X-Hash-Code"))
+		} else {
+			assert.Equal(t, sign("1704067200000"), r.Header.Get("X-Hash-Code"))
+		}
+		assert.True(t, strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data; boundary="))
+		assert.Contains(t, string(body), "file content")
+		_, _ = fmt.Fprintln(w, `{"status": "ok"}`)
+	}))
+	defer ts.Close()
+
+	for _, multipartBody := range []string{interceptor.HmacMultipartBodyDigest, interceptor.HmacMultipartBodyExclude, ""} {
+		config := command.Config{}
+		err := serialization.ReadYamlFromString(testhelper.TestConfigWithRealServer, &config)
+		assert.NoError(t, err)
+		config.UpdateServerWithUrl("testServer", ts.URL)
+		config.Apis["delay_timeout_10_POST"].DisableHystrix = true
+		config.Apis["delay_timeout_10_POST"].Timeout = 1000
+		config.Servers["testServer"].InterceptorConfig = &interceptor.Config{
+			HmacConfig: &interceptor.HmacConfig{
+				Key:                "secret_123",
+				HashHeaderKey:      "X-Hash-Code",
+				TimestampHeaderKey: "X-Timestamp",
+				MultipartBody:      multipartBody,
+			},
+		}
+		goxHttpCtx, err := NewGoxHttpContext(cf, &config)
+		assert.NoError(t, err)
+
+		ctx := context.WithValue(context.Background(), "__testing_ts__", "1704067200000")
+		request := command.NewGoxRequestBuilder("delay_timeout_10_POST").
+			WithFormField("title", "report").
+			WithFile("file", "report.txt", strings.NewReader("file content")).
+			Build()
+		response, err := goxHttpCtx.Execute(ctx, request)
+		if multipartBody == "" {
+			// Streamed body is not signed without multipart_body config
+			assert.ErrorContains(t, err, "multipart_body")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, "{\"status\": \"ok\"}\n", string(response.Body))
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/devlibx/gox-base/v2/errors"
 	"github.com/devlibx/gox-http/v4/command"
+	httpCommand "github.com/devlibx/gox-http/v4/command/http"
 )
 
 type noOpGoxHttpContext struct {
@@ -17,6 +18,33 @@ func (n noOpGoxHttpContext) Execute(ctx context.Context, request *command.GoxReq
 	return nil, errors.New("not implemented")
 }
 
+func (n noOpGoxHttpContext) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
+	responseChannel := make(chan *command.GoxResponse, 1)
+	responseChannel <- &command.GoxResponse{Err: errors.New("not implemented")}
+	return responseChannel
+}
+
+func (n noOpGoxHttpContext) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (n noOpGoxHttpContext) OnCircuitStateChange(listener httpCommand.CircuitListener) {
+}
+
+func (n noOpGoxHttpContext) CircuitState(api string) (httpCommand.CircuitState, error) {
+	return httpCommand.CircuitClosed, nil
+}
+
+func (n noOpGoxHttpContext) RegisterFallback(api string, fallback command.FallbackFunc) {
+}
+
+func (n noOpGoxHttpContext) Health() *httpCommand.HealthReport {
+	return &httpCommand.HealthReport{Healthy: true, Servers: map[string]*httpCommand.ServerHealth{}}
+}
+
+func (n noOpGoxHttpContext) Close() {
+}
+
 func NoOpGoxHttpContext() GoxHttpContext {
 	return &noOpGoxHttpContext{}
 }
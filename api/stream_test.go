@@ -0,0 +1,36 @@
+package goxHttpApi
+
+import (
+	"context"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExecuteStream_HystrixAndNonHystrix(t *testing.T) {
+	for _, disableHystrix := range []bool{false, true} {
+		goxHttpCtx := setupAsyncTestContext(t, 0, func(config *command.Config) {
+			config.Apis["delay_timeout_10"].DisableHystrix = disableHystrix
+		})
+
+		response, err := goxHttpCtx.ExecuteStream(context.Background(), command.NewGoxRequestBuilder("delay_timeout_10").Build())
+		assert.NoError(t, err)
+		assert.Equal(t, 200, response.StatusCode)
+		data, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"status":"ok"}`, strings.TrimSpace(string(data)))
+		assert.NoError(t, response.Body.Close())
+	}
+}
+
+func TestExecuteStream_UnknownApi(t *testing.T) {
+	goxHttpCtx := setupAsyncTestContext(t, 0, nil)
+
+	response, err := goxHttpCtx.ExecuteStream(context.Background(), command.NewGoxRequestBuilder("unknown").Build())
+	assert.Nil(t, response)
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.Equal(t, "command_not_found", goxErr.ErrorCode)
+}
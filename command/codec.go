@@ -0,0 +1,236 @@
+package command
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-base/v2/serialization"
+	msgpack "github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"mime"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const ContentTypeJson = "application/json"
+const ContentTypeForm = "application/x-www-form-urlencoded"
+const ContentTypeXml = "application/xml"
+const ContentTypeProtobuf = "application/x-protobuf"
+const ContentTypeMsgpack = "application/msgpack"
+const ContentTypeText = "text/plain"
+
+// Codec encodes the request body and decodes the response body of a content type. Implementations must be safe for
+// concurrent use.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+// codecs are the codecs by media type, RegisterCodec adds a custom codec
+var codecs = map[string]Codec{
+	ContentTypeJson:         JsonCodec{},
+	ContentTypeForm:         FormCodec{},
+	ContentTypeXml:          XmlCodec{},
+	"text/xml":              XmlCodec{},
+	ContentTypeProtobuf:     ProtobufCodec{},
+	"application/protobuf":  ProtobufCodec{},
+	ContentTypeMsgpack:      MsgpackCodec{},
+	"application/x-msgpack": MsgpackCodec{},
+	ContentTypeText:         TextCodec{},
+}
+var codecsLock = &sync.RWMutex{}
+
+// RegisterCodec sets the codec of a content type (parameters like charset are ignored), it replaces the built-in codec
+// of the content type if any
+func RegisterCodec(contentType string, codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[mediaType(contentType)] = codec
+}
+
+// GetCodec gives the codec of a content type e.g. "application/xml; charset=utf-8". A content type with +json or +xml
+// suffix (e.g. application/problem+json) uses the json or xml codec.
+func GetCodec(contentType string) (Codec, bool) {
+	name := mediaType(contentType)
+	if name == "" {
+		return nil, false
+	}
+
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	if codec, ok := codecs[name]; ok {
+		return codec, true
+	} else if strings.HasSuffix(name, "+json") {
+		return codecs[ContentTypeJson], true
+	} else if strings.HasSuffix(name, "+xml") {
+		return codecs[ContentTypeXml], true
+	}
+	return nil, false
+}
+
+func mediaType(contentType string) string {
+	if name, _, err := mime.ParseMediaType(contentType); err == nil {
+		return name
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JsonCodec is the codec of application/json, it is used when a content type does not have a codec
+type JsonCodec struct{}
+
+func (c JsonCodec) Encode(v interface{}) ([]byte, error) {
+	s, err := serialization.Stringify(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func (c JsonCodec) Decode(data []byte, v interface{}) error {
+	return serialization.JsonBytesToObject(data, v)
+}
+
+// FormCodec is the codec of application/x-www-form-urlencoded. It encodes url.Values or any map with string keys (a
+// slice value gives repeated fields), and decodes into *url.Values, *MultivaluedMap, *map[string][]string,
+// *map[string]string or *map[string]interface{}.
+type FormCodec struct{}
+
+func (c FormCodec) Encode(v interface{}) ([]byte, error) {
+	values := url.Values{}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, errors.New("form codec expects a map with string keys, got %T", v)
+	}
+	for _, key := range rv.MapKeys() {
+		value := reflect.Indirect(rv.MapIndex(key))
+		if value.Kind() == reflect.Interface {
+			value = reflect.Indirect(value.Elem())
+		}
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < value.Len(); i++ {
+				values.Add(key.String(), fmt.Sprint(value.Index(i).Interface()))
+			}
+		} else if value.IsValid() {
+			values.Add(key.String(), fmt.Sprint(value.Interface()))
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (c FormCodec) Decode(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch out := v.(type) {
+	case *url.Values:
+		*out = values
+	case *map[string][]string:
+		*out = values
+	case *MultivaluedMap:
+		*out = MultivaluedMap(values)
+	case *map[string]string:
+		*out = map[string]string{}
+		for key := range values {
+			(*out)[key] = values.Get(key)
+		}
+	case *map[string]interface{}:
+		*out = map[string]interface{}{}
+		for key := range values {
+			(*out)[key] = values.Get(key)
+		}
+	default:
+		return errors.New("form codec cannot decode into %T", v)
+	}
+	return nil
+}
+
+// XmlCodec is the codec of application/xml and text/xml
+type XmlCodec struct{}
+
+func (c XmlCodec) Encode(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (c XmlCodec) Decode(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// ProtobufCodec is the codec of application/x-protobuf, values must be proto messages. It can also decode into a
+// pointer to a nil message pointer (e.g. the response type of ExecuteHttp is *pb.User).
+type ProtobufCodec struct{}
+
+func (c ProtobufCodec) Encode(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return nil, errors.New("protobuf codec expects a proto.Message, got %T", v)
+}
+
+func (c ProtobufCodec) Decode(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return errors.New("protobuf codec expects a proto.Message, got %T", v)
+}
+
+// MsgpackCodec is the codec of application/msgpack, structs use the "codec" or "json" tags of their fields
+type MsgpackCodec struct{}
+
+var msgpackHandle = func() *msgpack.MsgpackHandle {
+	h := &msgpack.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.TypeInfos = msgpack.NewTypeInfos([]string{"codec", "json"})
+	return h
+}()
+
+func (c MsgpackCodec) Encode(v interface{}) ([]byte, error) {
+	var b []byte
+	err := msgpack.NewEncoderBytes(&b, msgpackHandle).Encode(v)
+	return b, err
+}
+
+func (c MsgpackCodec) Decode(data []byte, v interface{}) error {
+	return msgpack.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+// TextCodec is the codec of text/plain. It encodes string, []byte and fmt.Stringer as text, and decodes into *string
+// or *[]byte. Other values are encoded and decoded as json, as many servers send json with text/plain.
+type TextCodec struct{}
+
+func (c TextCodec) Encode(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case fmt.Stringer:
+		return []byte(value.String()), nil
+	default:
+		return JsonCodec{}.Encode(v)
+	}
+}
+
+func (c TextCodec) Decode(data []byte, v interface{}) error {
+	switch out := v.(type) {
+	case *string:
+		*out = string(data)
+	case *[]byte:
+		*out = append([]byte(nil), data...)
+	default:
+		return serialization.JsonBytesToObject(data, v)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type codecTestUser struct {
+	Id   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+func TestGetCodec(t *testing.T) {
+	codec, ok := GetCodec("application/xml; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, XmlCodec{}, codec)
+
+	codec, ok = GetCodec("application/problem+json")
+	assert.True(t, ok)
+	assert.Equal(t, JsonCodec{}, codec)
+
+	_, ok = GetCodec("application/vnd.custom")
+	assert.False(t, ok)
+	RegisterCodec("Application/Vnd.Custom", TextCodec{})
+	codec, ok = GetCodec("application/vnd.custom")
+	assert.True(t, ok)
+	assert.Equal(t, TextCodec{}, codec)
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	user := codecTestUser{Id: 1, Name: "a"}
+
+	for _, codec := range []Codec{JsonCodec{}, XmlCodec{}, MsgpackCodec{}} {
+		data, err := codec.Encode(user)
+		assert.NoError(t, err)
+		var out codecTestUser
+		assert.NoError(t, codec.Decode(data, &out))
+		assert.Equal(t, user, out, "codec=%T", codec)
+	}
+
+	data, err := FormCodec{}.Encode(map[string]interface{}{"name": "a b", "tag": []string{"x", "y"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "name=a+b&tag=x&tag=y", string(data))
+	var values url.Values
+	assert.NoError(t, FormCodec{}.Decode(data, &values))
+	assert.Equal(t, []string{"x", "y"}, values["tag"])
+	_, err = FormCodec{}.Encode(user)
+	assert.Error(t, err)
+
+	data, err = ProtobufCodec{}.Encode(wrapperspb.String("hello"))
+	assert.NoError(t, err)
+	var message *wrapperspb.StringValue
+	assert.NoError(t, ProtobufCodec{}.Decode(data, &message))
+	assert.Equal(t, "hello", message.GetValue())
+	_, err = ProtobufCodec{}.Encode(user)
+	assert.Error(t, err)
+
+	data, err = TextCodec{}.Encode(42)
+	assert.NoError(t, err)
+	var text string
+	assert.NoError(t, TextCodec{}.Decode(data, &text))
+	assert.Equal(t, "42", text)
+
+	// Other values are json, as in Decode
+	data, err = TextCodec{}.Encode(user)
+	assert.NoError(t, err)
+	var decoded codecTestUser
+	assert.NoError(t, TextCodec{}.Decode(data, &decoded))
+	assert.Equal(t, user, decoded)
+	data, err = TextCodec{}.Encode(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "1s", string(data))
+}
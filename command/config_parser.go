@@ -36,9 +36,14 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			var _host = serialization.ParameterizedValue(valueMap.StringOrDefault("host", "localhost"))
 			var _https = serialization.ParameterizedValue(valueMap.StringOrDefault("https", "false"))
 			var _port = serialization.ParameterizedValue(valueMap.StringOrDefault("port", "80"))
-			var _connectTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("connect_timeout", "50"))
+			var _connectTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("connect_timeout", "30000"))
 			var _enableHttpConnectionTracing = serialization.ParameterizedValue(valueMap.StringOrDefault("enable_http_connection_tracing", "false"))
-			var connectionRequestTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("connection_request_timeout", "50"))
+			var connectionRequestTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("connection_request_timeout", "0"))
+			var _tlsHandshakeTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("tls_handshake_timeout", "10000"))
+			var _responseHeaderTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("response_header_timeout", "0"))
+			var _maxIdleConnectionsPerHost = serialization.ParameterizedValue(valueMap.StringOrDefault("max_idle_connections_per_host", "100"))
+			var _maxConnectionsPerHost = serialization.ParameterizedValue(valueMap.StringOrDefault("max_connections_per_host", "0"))
+			var _idleConnectionTimeout = serialization.ParameterizedValue(valueMap.StringOrDefault("idle_connection_timeout", "90000"))
 			var _skipCertVerify = serialization.ParameterizedValue(valueMap.StringOrDefault("skip_cert_verify", "false"))
 			var _ProxyUrl = serialization.ParameterizedValue(valueMap.StringOrDefault("proxy_url", ""))
 
@@ -57,6 +62,21 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			if s.ConnectionRequestTimeout, err = connectionRequestTimeout.GetInt(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing connection_request_timeout property for server=%s", name)
 			}
+			if s.TlsHandshakeTimeout, err = _tlsHandshakeTimeout.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing tls_handshake_timeout property for server=%s", name)
+			}
+			if s.ResponseHeaderTimeout, err = _responseHeaderTimeout.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing response_header_timeout property for server=%s", name)
+			}
+			if s.MaxIdleConnectionsPerHost, err = _maxIdleConnectionsPerHost.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing max_idle_connections_per_host property for server=%s", name)
+			}
+			if s.MaxConnectionsPerHost, err = _maxConnectionsPerHost.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing max_connections_per_host property for server=%s", name)
+			}
+			if s.IdleConnectionTimeout, err = _idleConnectionTimeout.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing idle_connection_timeout property for server=%s", name)
+			}
 			if m, ok := valueMap["properties"]; ok {
 				if _m, ok := m.(map[string]interface{}); ok {
 					s.Properties = _m
@@ -82,6 +102,67 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			if s.ProxyUrl, err = _ProxyUrl.GetString(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing proxy_url property for server=%s", name)
 			}
+			if m, ok := valueMap["tls"].(map[string]interface{}); ok {
+				s.Tls = &TlsConfig{}
+				if err := populateFromMap(m, s.Tls, "tls", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["retry_budget"].(map[string]interface{}); ok {
+				s.RetryBudget = NewDefaultRetryBudgetConfig()
+				if err := populateFromMap(m, s.RetryBudget, "retry_budget", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["circuit_breaker"].(map[string]interface{}); ok {
+				s.CircuitBreaker = &CircuitBreakerConfig{}
+				if err := populateFromMap(m, s.CircuitBreaker, "circuit_breaker", "server="+name); err != nil {
+					return err
+				}
+			}
+			if list, ok := valueMap["endpoints"].([]interface{}); ok {
+				for i, item := range list {
+					m, ok := item.(map[string]interface{})
+					if !ok {
+						return errors.New("expected endpoint to be type of map for server=%s, index=%d", name, i)
+					}
+					endpoint := &Endpoint{}
+					if err := populateFromMap(m, endpoint, "endpoints", "server="+name); err != nil {
+						return err
+					}
+					s.Endpoints = append(s.Endpoints, endpoint)
+				}
+			}
+			if m, ok := valueMap["load_balancer"].(map[string]interface{}); ok {
+				s.LoadBalancer = NewDefaultLoadBalancerConfig()
+				if err := populateFromMap(m, s.LoadBalancer, "load_balancer", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["discovery"].(map[string]interface{}); ok {
+				s.Discovery = NewDefaultDiscoveryConfig()
+				if err := populateFromMap(m, s.Discovery, "discovery", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["outlier_detection"].(map[string]interface{}); ok {
+				s.OutlierDetection = NewDefaultOutlierDetectionConfig()
+				if err := populateFromMap(m, s.OutlierDetection, "outlier_detection", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["health_check"].(map[string]interface{}); ok {
+				s.HealthCheck = NewDefaultHealthCheckConfig()
+				if err := populateFromMap(m, s.HealthCheck, "health_check", "server="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["rate_limit"].(map[string]interface{}); ok {
+				s.RateLimit = NewDefaultRateLimitConfig()
+				if err := populateFromMap(m, s.RateLimit, "rate_limit", "server="+name); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -97,18 +178,23 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 			var valueMap gox.StringObjectMap = values.(map[string]interface{})
 			a.Method = valueMap.StringOrDefault("method", "GET")
+			a.RequestCodec = valueMap.StringOrDefault("request_codec", "")
+			a.ResponseCodec = valueMap.StringOrDefault("response_codec", "")
 			var path = serialization.ParameterizedValue(valueMap.StringOrDefault("path", "/"))
 			var server = serialization.ParameterizedValue(valueMap.StringOrEmpty("server"))
 			var timeout = serialization.ParameterizedValue(valueMap.StringOrDefault("timeout", "100"))
 			var concurrency = serialization.ParameterizedValue(valueMap.StringOrDefault("concurrency", "1"))
 			var queue_size = serialization.ParameterizedValue(valueMap.StringOrDefault("queue_size", "10"))
 			var async = serialization.ParameterizedValue(valueMap.StringOrDefault("async", "false"))
+			var async_queue_size = serialization.ParameterizedValue(valueMap.StringOrDefault("async_queue_size", "10"))
 			var acceptable_codes = serialization.ParameterizedValue(valueMap.StringOrDefault("acceptable_codes", "200,201"))
 			var retry_count = serialization.ParameterizedValue(valueMap.StringOrDefault("retry_count", "0"))
 			var retry_initial_wait_time_ms = serialization.ParameterizedValue(valueMap.StringOrDefault("retry_initial_wait_time_ms", "1"))
 			var enable_request_response = serialization.ParameterizedValue(valueMap.StringOrDefault("enable_request_response_logging", "false"))
 			var _enableHttpConnectionTracing = serialization.ParameterizedValue(valueMap.StringOrDefault("enable_http_connection_tracing", "false"))
 			var _enable_hystrix = serialization.ParameterizedValue(valueMap.StringOrDefault("disable_hystrix", "false"))
+			var coalesce = serialization.ParameterizedValue(valueMap.StringOrDefault("coalesce", "false"))
+			var maxResponseBytes = serialization.ParameterizedValue(valueMap.StringOrDefault("max_response_bytes", "0"))
 
 			if a.Path, err = path.GetString(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing path property for api=%s", name)
@@ -122,12 +208,18 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			if a.Concurrency, err = concurrency.GetInt(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing concurrency property for api=%s", name)
 			}
+			if _, ok := valueMap["queue_size"]; !ok {
+				a.queueSizeDefault = true
+			}
 			if a.QueueSize, err = queue_size.GetInt(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing queue_size property for api=%s", name)
 			}
 			if a.Async, err = async.GetBool(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing async property for api=%s", name)
 			}
+			if a.AsyncQueueSize, err = async_queue_size.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing async_queue_size property for api=%s", name)
+			}
 			if a.AcceptableCodes, err = acceptable_codes.GetString(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing acceptable_codes property for api=%s", name)
 			}
@@ -137,6 +229,54 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			if a.InitialRetryWaitTimeMs, err = retry_initial_wait_time_ms.GetInt(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing retry_initial_wait_time_ms property for api=%s", name)
 			}
+			if m, ok := valueMap["adaptive_concurrency"].(map[string]interface{}); ok {
+				a.AdaptiveConcurrency = NewDefaultAdaptiveConcurrencyConfig()
+				if err := populateFromMap(m, a.AdaptiveConcurrency, "adaptive_concurrency", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["retry"].(map[string]interface{}); ok {
+				a.Retry = NewDefaultRetryConfig()
+				if err := populateFromMap(m, a.Retry, "retry", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["retry_budget"].(map[string]interface{}); ok {
+				a.RetryBudget = NewDefaultRetryBudgetConfig()
+				if err := populateFromMap(m, a.RetryBudget, "retry_budget", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["circuit_breaker"].(map[string]interface{}); ok {
+				a.CircuitBreaker = &CircuitBreakerConfig{}
+				if err := populateFromMap(m, a.CircuitBreaker, "circuit_breaker", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["hedging"].(map[string]interface{}); ok {
+				a.Hedging = NewDefaultHedgingConfig()
+				if err := populateFromMap(m, a.Hedging, "hedging", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["rate_limit"].(map[string]interface{}); ok {
+				a.RateLimit = NewDefaultRateLimitConfig()
+				if err := populateFromMap(m, a.RateLimit, "rate_limit", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["cache"].(map[string]interface{}); ok {
+				a.Cache = NewDefaultCacheConfig()
+				if err := populateFromMap(m, a.Cache, "cache", "api="+name); err != nil {
+					return err
+				}
+			}
+			if m, ok := valueMap["fallback"].(map[string]interface{}); ok {
+				a.Fallback = NewDefaultFallbackConfig()
+				if err := populateFromMap(m, a.Fallback, "fallback", "api="+name); err != nil {
+					return err
+				}
+			}
 			if m, ok := valueMap["interceptor_config"].(map[string]interface{}); ok {
 				a.InterceptorConfig = &interceptor.Config{}
 				if err := a.InterceptorConfig.PopulateFromMap(m, "api="+name); err != nil {
@@ -152,8 +292,33 @@ func (e *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			if a.DisableHystrix, err = _enable_hystrix.GetBool(e.Env); err != nil {
 				return errors.Wrap(err, "error is parsing disable_hystrix property for api=%s", name)
 			}
+			if a.Coalesce, err = coalesce.GetBool(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing coalesce property for api=%s", name)
+			}
+			if a.MaxResponseBytes, err = maxResponseBytes.GetInt(e.Env); err != nil {
+				return errors.Wrap(err, "error is parsing max_response_bytes property for api=%s", name)
+			}
+			if list, ok := valueMap["coalesce_key_headers"].([]interface{}); ok {
+				for _, item := range list {
+					header, ok := item.(string)
+					if !ok {
+						return errors.New("expected coalesce_key_headers to be list of string for api=%s", name)
+					}
+					a.CoalesceKeyHeaders = append(a.CoalesceKeyHeaders, header)
+				}
+			}
 		}
 	}
 
 	return nil
 }
+
+// populateFromMap fills a nested config block (e.g. tls) from the parsed yaml map
+func populateFromMap(input map[string]interface{}, out interface{}, property string, debugString string) error {
+	if str, err := serialization.Stringify(input); err != nil {
+		return errors.Wrap(err, "error is stringfy %s property: info=%s", property, debugString)
+	} else if err := serialization.JsonBytesToObject([]byte(str), out); err != nil {
+		return errors.Wrap(err, "error is parsing %s property: info=%s", property, debugString)
+	}
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 
 const ErrorCodeFailedToBuildRequest = "failed_to_build_request"
 const ErrorCodeFailedToRequestServer = "failed_to_request_server"
+const ErrorCodeRequestQueueFull = "request_queue_full"
+const ErrorCodeRetryBudgetExhausted = "retry_budget_exhausted"
+const ErrorCodeRateLimited = "rate_limited"
+const ErrorCodeResponseTooLarge = "response_too_large"
 
 // Gox Http Module error
 // Err 			- underlying error thrown by http or lib
@@ -125,6 +129,30 @@ func (e *GoxHttpError) IsHystrixRejectedError() bool {
 	return e.ErrorCode == "hystrix_rejected"
 }
 
+// Indicates that this error was caused because all concurrency slots were busy and the wait queue
+// (queue_size) of this api was also full
+func (e *GoxHttpError) IsRequestQueueFullError() bool {
+	return e.ErrorCode == ErrorCodeRequestQueueFull
+}
+
+// Indicates that the request failed and it was not retried because the retry budget of the api (or its server) is
+// used up. Err has the error of the last attempt
+func (e *GoxHttpError) IsRetryBudgetExhaustedError() bool {
+	return e.ErrorCode == ErrorCodeRetryBudgetExhausted
+}
+
+// Indicates that the request was not sent because the client side rate limit (rate_limit) of the api or its server
+// is used up - either in reject mode, or in wait mode when a token is not available before the deadline
+func (e *GoxHttpError) IsRateLimitedError() bool {
+	return e.ErrorCode == ErrorCodeRateLimited
+}
+
+// Indicates that the response body from server is larger than max_response_bytes of the api, the body is not read
+// beyond this limit
+func (e *GoxHttpError) IsResponseTooLargeError() bool {
+	return e.ErrorCode == ErrorCodeResponseTooLarge
+}
+
 // Indicates that this error was caused due to hystrix issue (timeout/circuit open/rejected)
 func (e *GoxHttpError) IsHystrixError() bool {
 	return e.IsHystrixTimeoutError() || e.IsHystrixCircuitOpenError() || e.IsHystrixRejectedError()
@@ -0,0 +1,128 @@
+package httpCommand
+
+import (
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"math"
+	"net/http"
+	"time"
+)
+
+// adaptiveLimit finds the in-flight limit of an api from the latency and errors of its requests (in the style of
+// Netflix concurrency-limits). It has no lock of its own, all methods are called with the admission queue lock held.
+type adaptiveLimit struct {
+	algorithm string
+	minLimit  float64
+	maxLimit  float64
+	limit     float64
+
+	// used by aimd
+	backoffRatio     float64
+	latencyThreshold time.Duration
+
+	// used by gradient - longRtt is the long term average latency (in ns)
+	smoothing    float64
+	rttTolerance float64
+	longRtt      float64
+}
+
+// longRttWindow is the number of samples in the long term average latency of gradient
+const longRttWindow = 600
+
+func newAdaptiveLimit(api *command.Api) (*adaptiveLimit, error) {
+	config := api.AdaptiveConcurrency
+	if config == nil {
+		return nil, nil
+	}
+	switch config.Algorithm {
+	case command.AdaptiveConcurrencyGradient, command.AdaptiveConcurrencyAimd:
+	default:
+		return nil, errors.New("invalid adaptive_concurrency algorithm=%s for api=%s (expected gradient or aimd)", config.Algorithm, api.Name)
+	}
+	maxLimit := float64(max(1, api.Concurrency))
+	minLimit := min(maxLimit, float64(max(1, config.MinLimit)))
+	limit := maxLimit
+	if config.InitialLimit > 0 {
+		limit = max(minLimit, min(maxLimit, float64(config.InitialLimit)))
+	}
+	return &adaptiveLimit{
+		algorithm:        config.Algorithm,
+		minLimit:         minLimit,
+		maxLimit:         maxLimit,
+		limit:            limit,
+		backoffRatio:     config.BackoffRatio,
+		latencyThreshold: time.Duration(config.LatencyThresholdMs) * time.Millisecond,
+		smoothing:        config.Smoothing,
+		rttTolerance:     config.RttTolerance,
+	}, nil
+}
+
+// update adjusts the limit with a completed request, and gives the new limit. inFlight is the number of requests in
+// flight when this request completed (including itself). dropped is true for a timeout or an overload response.
+func (a *adaptiveLimit) update(latency time.Duration, inFlight int, dropped bool) int {
+	if a.algorithm == command.AdaptiveConcurrencyAimd {
+		a.updateAimd(latency, inFlight, dropped)
+	} else {
+		a.updateGradient(latency, inFlight, dropped)
+	}
+	a.limit = max(a.minLimit, min(a.maxLimit, a.limit))
+	return a.current()
+}
+
+func (a *adaptiveLimit) current() int {
+	return int(a.limit)
+}
+
+// updateAimd increases the limit by 1 for a good request, and reduces it by backoff ratio for a timeout, overload or
+// slow request. The limit is increased only if it was used, otherwise an idle api would grow it without any proof.
+func (a *adaptiveLimit) updateAimd(latency time.Duration, inFlight int, dropped bool) {
+	if dropped || (a.latencyThreshold > 0 && latency > a.latencyThreshold) {
+		a.limit *= a.backoffRatio
+	} else if float64(inFlight)*2 >= a.limit {
+		a.limit++
+	}
+}
+
+// updateGradient compares the latency with the long term average. If latency grows (queueing in the server), the limit
+// goes down in proportion, otherwise it grows by sqrt(limit). The new limit is smoothed with the old one.
+func (a *adaptiveLimit) updateGradient(latency time.Duration, inFlight int, dropped bool) {
+	rtt := float64(latency)
+	if rtt <= 0 {
+		return
+	}
+	if a.longRtt == 0 {
+		a.longRtt = rtt
+	} else {
+		a.longRtt += (rtt - a.longRtt) / longRttWindow
+	}
+
+	// Long term average follows a drop of latency faster, so that an old slow period does not keep the limit high
+	if a.longRtt/rtt > 2 {
+		a.longRtt *= 0.95
+	}
+
+	// Not enough load to say anything about the limit
+	if !dropped && float64(inFlight)*2 < a.limit {
+		return
+	}
+
+	gradient := 0.5
+	if !dropped {
+		gradient = max(0.5, min(1, a.rttTolerance*a.longRtt/rtt))
+	}
+	newLimit := a.limit*gradient + math.Sqrt(a.limit)
+	a.limit = a.limit*(1-a.smoothing) + newLimit*a.smoothing
+}
+
+// isOverload checks if a completed request shows that the server (or the network) is overloaded - a timeout, or a
+// 429/503 response
+func isOverload(response *command.GoxResponse, err error) bool {
+	if response != nil && (response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable) {
+		return true
+	}
+	var e *command.GoxHttpError
+	if errors.As(err, &e) {
+		return e.ErrorCode == "request_timeout_on_client"
+	}
+	return false
+}
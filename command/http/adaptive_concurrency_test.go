@@ -0,0 +1,96 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newAdaptiveTestApi(algorithm string, concurrency int, initialLimit int) *command.Api {
+	config := command.NewDefaultAdaptiveConcurrencyConfig()
+	config.Algorithm = algorithm
+	config.InitialLimit = initialLimit
+	return &command.Api{Name: "api", Concurrency: concurrency, QueueSize: 10, AdaptiveConcurrency: config}
+}
+
+func TestAdaptiveLimit_Aimd(t *testing.T) {
+	limit, err := newAdaptiveLimit(newAdaptiveTestApi(command.AdaptiveConcurrencyAimd, 20, 10))
+	assert.NoError(t, err)
+
+	// Limit grows only when it is used
+	assert.Equal(t, 10, limit.update(10*time.Millisecond, 2, false))
+	assert.Equal(t, 11, limit.update(10*time.Millisecond, 8, false))
+
+	// Timeout or overload reduces it
+	assert.Equal(t, 9, limit.update(10*time.Millisecond, 8, true))
+
+	// It stays between min limit and concurrency
+	for i := 0; i < 100; i++ {
+		limit.update(10*time.Millisecond, 20, false)
+	}
+	assert.Equal(t, 20, limit.current())
+	for i := 0; i < 100; i++ {
+		limit.update(10*time.Millisecond, 20, true)
+	}
+	assert.Equal(t, 1, limit.current())
+}
+
+func TestAdaptiveLimit_Gradient(t *testing.T) {
+	limit, err := newAdaptiveLimit(newAdaptiveTestApi(command.AdaptiveConcurrencyGradient, 100, 20))
+	assert.NoError(t, err)
+
+	// Stable latency under load - limit grows
+	for i := 0; i < 20; i++ {
+		limit.update(10*time.Millisecond, limit.current(), false)
+	}
+	grown := limit.current()
+	assert.True(t, grown > 20)
+
+	// Latency goes up a lot (server is queueing) - limit goes down
+	for i := 0; i < 20; i++ {
+		limit.update(100*time.Millisecond, limit.current(), false)
+	}
+	assert.True(t, limit.current() < grown)
+
+	_, err = newAdaptiveLimit(newAdaptiveTestApi("bad", 10, 0))
+	assert.Error(t, err)
+}
+
+func TestAdmissionQueue_AdaptiveLimit(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	q, err := newAdmissionQueue(cf, &command.Server{Name: "testServer"}, newAdaptiveTestApi(command.AdaptiveConcurrencyAimd, 10, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, q.limit)
+
+	// Second request waits as the limit is 1
+	assert.NoError(t, q.acquire(context.Background()))
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- q.acquire(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A good request raises the limit, and the waiting request gets the new slot
+	q.record(10*time.Millisecond, false)
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "waiting request did not get the new slot")
+	}
+	assert.Equal(t, 2, q.limit)
+	q.release()
+	q.release()
+	assert.Equal(t, 0, q.inFlight)
+}
+
+func TestIsOverload(t *testing.T) {
+	assert.True(t, isOverload(&command.GoxResponse{StatusCode: http.StatusTooManyRequests}, nil))
+	assert.True(t, isOverload(nil, &command.GoxHttpError{ErrorCode: "request_timeout_on_client"}))
+	assert.False(t, isOverload(&command.GoxResponse{StatusCode: http.StatusOK}, nil))
+	assert.False(t, isOverload(nil, &command.GoxHttpError{ErrorCode: "request_failed_on_client"}))
+}
@@ -0,0 +1,282 @@
+package httpCommand
+
+import (
+	"container/list"
+	"context"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errRequestQueueFull = errors.New("request queue is full")
+
+// admissionQueue limits the number of in-flight requests of an api to "limit". Requests above the limit wait (in
+// FIFO order) for a free slot, but at most "queueSize" requests can wait at a time. A waiting request gives up when
+// its context is done.
+//
+// With adaptive concurrency, the limit is changed (up to the concurrency of the api) by the latency and errors of
+// completed requests.
+//
+// An api has an admission queue only if queue_size or adaptive_concurrency is set. Methods which do not wait (record,
+// tryAcquire, release) are safe to call on nil.
+type admissionQueue struct {
+	gox.CrossFunction
+	lock       *sync.Mutex
+	limit      int
+	queueSize  int
+	inFlight   int
+	waiters    *list.List
+	adaptive   *adaptiveLimit
+	serverName string
+	apiName    string
+}
+
+func newAdmissionQueue(cf gox.CrossFunction, server *command.Server, api *command.Api) (*admissionQueue, error) {
+	if !api.HasWaitQueue() && api.AdaptiveConcurrency == nil {
+		return nil, nil
+	}
+	limit := api.Concurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	queueSize := api.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	adaptive, err := newAdaptiveLimit(api)
+	if err != nil {
+		return nil, err
+	} else if adaptive != nil {
+		limit = adaptive.current()
+	}
+	return &admissionQueue{
+		CrossFunction: cf,
+		lock:          &sync.Mutex{},
+		limit:         limit,
+		queueSize:     queueSize,
+		waiters:       list.New(),
+		adaptive:      adaptive,
+		serverName:    server.Name,
+		apiName:       api.Name,
+	}, nil
+}
+
+// concurrencyLimiter is the in-flight limit of an api - its admission queue, or its inFlightLimit if it has no queue.
+// Hedged attempts take extra slots from it, and completed requests are recorded in it (for adaptive concurrency).
+type concurrencyLimiter interface {
+	tryAcquire() bool
+	release()
+	record(latency time.Duration, dropped bool)
+}
+
+// inFlightLimit limits the in-flight requests of an api which has no admission queue to the concurrency of the api -
+// requests above the limit are not queued. All methods are safe to call on nil (no limit).
+type inFlightLimit struct {
+	lock     *sync.Mutex
+	limit    int
+	inFlight int
+}
+
+// newInFlightLimit gives the in-flight limit of an api, it is nil if the api has an admission queue (which limits
+// the in-flight requests itself)
+func newInFlightLimit(api *command.Api, admission *admissionQueue) *inFlightLimit {
+	if admission != nil {
+		return nil
+	}
+	limit := api.Concurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	return &inFlightLimit{lock: &sync.Mutex{}, limit: limit}
+}
+
+// tryAcquire takes a slot if one is free, it never waits. The caller must call release() if it returned true.
+func (l *inFlightLimit) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.inFlight < l.limit {
+		l.inFlight++
+		return true
+	}
+	return false
+}
+
+// hold takes a slot even if none is free - it is used by requests which are limited elsewhere (by hystrix, or not at all
+// with hystrix disabled), so that they are counted for hedged attempts. The caller must call release().
+func (l *inFlightLimit) hold() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.inFlight++
+}
+
+// release frees the slot taken by tryAcquire() or hold()
+func (l *inFlightLimit) release() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.inFlight--
+}
+
+// record is a no-op, the in-flight limit is not adaptive
+func (l *inFlightLimit) record(latency time.Duration, dropped bool) {
+}
+
+// takeOverInFlightLimit moves the in-flight limit of the underlying http command to the command in front of it (breaker
+// command), it is always replaced - with nil if the new command has none
+func takeOverInFlightLimit(cmd command.Command, inFlight *atomic.Pointer[inFlightLimit]) {
+	var l *inFlightLimit
+	if hc, ok := cmd.(*HttpCommand); ok {
+		l, hc.inFlight = hc.inFlight, nil
+	}
+	inFlight.Store(l)
+}
+
+// takeOverAdmission moves the admission queue of the underlying http command to the command in front of it (hystrix or
+// breaker command), so that requests wait in the queue before they reach the circuit breaker. The admission queue is
+// always replaced - with nil if the new command has none (e.g. queue_size is removed on reload).
+func takeOverAdmission(cmd command.Command, admission *atomic.Pointer[admissionQueue]) {
+	var q *admissionQueue
+	if hc, ok := cmd.(*HttpCommand); ok {
+		q, hc.admission = hc.admission, nil
+	}
+	admission.Store(q)
+}
+
+// acquire takes a slot to run a request. It waits in the queue if all slots are busy. The caller must call release()
+// once the request is completed, if (and only if) acquire returned no error.
+func (q *admissionQueue) acquire(ctx context.Context) error {
+	q.lock.Lock()
+
+	// Fast path - we have a free slot and nobody is waiting before us
+	if q.inFlight < q.limit && q.waiters.Len() == 0 {
+		q.inFlight++
+		q.lock.Unlock()
+		return nil
+	}
+
+	// Queue is full - reject this request
+	if q.waiters.Len() >= q.queueSize {
+		q.lock.Unlock()
+		return &command.GoxHttpError{
+			Err:        errRequestQueueFull,
+			StatusCode: http.StatusBadRequest,
+			Message:    "request rejected - all concurrency slots are in use and the wait queue is full",
+			ErrorCode:  command.ErrorCodeRequestQueueFull,
+		}
+	}
+
+	// Wait for a slot - release() will hand over its slot by closing this channel
+	ch := make(chan struct{})
+	e := q.waiters.PushBack(ch)
+	q.reportDepth(q.waiters.Len())
+	q.lock.Unlock()
+
+	start := time.Now()
+	defer q.reportWaitTime(start)
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		q.lock.Lock()
+		select {
+		case <-ch:
+			// We got the slot at the same time our context was done - give it back
+			q.lock.Unlock()
+			q.release()
+		default:
+			q.waiters.Remove(e)
+			q.reportDepth(q.waiters.Len())
+			q.lock.Unlock()
+		}
+		return &command.GoxHttpError{
+			Err:        ctx.Err(),
+			StatusCode: http.StatusRequestTimeout,
+			Message:    "request timeout on client while waiting in queue",
+			ErrorCode:  "request_timeout_on_client",
+		}
+	}
+}
+
+// tryAcquire takes a slot only if one is free and nobody is waiting for it, it never waits. The caller must call
+// release() if it returned true.
+func (q *admissionQueue) tryAcquire() bool {
+	if q == nil {
+		return true
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.inFlight < q.limit && q.waiters.Len() == 0 {
+		q.inFlight++
+		return true
+	}
+	return false
+}
+
+// release frees the slot taken by acquire(). If a request is waiting then the slot is handed over to it.
+func (q *admissionQueue) release() {
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.inFlight <= q.limit && q.waiters.Len() > 0 {
+		e := q.waiters.Front()
+		q.waiters.Remove(e)
+		q.reportDepth(q.waiters.Len())
+		close(e.Value.(chan struct{}))
+	} else {
+		q.inFlight--
+	}
+}
+
+// record updates the adaptive limit with a completed request (no-op without adaptive concurrency). It must be called
+// before release() of the request. If the limit goes up then waiting requests get the new slots.
+func (q *admissionQueue) record(latency time.Duration, dropped bool) {
+	if q == nil || q.adaptive == nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	limit := q.adaptive.update(latency, q.inFlight, dropped)
+	if limit == q.limit {
+		return
+	}
+	q.limit = limit
+	for q.inFlight < q.limit && q.waiters.Len() > 0 {
+		e := q.waiters.Front()
+		q.waiters.Remove(e)
+		q.inFlight++
+		close(e.Value.(chan struct{}))
+	}
+	q.reportDepth(q.waiters.Len())
+	if EnableGoxHttpMetricLogging {
+		q.Metric().Tagged(map[string]string{"server": q.serverName, "api": q.apiName}).Gauge("gox_http_concurrency_limit").Update(float64(limit))
+	}
+}
+
+func (q *admissionQueue) reportDepth(depth int) {
+	if EnableGoxHttpMetricLogging {
+		q.Metric().Tagged(map[string]string{"server": q.serverName, "api": q.apiName}).Gauge("gox_http_queue_depth").Update(float64(depth))
+	}
+}
+
+func (q *admissionQueue) reportWaitTime(start time.Time) {
+	if EnableGoxHttpMetricLogging {
+		q.Metric().Tagged(map[string]string{"server": q.serverName, "api": q.apiName}).Timer("gox_http_queue_wait_time").Record(time.Since(start))
+	}
+}
@@ -0,0 +1,140 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdmissionQueue_WaitsAndRejectsWhenQueueIsFull(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	q, _ := newAdmissionQueue(cf, &command.Server{Name: "testServer"}, &command.Api{Name: "api", Concurrency: 1, QueueSize: 1})
+
+	// First request takes the only slot
+	assert.NoError(t, q.acquire(context.Background()))
+
+	// Second request waits in queue
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- q.acquire(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Third request is rejected because queue is full
+	err := q.acquire(context.Background())
+	var goxErr *command.GoxHttpError
+	assert.True(t, errors.As(err, &goxErr))
+	assert.True(t, goxErr.IsRequestQueueFullError())
+	assert.False(t, goxErr.IsHystrixRejectedError())
+
+	// Releasing the slot hands it over to the waiting request
+	q.release()
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "waiting request did not get the slot")
+	}
+	q.release()
+	assert.Equal(t, 0, q.inFlight)
+}
+
+func TestAdmissionQueue_OnlyWithQueueSize(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{Apis: command.Apis{
+		"withQueue":    &command.Api{Concurrency: 1, QueueSize: 2},
+		"withoutQueue": &command.Api{Concurrency: 1},
+	}}
+	config.SetupDefaults()
+
+	q, err := newAdmissionQueue(cf, &command.Server{Name: "testServer"}, config.Apis["withQueue"])
+	assert.NoError(t, err)
+	assert.NotNil(t, q)
+
+	// Without queue_size the api is not limited here (hystrix limits concurrency, if it is enabled)
+	q, err = newAdmissionQueue(cf, &command.Server{Name: "testServer"}, config.Apis["withoutQueue"])
+	assert.NoError(t, err)
+	assert.Nil(t, q)
+	assert.True(t, q.tryAcquire())
+	q.release()
+}
+
+func TestAdmissionQueue_WaitIsBoundedByContext(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	q, _ := newAdmissionQueue(cf, &command.Server{Name: "testServer"}, &command.Api{Name: "api", Concurrency: 1, QueueSize: 10})
+	assert.NoError(t, q.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := q.acquire(ctx)
+	var goxErr *command.GoxHttpError
+	assert.True(t, errors.As(err, &goxErr))
+	assert.True(t, goxErr.IsRequestTimeout())
+	assert.Equal(t, 0, q.waiters.Len())
+
+	q.release()
+	assert.Equal(t, 0, q.inFlight)
+}
+
+func TestAdmissionQueue_RemovedOnUpdateCommand(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	for _, breakerType := range []string{"hystrix", "native"} {
+		config := command.Config{
+			Servers: command.Servers{"testServer": &command.Server{}},
+			Apis: command.Apis{
+				"admissionUpdate_" + breakerType: &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 5, QueueSize: 2,
+					CircuitBreaker: &command.CircuitBreakerConfig{Type: breakerType},
+				},
+			},
+		}
+		config.UpdateServerWithUrl("testServer", ts.URL)
+		config.SetupDefaults()
+		api := config.Apis["admissionUpdate_"+breakerType]
+
+		runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+		assert.NoError(t, err)
+		cmd, err := NewCommandWithRuntime(cf, runtime, api)
+		assert.NoError(t, err)
+		admission := func() *admissionQueue {
+			switch c := cmd.(type) {
+			case *HttpHystrixCommand:
+				return c.admission.Load()
+			case *HttpBreakerCommand:
+				return c.admission.Load()
+			}
+			return nil
+		}
+		assert.NotNil(t, admission())
+
+		// Reload without queue_size while requests are running - old queue must not stay in front of the breaker
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					_, _ = cmd.Execute(context.Background(), &command.GoxRequest{})
+				}
+			}()
+		}
+		reloaded := command.Config{Servers: config.Servers, Apis: command.Apis{api.Name: &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 5}}}
+		reloaded.SetupDefaults()
+		hc, err := NewHttpCommandWithRuntime(cf, runtime, reloaded.Apis[api.Name])
+		assert.NoError(t, err)
+		cmd.(interface{ UpdateCommand(command.Command) }).UpdateCommand(hc)
+		wg.Wait()
+		assert.Nil(t, admission())
+	}
+}
@@ -0,0 +1,17 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-http/v4/command"
+)
+
+// executeAsync runs the command in a new goroutine and delivers the result on the returned channel. The channel is
+// buffered, so the goroutine never blocks (and leaks) even if nobody reads the result e.g. after the caller's context
+// is cancelled.
+func executeAsync(ctx context.Context, cmd command.Command, request *command.GoxRequest) chan *command.GoxResponse {
+	responseChannel := make(chan *command.GoxResponse, 1)
+	go func() {
+		responseChannel <- command.NewGoxResponseFromResult(cmd.Execute(ctx, request))
+	}()
+	return responseChannel
+}
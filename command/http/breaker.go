@@ -0,0 +1,263 @@
+package httpCommand
+
+import (
+	"fmt"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a Breaker when it does not allow a call (circuit is open, or it is half-open and all
+// probe calls are already in progress)
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitEvent is sent to CircuitListener when the circuit breaker of an api changes its state. Api is empty if the
+// circuit breaker is shared by all APIs of the server (scope server).
+type CircuitEvent struct {
+	Api    string
+	Server string
+	From   CircuitState
+	To     CircuitState
+	Reason string
+	Time   time.Time
+}
+
+// CircuitListener is called on every state change of a circuit breaker. It is called in the goroutine of the request
+// which caused the change, so it should not block.
+type CircuitListener func(event CircuitEvent)
+
+// CircuitStateProvider is implemented by commands which have a circuit breaker
+type CircuitStateProvider interface {
+	CircuitState() CircuitState
+}
+
+// BreakerOutcome is the outcome of a call which is given to a Breaker
+type BreakerOutcome int
+
+const (
+	BreakerSuccess BreakerOutcome = iota
+	BreakerFailure
+
+	// BreakerIgnore is a call which tells nothing about the backend (e.g. cancelled by the caller, or rejected by the
+	// client side rate limit). It is not counted, and a half-open probe permit taken by it is given back.
+	BreakerIgnore
+)
+
+// Breaker is a circuit breaker. Allow must be called before every call - if it returns no error then the call can be
+// made, and the returned done func must be called with the outcome of the call.
+type Breaker interface {
+	Allow() (done func(outcome BreakerOutcome), err error)
+	State() CircuitState
+}
+
+// slidingWindowBreaker is a Breaker which keeps success/failure counts in a rolling time window of buckets.
+//
+// closed    - all calls are allowed. Circuit opens if window has at least request_volume_threshold calls, and the error
+// percentage is at least error_percent_threshold
+// open      - all calls are rejected for sleep_window_ms, then circuit goes to half-open
+// half-open - only half_open_probes calls are allowed. If all of them succeed the circuit closes, if any of them fails
+// the circuit opens again
+type slidingWindowBreaker struct {
+	name                   string
+	errorPercentThreshold  int
+	requestVolumeThreshold int
+	sleepWindow            time.Duration
+	halfOpenProbes         int
+
+	lock           *sync.Mutex
+	state          CircuitState
+	generation     int64
+	openedAt       time.Time
+	probesStarted  int
+	probeSuccesses int
+
+	bucketDuration time.Duration
+	buckets        []breakerBucket
+
+	listeners []func(from CircuitState, to CircuitState, reason string)
+}
+
+// stateChange is a state change which is to be sent to listeners (after releasing the lock)
+type stateChange struct {
+	from   CircuitState
+	to     CircuitState
+	reason string
+}
+
+type breakerBucket struct {
+	epoch    int64
+	success  int
+	failures int
+}
+
+func newSlidingWindowBreaker(name string, config *command.CircuitBreakerConfig) *slidingWindowBreaker {
+	windowMs := config.WindowMs
+	if windowMs <= 0 {
+		windowMs = 10000
+	}
+	halfOpenProbes := config.HalfOpenProbes
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = 1
+	}
+	return &slidingWindowBreaker{
+		name:                   name,
+		errorPercentThreshold:  config.ErrorPercentThreshold,
+		requestVolumeThreshold: config.RequestVolumeThreshold,
+		sleepWindow:            time.Duration(config.SleepWindowMs) * time.Millisecond,
+		halfOpenProbes:         halfOpenProbes,
+		lock:                   &sync.Mutex{},
+		state:                  CircuitClosed,
+		bucketDuration:         time.Duration(windowMs) * time.Millisecond / 10,
+		buckets:                make([]breakerBucket, 10),
+	}
+}
+
+func (b *slidingWindowBreaker) Allow() (func(outcome BreakerOutcome), error) {
+	done, change, err := b.allow()
+	b.notify(change)
+	return done, err
+}
+
+func (b *slidingWindowBreaker) allow() (func(outcome BreakerOutcome), *stateChange, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.sleepWindow {
+			return nil, nil, ErrCircuitOpen
+		}
+		change := b.setState(CircuitHalfOpen, "sleep window is over")
+		b.probesStarted = 1
+		return b.doneFunc(b.generation), change, nil
+
+	case CircuitHalfOpen:
+		if b.probesStarted >= b.halfOpenProbes {
+			return nil, nil, ErrCircuitOpen
+		}
+		b.probesStarted++
+		return b.doneFunc(b.generation), nil, nil
+	}
+	return b.doneFunc(b.generation), nil, nil
+}
+
+func (b *slidingWindowBreaker) State() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+// addListener registers a func which is called on every state change
+func (b *slidingWindowBreaker) addListener(listener func(from CircuitState, to CircuitState, reason string)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+func (b *slidingWindowBreaker) notify(change *stateChange) {
+	if change == nil {
+		return
+	}
+	b.lock.Lock()
+	listeners := b.listeners
+	b.lock.Unlock()
+	for _, listener := range listeners {
+		listener(change.from, change.to, change.reason)
+	}
+}
+
+func (b *slidingWindowBreaker) doneFunc(generation int64) func(outcome BreakerOutcome) {
+	once := &sync.Once{}
+	return func(outcome BreakerOutcome) {
+		once.Do(func() { b.notify(b.record(generation, outcome)) })
+	}
+}
+
+// record the outcome of a call - outcome of calls started before the last state change are ignored
+func (b *slidingWindowBreaker) record(generation int64, outcome BreakerOutcome) *stateChange {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if generation != b.generation {
+		return nil
+	}
+
+	if outcome == BreakerIgnore {
+		if b.state == CircuitHalfOpen && b.probesStarted > 0 {
+			b.probesStarted--
+		}
+		return nil
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		bucket := b.currentBucket()
+		if outcome == BreakerSuccess {
+			bucket.success++
+			return nil
+		}
+		bucket.failures++
+		total, failures := b.counts()
+		if total >= b.requestVolumeThreshold && failures*100 >= b.errorPercentThreshold*total {
+			return b.setState(CircuitOpen, fmt.Sprintf("error percentage %d%% with %d requests is over threshold %d%%", failures*100/total, total, b.errorPercentThreshold))
+		}
+
+	case CircuitHalfOpen:
+		if outcome != BreakerSuccess {
+			return b.setState(CircuitOpen, "probe call failed in half-open state")
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.halfOpenProbes {
+			return b.setState(CircuitClosed, fmt.Sprintf("%d probe calls succeeded in half-open state", b.probeSuccesses))
+		}
+	}
+	return nil
+}
+
+// setState moves the breaker to a new state. Must be called with lock held.
+func (b *slidingWindowBreaker) setState(state CircuitState, reason string) *stateChange {
+	change := &stateChange{from: b.state, to: state, reason: reason}
+	b.state = state
+	b.generation++
+	b.probesStarted = 0
+	b.probeSuccesses = 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = time.Now()
+	case CircuitClosed:
+		b.buckets = make([]breakerBucket, len(b.buckets))
+	}
+	return change
+}
+
+// currentBucket gives the bucket for current time, it is reset if it has data of an older window
+func (b *slidingWindowBreaker) currentBucket() *breakerBucket {
+	epoch := time.Now().UnixNano() / int64(b.bucketDuration)
+	bucket := &b.buckets[epoch%int64(len(b.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	return bucket
+}
+
+// counts gives total calls and failures in the window
+func (b *slidingWindowBreaker) counts() (int, int) {
+	oldest := time.Now().UnixNano()/int64(b.bucketDuration) - int64(len(b.buckets)) + 1
+	total, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if bucket.epoch >= oldest {
+			total += bucket.success + bucket.failures
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
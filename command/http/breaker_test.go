@@ -0,0 +1,347 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowBreaker(t *testing.T) {
+	breaker := newSlidingWindowBreaker("api", &command.CircuitBreakerConfig{
+		ErrorPercentThreshold:  50,
+		RequestVolumeThreshold: 4,
+		SleepWindowMs:          50,
+		WindowMs:               10000,
+		HalfOpenProbes:         2,
+	})
+
+	call := func(success bool) error {
+		done, err := breaker.Allow()
+		if err == nil {
+			done(outcomeOf(success))
+		}
+		return err
+	}
+
+	// Not enough requests to open the circuit
+	assert.NoError(t, call(false))
+	assert.NoError(t, call(false))
+	assert.NoError(t, call(true))
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// 3 of 4 failed - circuit opens
+	assert.NoError(t, call(false))
+	assert.Equal(t, CircuitOpen, breaker.State())
+	assert.Equal(t, ErrCircuitOpen, call(true))
+
+	// After sleep window only 2 probes are allowed
+	time.Sleep(60 * time.Millisecond)
+	firstProbe, err := breaker.Allow()
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	secondProbe, err := breaker.Allow()
+	assert.NoError(t, err)
+	_, err = breaker.Allow()
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// Failed probe opens the circuit again
+	firstProbe(BreakerFailure)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// Outcome of a call from older state is ignored
+	secondProbe(BreakerSuccess)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// All probes succeed - circuit closes
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, call(true))
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	assert.NoError(t, call(true))
+	assert.Equal(t, CircuitClosed, breaker.State())
+	assert.NoError(t, call(true))
+}
+
+func outcomeOf(success bool) BreakerOutcome {
+	if success {
+		return BreakerSuccess
+	}
+	return BreakerFailure
+}
+
+func TestSlidingWindowBreaker_IgnoredOutcome(t *testing.T) {
+	breaker := newSlidingWindowBreaker("api", &command.CircuitBreakerConfig{
+		ErrorPercentThreshold:  50,
+		RequestVolumeThreshold: 2,
+		SleepWindowMs:          20,
+		WindowMs:               10000,
+	})
+
+	// Ignored calls are not counted - they do not lower the error percentage
+	for i := 0; i < 5; i++ {
+		done, _ := breaker.Allow()
+		done(BreakerIgnore)
+	}
+	for i := 0; i < 2; i++ {
+		done, _ := breaker.Allow()
+		done(BreakerFailure)
+	}
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// Ignored probe does not close the circuit, and gives back its permit
+	time.Sleep(30 * time.Millisecond)
+	done, err := breaker.Allow()
+	assert.NoError(t, err)
+	done(BreakerIgnore)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	done, err = breaker.Allow()
+	assert.NoError(t, err)
+	done(BreakerSuccess)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestHttpBreakerCommand(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var fail, count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 5,
+			CircuitBreaker: &command.CircuitBreakerConfig{Type: "native", RequestVolumeThreshold: 3, ErrorPercentThreshold: 50, SleepWindowMs: 100},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	cmd, err := NewCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.NoError(t, err)
+	assert.IsType(t, &HttpBreakerCommand{}, cmd)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// Backend fails - circuit opens and calls do not reach the backend
+	atomic.StoreInt32(&fail, 1)
+	for i := 0; i < 3; i++ {
+		_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cmd.(*HttpBreakerCommand).Breaker().State())
+
+	atomic.StoreInt32(&count, 0)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.True(t, err.(*command.GoxHttpError).IsHystrixCircuitOpenError())
+	assert.True(t, err.(*command.GoxHttpError).IsHystrixError())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+
+	// Backend recovers - probe closes the circuit
+	atomic.StoreInt32(&fail, 0)
+	time.Sleep(120 * time.Millisecond)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cmd.(*HttpBreakerCommand).Breaker().State())
+}
+
+func TestHttpBreakerCommand_RateLimitedProbe(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	// 3 tokens are used by the failures which open the circuit, the next token comes after 1 sec
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 5,
+			CircuitBreaker: &command.CircuitBreakerConfig{Type: "native", RequestVolumeThreshold: 3, ErrorPercentThreshold: 50, SleepWindowMs: 50},
+			RateLimit:      &command.RateLimitConfig{Rps: 1, Burst: 3, Mode: command.RateLimitModeReject},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpBreakerCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cmd.(*HttpBreakerCommand).Breaker().State())
+
+	// Rate limited probe does not close the circuit, and the next call can be a probe again
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.True(t, err.(*command.GoxHttpError).IsRateLimitedError())
+		assert.Equal(t, CircuitHalfOpen, cmd.(*HttpBreakerCommand).Breaker().State())
+	}
+}
+
+func TestHttpBreakerCommand_Timeout(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000,
+			CircuitBreaker: &command.CircuitBreakerConfig{Type: "native", TimeoutMs: 50},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpBreakerCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.True(t, err.(*command.GoxHttpError).IsHystrixTimeoutError())
+}
+
+func TestNewCommandWithRuntime_InvalidBreakerType(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", CircuitBreaker: &command.CircuitBreakerConfig{Type: "resilience4j"}}},
+	}
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	_, err = NewCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.Error(t, err)
+}
+
+func TestSlidingWindowBreaker_Listener(t *testing.T) {
+	breaker := newSlidingWindowBreaker("api", &command.CircuitBreakerConfig{
+		ErrorPercentThreshold:  50,
+		RequestVolumeThreshold: 2,
+		SleepWindowMs:          20,
+		WindowMs:               10000,
+		HalfOpenProbes:         1,
+	})
+
+	var changes []CircuitState
+	breaker.addListener(func(from CircuitState, to CircuitState, reason string) {
+		assert.NotEmpty(t, reason)
+		changes = append(changes, to)
+	})
+
+	call := func(success bool) {
+		if done, err := breaker.Allow(); err == nil {
+			done(outcomeOf(success))
+		}
+	}
+	call(false)
+	call(false)
+	time.Sleep(30 * time.Millisecond)
+	call(true)
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+}
+
+func TestHttpBreakerCommand_MaxConcurrency(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 2,
+			CircuitBreaker: &command.CircuitBreakerConfig{Type: "native"},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpBreakerCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	// Both slots are busy - next call is rejected at once like hystrix does
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+			results <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsHystrixRejectedError())
+	assert.True(t, goxErr.IsHystrixError())
+
+	// Slots are free once the calls complete
+	close(release)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-results)
+	}
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cmd.(*HttpBreakerCommand).Breaker().State())
+}
+
+func TestHttpBreakerCommand_CallerDeadlineIsFailure(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 5,
+			CircuitBreaker: &command.CircuitBreakerConfig{Type: "native", RequestVolumeThreshold: 3, ErrorPercentThreshold: 50, SleepWindowMs: 10000},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpBreakerCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	// Slow backend runs out of the caller's deadline - it opens the circuit
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = cmd.Execute(ctx, &command.GoxRequest{})
+		cancel()
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cmd.(*HttpBreakerCommand).Breaker().State())
+
+	// Cancelled call is not counted
+	cmd, err = NewHttpBreakerCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = cmd.Execute(ctx, &command.GoxRequest{})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitClosed, cmd.(*HttpBreakerCommand).Breaker().State())
+}
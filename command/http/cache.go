@@ -0,0 +1,362 @@
+package httpCommand
+
+import (
+	"container/list"
+	"context"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewLruCache gives the built-in in-memory cache, which keeps up to maxEntries responses and drops the least recently
+// used one when it is full
+func NewLruCache(maxEntries int) command.Cache {
+	if maxEntries <= 0 {
+		maxEntries = command.NewDefaultCacheConfig().MaxEntries
+	}
+	return &lruCache{lock: &sync.Mutex{}, maxEntries: maxEntries, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+type lruCache struct {
+	lock       *sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type lruEntry struct {
+	key      string
+	response *command.CachedResponse
+}
+
+func (c *lruCache) Get(key string) (*command.CachedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*lruEntry).response, true
+	}
+	return nil, false
+}
+
+func (c *lruCache) Set(key string, response *command.CachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).response = response
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+type cacheRevalidationContextKey struct{}
+
+// cacheLookedUpContextKey is set (to the cache) once the request was looked up in the cache by the command which wraps
+// the http command, so that the http command does not look it up (and count a miss) again
+type cacheLookedUpContextKey struct{}
+
+// responseCache serves the responses of a GET api from cache, as per the http cache headers of the responses. All
+// methods are safe to call on nil (cache not configured).
+type responseCache struct {
+	gox.CrossFunction
+	store      command.Cache
+	config     *command.CacheConfig
+	serverName string
+	apiName    string
+
+	// revalidating are the keys which are being revalidated in background (stale-while-revalidate)
+	lock         *sync.Mutex
+	revalidating map[string]bool
+}
+
+func newResponseCache(cf gox.CrossFunction, server *command.Server, api *command.Api) (*responseCache, error) {
+	if api.Cache == nil {
+		return nil, nil
+	}
+	if method := strings.ToUpper(api.Method); method != http.MethodGet && method != http.MethodHead {
+		return nil, errors.New("cache is supported only for GET and HEAD apis: api=%s, method=%s", api.Name, api.Method)
+	}
+	store := api.Cache.Store
+	if store == nil {
+		store = NewLruCache(api.Cache.MaxEntries)
+	}
+	return &responseCache{
+		CrossFunction: cf,
+		store:         store,
+		config:        api.Cache,
+		serverName:    server.Name,
+		apiName:       api.Name,
+		lock:          &sync.Mutex{},
+		revalidating:  map[string]bool{},
+	}, nil
+}
+
+// serve gives the response from cache if it is fresh, or if it is stale but within stale-while-revalidate (in this
+// case it is revalidated in background with execute). It returns false if the request must go to the server.
+func (c *responseCache) serve(ctx context.Context, request *command.GoxRequest, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) (*command.GoxResponse, bool) {
+	if c == nil || ctx.Value(cacheRevalidationContextKey{}) != nil || ctx.Value(cacheLookedUpContextKey{}) == c {
+		return nil, false
+	}
+	if directives := cacheControl(request.Header); directives.has("no-store") || directives.has("no-cache") {
+		return nil, false
+	}
+
+	key := c.key(request)
+	entry, ok := c.store.Get(key)
+	if !ok {
+		c.report("miss")
+		return nil, false
+	}
+	now := time.Now()
+	if now.Before(entry.FreshUntil) {
+		c.report("hit")
+		return c.response(request, entry), true
+	} else if !now.Before(entry.StaleUntil) {
+		return nil, false
+	}
+
+	c.report("stale")
+	c.lock.Lock()
+	if !c.revalidating[key] {
+		c.revalidating[key] = true
+		go func() {
+			defer func() {
+				c.lock.Lock()
+				delete(c.revalidating, key)
+				c.lock.Unlock()
+			}()
+			_, _ = execute(context.WithValue(context.WithoutCancel(ctx), cacheRevalidationContextKey{}, true), request)
+		}()
+	}
+	c.lock.Unlock()
+	return c.response(request, entry), true
+}
+
+// prepare is called before a request is sent to the server. It gives the cache key (empty if the response must not be
+// cached), the stale entry which is revalidated by this request, and the request to send - with If-None-Match and
+// If-Modified-Since headers if there is a stale entry.
+func (c *responseCache) prepare(request *command.GoxRequest) (string, *command.CachedResponse, *command.GoxRequest) {
+	if c == nil || cacheControl(request.Header).has("no-store") {
+		return "", nil, request
+	}
+	key := c.key(request)
+	entry, ok := c.store.Get(key)
+	if !ok {
+		return key, nil, request
+	}
+	etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return key, nil, request
+	}
+
+	conditional := *request
+	conditional.Header = request.Header.Clone()
+	if conditional.Header == nil {
+		conditional.Header = http.Header{}
+	}
+	if etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	return key, entry, &conditional
+}
+
+// save stores the response in cache if its headers allow it
+func (c *responseCache) save(key string, response *resty.Response) {
+	if c == nil || key == "" {
+		return
+	}
+	// Entry has its own copy of body and headers, so the caller can change its response
+	if entry, ok := c.newEntry(response.StatusCode(), append([]byte(nil), response.Body()...), response.Header().Clone(), time.Now()); ok {
+		c.store.Set(key, entry)
+	}
+}
+
+// revalidated handles the 304 (not modified) response of a revalidation - the stale entry is fresh again with the
+// headers of the new response
+func (c *responseCache) revalidated(request *command.GoxRequest, key string, stale *command.CachedResponse, response *resty.Response) *command.GoxResponse {
+	header := stale.Header.Clone()
+	for name, values := range response.Header() {
+		header[name] = values
+	}
+	entry, ok := c.newEntry(stale.StatusCode, stale.Body, header, time.Now())
+	if !ok {
+		entry = stale
+	}
+	c.store.Set(key, entry)
+	c.report("revalidated")
+	return c.response(request, entry)
+}
+
+// newEntry creates the cache entry for a response, returns false if it must not be stored
+func (c *responseCache) newEntry(statusCode int, body []byte, header http.Header, now time.Time) (*command.CachedResponse, bool) {
+	directives := cacheControl(header)
+	if directives.has("no-store") {
+		return nil, false
+	}
+
+	fresh, freshKnown := time.Duration(0), false
+	if maxAge, ok := directives.seconds("max-age"); ok {
+		fresh, freshKnown = maxAge, true
+	} else if expires := header.Get("Expires"); expires != "" {
+		freshKnown = true
+		if t, err := http.ParseTime(expires); err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			fresh = t.Sub(date)
+		}
+	} else if c.config.DefaultTtlMs > 0 {
+		fresh = time.Duration(c.config.DefaultTtlMs) * time.Millisecond
+	}
+	if age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age"))); err == nil && freshKnown {
+		fresh -= time.Duration(age) * time.Second
+	}
+	if directives.has("no-cache") || fresh < 0 {
+		fresh = 0
+	}
+
+	var stale time.Duration
+	if swr, ok := directives.seconds("stale-while-revalidate"); ok && !directives.has("must-revalidate") {
+		stale = swr
+	}
+
+	hasValidator := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	if fresh == 0 && stale == 0 && !hasValidator {
+		return nil, false
+	}
+	return &command.CachedResponse{
+		StatusCode: statusCode,
+		Body:       body,
+		Header:     header,
+		StoredAt:   now,
+		FreshUntil: now.Add(fresh),
+		StaleUntil: now.Add(fresh + stale),
+	}, true
+}
+
+// response builds the response of the caller from a cache entry, with a copy of the body and headers of the entry (the
+// entry is shared by all requests)
+func (c *responseCache) response(request *command.GoxRequest, entry *command.CachedResponse) *command.GoxResponse {
+	response := newResponseFromBody(request, entry.StatusCode, entry.Header.Clone(), append([]byte(nil), entry.Body...))
+	response.FromCache = true
+	return response
+}
+
+// newResponseFromBody builds the response of the caller from a stored body, with the response builder of the request
+func newResponseFromBody(request *command.GoxRequest, statusCode int, header http.Header, body []byte) *command.GoxResponse {
+	response := &command.GoxResponse{StatusCode: statusCode, Body: body}
+	response.Header = header
+	if request.ResponseBuilder != nil && body != nil {
+		var err error
+		if response.Response, err = request.ResponseBuilder.Response(body); err != nil {
+			response.Err = &command.GoxHttpError{
+				Err:        errors.Wrap(err, "failed to create response using response builder"),
+				StatusCode: statusCode,
+				Message:    "failed to create response using response builder",
+				ErrorCode:  "failed_to_build_response_using_response_builder",
+				Body:       body,
+			}
+		}
+	}
+	return response
+}
+
+// key builds the cache key from the path params, query params and headers of the request (as per the cache config)
+func (c *responseCache) key(request *command.GoxRequest) string {
+	values := url.Values{}
+	for name, v := range request.PathParam {
+		if len(c.config.KeyPathParams) == 0 || contains(c.config.KeyPathParams, name) {
+			values["path:"+name] = v
+		}
+	}
+	for name, v := range request.QueryParam {
+		if len(c.config.KeyQueryParams) == 0 || contains(c.config.KeyQueryParams, name) {
+			values["query:"+name] = v
+		}
+	}
+	for _, name := range c.config.KeyHeaders {
+		if v := request.Header.Values(name); len(v) > 0 {
+			values["header:"+http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	return c.apiName + "?" + values.Encode()
+}
+
+func (c *responseCache) report(result string) {
+	if EnableGoxHttpMetricLogging {
+		c.Metric().Tagged(map[string]string{"server": c.serverName, "api": c.apiName, "result": result}).Counter("gox_http_cache").Inc(1)
+	}
+}
+
+// fromCache serves the request from the response cache of a http command, it is used by the commands which wrap a
+// http command (circuit breakers) so that a cached response does not take a concurrency slot. The returned context
+// must be used to execute the request, so that the http command does not look it up again.
+func fromCache(ctx context.Context, cmd command.Command, request *command.GoxRequest, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) (context.Context, *command.GoxResponse, bool) {
+	hc, ok := cmd.(*HttpCommand)
+	if !ok || hc.cache == nil {
+		return ctx, nil, false
+	}
+	response, ok := hc.cache.serve(ctx, request, execute)
+	return context.WithValue(ctx, cacheLookedUpContextKey{}, hc.cache), response, ok
+}
+
+// isConditional is true if the request has If-None-Match or If-Modified-Since header, 304 is a valid response for it
+func isConditional(request *command.GoxRequest) bool {
+	return request != nil && (request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != "")
+}
+
+// cacheDirectives are the directives of a Cache-Control header e.g. "max-age=60, no-cache"
+type cacheDirectives map[string]string
+
+func cacheControl(header http.Header) cacheDirectives {
+	directives := cacheDirectives{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(v, "\"")
+			}
+		}
+	}
+	return directives
+}
+
+func (d cacheDirectives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+func (d cacheDirectives) seconds(name string) (time.Duration, bool) {
+	if v, ok := d[name]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCacheTestCommand(t *testing.T, serverUrl string, method string, cache *command.CacheConfig) (command.Command, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: method, Timeout: 1000, Concurrency: 2, Cache: cache}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+	return NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+}
+
+func TestHttpCommand_Cache_MaxAge(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.URL.Query().Get("id")))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCacheTestCommand(t, ts.URL, "GET", command.NewDefaultCacheConfig())
+	assert.NoError(t, err)
+
+	request := &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}}}
+	response, err := cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.False(t, response.FromCache)
+
+	response, err = cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.True(t, response.FromCache)
+	assert.Equal(t, "1", string(response.Body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Another query param is another cache key
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"2"}}})
+	assert.NoError(t, err)
+	assert.False(t, response.FromCache)
+	assert.Equal(t, "2", string(response.Body))
+
+	// no-cache in request goes to the server
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{QueryParam: request.QueryParam, Header: http.Header{"Cache-Control": []string{"no-cache"}}})
+	assert.NoError(t, err)
+	assert.False(t, response.FromCache)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Cache_ResponseIsACopy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Version", "1")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCacheTestCommand(t, ts.URL, "GET", command.NewDefaultCacheConfig())
+	assert.NoError(t, err)
+
+	// Caller changes body and headers of the response it got - from server and from cache
+	for i := 0; i < 2; i++ {
+		response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, "data", string(response.Body))
+		assert.Equal(t, "1", response.Header.Get("X-Version"))
+		copy(response.Body, "xxxx")
+		response.Header.Set("X-Version", "2")
+	}
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.True(t, response.FromCache)
+	assert.Equal(t, "data", string(response.Body))
+	assert.Equal(t, "1", response.Header.Get("X-Version"))
+}
+
+func TestHttpCommand_Cache_ETagRevalidation(t *testing.T) {
+	var calls, notModified int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCacheTestCommand(t, ts.URL, "GET", command.NewDefaultCacheConfig())
+	assert.NoError(t, err)
+
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.True(t, response.FromCache)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "data", string(response.Body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestHttpCommand_Cache_StaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCacheTestCommand(t, ts.URL, "GET", command.NewDefaultCacheConfig())
+	assert.NoError(t, err)
+
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+
+	// Stale response is given at once, and it is refreshed in background
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.True(t, response.FromCache)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestFromCache_NotLookedUpAgainByHttpCommand(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.URL.Query().Get("id")))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCacheTestCommand(t, ts.URL, "GET", command.NewDefaultCacheConfig())
+	assert.NoError(t, err)
+	cached := &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}}}
+	_, err = cmd.Execute(context.Background(), cached)
+	assert.NoError(t, err)
+
+	// A miss in the wrapping command - the http command does not look up the cache again, but stores the response
+	request := &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"2"}}}
+	ctx, _, ok := fromCache(context.Background(), cmd, request, cmd.Execute)
+	assert.False(t, ok)
+	_, ok = cmd.(*HttpCommand).cache.serve(ctx, cached, cmd.Execute)
+	assert.False(t, ok)
+
+	response, err := cmd.Execute(ctx, request)
+	assert.NoError(t, err)
+	assert.False(t, response.FromCache)
+	_, response, ok = fromCache(context.Background(), cmd, request, cmd.Execute)
+	assert.True(t, ok)
+	assert.Equal(t, "2", string(response.Body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestResponseCache_NewEntry(t *testing.T) {
+	c := &responseCache{config: &command.CacheConfig{DefaultTtlMs: 5000}}
+	now := time.Now()
+
+	entry, ok := c.newEntry(200, nil, http.Header{"Cache-Control": []string{"max-age=60, stale-while-revalidate=30"}, "Age": []string{"10"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(50*time.Second), entry.FreshUntil)
+	assert.Equal(t, now.Add(80*time.Second), entry.StaleUntil)
+
+	date := now.Truncate(time.Second)
+	entry, ok = c.newEntry(200, nil, http.Header{"Date": []string{date.UTC().Format(http.TimeFormat)}, "Expires": []string{date.Add(time.Minute).UTC().Format(http.TimeFormat)}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), entry.FreshUntil)
+
+	// Default ttl is used without cache headers
+	entry, ok = c.newEntry(200, nil, http.Header{}, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(5*time.Second), entry.FreshUntil)
+
+	_, ok = c.newEntry(200, nil, http.Header{"Cache-Control": []string{"no-store"}}, now)
+	assert.False(t, ok)
+}
+
+func TestResponseCache_KeyAndLru(t *testing.T) {
+	c := &responseCache{apiName: "api", config: &command.CacheConfig{KeyQueryParams: []string{"id"}, KeyHeaders: []string{"accept-language"}}}
+	a := c.key(&command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}, "trace": []string{"x"}}, Header: http.Header{"Accept-Language": []string{"en"}}})
+	b := c.key(&command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}, "trace": []string{"y"}}, Header: http.Header{"Accept-Language": []string{"en"}}})
+	d := c.key(&command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}}, Header: http.Header{"Accept-Language": []string{"fr"}}})
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, d)
+
+	lru := NewLruCache(2)
+	lru.Set("a", &command.CachedResponse{})
+	lru.Set("b", &command.CachedResponse{})
+	_, _ = lru.Get("a")
+	lru.Set("c", &command.CachedResponse{})
+	_, ok := lru.Get("b")
+	assert.False(t, ok)
+	_, ok = lru.Get("a")
+	assert.True(t, ok)
+
+	_, err := newCacheTestCommand(t, "http://localhost:1", "POST", command.NewDefaultCacheConfig())
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpHystrixCommand_CircuitBreakerSettings(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"cbSettingsServer": &command.Server{
+			CircuitBreaker: &command.CircuitBreakerConfig{ErrorPercentThreshold: 40, SleepWindowMs: 2000},
+		}},
+		Apis: command.Apis{"cbSettingsApi": &command.Api{Server: "cbSettingsServer", Path: "/", Timeout: 100,
+			CircuitBreaker: &command.CircuitBreakerConfig{RequestVolumeThreshold: 7, TimeoutMs: 300},
+		}},
+	}
+	config.SetupDefaults()
+
+	cmd, err := NewHttpHystrixCommand(cf, config.Servers["cbSettingsServer"], config.Apis["cbSettingsApi"])
+	assert.NoError(t, err)
+	assert.Equal(t, "cbSettingsApi", cmd.(*HttpHystrixCommand).hystrixCommandName)
+
+	settings := hystrix.GetCircuitSettings()["cbSettingsApi"]
+	assert.Equal(t, 40, settings.ErrorPercentThreshold)
+	assert.Equal(t, uint64(7), settings.RequestVolumeThreshold)
+	assert.Equal(t, 2*time.Second, settings.SleepWindow)
+	assert.Equal(t, 300*time.Millisecond, settings.Timeout)
+}
+
+func TestHttpHystrixCommand_CircuitBreakerSharedByServer(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"cbSharedServer": &command.Server{
+			CircuitBreaker: &command.CircuitBreakerConfig{Scope: "server", RequestVolumeThreshold: 5, ErrorPercentThreshold: 50},
+		}},
+		Apis: command.Apis{
+			"cbSharedFirst":  &command.Api{Server: "cbSharedServer", Path: "/", Timeout: 1000, Concurrency: 2, QueueSize: 1},
+			"cbSharedSecond": &command.Api{Server: "cbSharedServer", Path: "/", Timeout: 2000, Concurrency: 3, QueueSize: 1},
+		},
+	}
+	config.UpdateServerWithUrl("cbSharedServer", ts.URL)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["cbSharedServer"])
+	assert.NoError(t, err)
+	first, err := NewHttpHystrixCommandWithRuntime(cf, runtime, config.Apis["cbSharedFirst"])
+	assert.NoError(t, err)
+	second, err := NewHttpHystrixCommandWithRuntime(cf, runtime, config.Apis["cbSharedSecond"])
+	assert.NoError(t, err)
+
+	// Shared command allows sum of concurrency and max timeout of both apis
+	settings := hystrix.GetCircuitSettings()["server__cbSharedServer"]
+	assert.Equal(t, 7, settings.MaxConcurrentRequests)
+	assert.Equal(t, 2200*time.Millisecond, settings.Timeout)
+
+	// Failures of first api open the circuit for second api too
+	for i := 0; i < 10; i++ {
+		_, _ = first.Execute(context.Background(), &command.GoxRequest{})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = second.Execute(context.Background(), &command.GoxRequest{})
+	if e, ok := err.(*command.GoxHttpError); ok {
+		assert.True(t, e.IsHystrixCircuitOpenError())
+	} else {
+		assert.Fail(t, "expected GoxHttpError error")
+	}
+}
+
+func TestHttpHystrixCommand_InvalidCircuitBreakerScope(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"server": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "server", Path: "/", CircuitBreaker: &command.CircuitBreakerConfig{Scope: "host"}}},
+	}
+	config.SetupDefaults()
+
+	_, err := NewHttpHystrixCommand(cf, config.Servers["server"], config.Apis["api"])
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package httpCommand
+
+import (
+	"context"
+	"fmt"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type coalescedContextKey struct{}
+
+// coalescer shares one upstream call between concurrent identical requests of a GET api (singleflight). The shared
+// call is not bound to the context of any single caller - it is cancelled when all callers are gone, or at its own
+// deadline (timeout of the api with retries). It gets only those values of the caller's context which are sent as
+// headers (mdc and request scope headers), and requests with different values are not coalesced.
+//
+// All methods are safe to call on nil (coalescing not enabled), in this case every request is executed on its own.
+type coalescer struct {
+	gox.CrossFunction
+	server *command.Server
+	api    *command.Api
+
+	lock  *sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is an upstream call which is shared by "waiters" callers
+type coalescedCall struct {
+	done     chan struct{}
+	response *command.GoxResponse
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+func newCoalescer(cf gox.CrossFunction, server *command.Server, api *command.Api) (*coalescer, error) {
+	if !api.Coalesce {
+		return nil, nil
+	}
+	if method := strings.ToUpper(api.Method); method != http.MethodGet && method != http.MethodHead {
+		return nil, errors.New("coalesce is supported only for GET and HEAD apis: api=%s, method=%s", api.Name, api.Method)
+	}
+	return &coalescer{CrossFunction: cf, server: server, api: api, lock: &sync.Mutex{}, calls: map[string]*coalescedCall{}}, nil
+}
+
+// do runs execute for the request, or waits for the same request which is already in flight. Every caller gets its
+// own copy of the response.
+func (c *coalescer) do(ctx context.Context, request *command.GoxRequest, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) (*command.GoxResponse, error) {
+	if c == nil || ctx.Value(coalescedContextKey{}) != nil || request.Body != nil || len(request.Multipart) > 0 {
+		return execute(ctx, request)
+	}
+
+	values := c.contextValues(ctx)
+	key := c.key(request) + contextValuesKey(values)
+	c.lock.Lock()
+	call, ok := c.calls[key]
+	if ok {
+		call.waiters++
+		c.lock.Unlock()
+		c.report()
+	} else {
+		callCtx, cancel := c.callContext(values)
+		if cache := ctx.Value(cacheLookedUpContextKey{}); cache != nil {
+			// Already looked up in the cache by the caller
+			callCtx = context.WithValue(callCtx, cacheLookedUpContextKey{}, cache)
+		}
+		call = &coalescedCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.calls[key] = call
+		c.lock.Unlock()
+
+		go func() {
+			defer cancel()
+			call.response, call.err = execute(callCtx, request)
+			c.forget(key, call)
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+		return copyCoalescedResponse(request, call.response, call.err)
+	case <-ctx.Done():
+		// Shared call is cancelled only if nobody else waits for it
+		c.lock.Lock()
+		call.waiters--
+		abandoned := call.waiters == 0
+		c.lock.Unlock()
+		if abandoned {
+			c.forget(key, call)
+			call.cancel()
+		}
+		return nil, &command.GoxHttpError{
+			Err:        ctx.Err(),
+			StatusCode: http.StatusRequestTimeout,
+			Message:    "request timeout on client while waiting for coalesced request",
+			ErrorCode:  "request_timeout_on_client",
+		}
+	}
+}
+
+// callContext gives the context of a shared call - it has the deadline of the api (timeout with retries), and only
+// the context values which are sent as headers (no span, logger fields, deadline etc. of the caller)
+func (c *coalescer) callContext(values map[string]interface{}) (context.Context, context.CancelFunc) {
+	callCtx := context.WithValue(context.Background(), coalescedContextKey{}, true)
+	for name, value := range values {
+		callCtx = context.WithValue(callCtx, name, value)
+	}
+	if timeout := c.api.GetTimeoutWithRetryIncluded(); timeout > 0 {
+		return context.WithTimeout(callCtx, time.Duration(timeout)*time.Millisecond)
+	}
+	return context.WithCancel(callCtx)
+}
+
+// contextValues gives the values of the context which buildRequest sends as headers - mdc keys of the server and
+// request scope headers
+func (c *coalescer) contextValues(ctx context.Context) map[string]interface{} {
+	values := map[string]interface{}{}
+	if mdc, ok := c.server.Properties["mdc"].(string); ok {
+		for _, name := range strings.Split(mdc, ",") {
+			if v, ok := ctx.Value(name).(string); ok {
+				values[name] = v
+			}
+		}
+	}
+	if v, ok := ctx.Value(ContextBasedHeaderPrefix).(map[string]interface{}); ok && len(v) > 0 {
+		values[ContextBasedHeaderPrefix] = v
+	}
+	return values
+}
+
+// contextValuesKey is the part of the coalescing key for the context values which are sent as headers
+func contextValuesKey(values map[string]interface{}) string {
+	var lines []string
+	for name, value := range values {
+		if headers, ok := value.(map[string]interface{}); ok {
+			for k, v := range headers {
+				lines = append(lines, "\nscope:"+http.CanonicalHeaderKey(k)+": "+fmt.Sprintf("%v", v))
+			}
+		} else {
+			lines = append(lines, "\nmdc:"+name+": "+fmt.Sprintf("%v", value))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+// forget removes the call, so that a new request starts a new call
+func (c *coalescer) forget(key string, call *coalescedCall) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+}
+
+// key is the method, resolved url (path and query params) and the selected headers of the request
+func (c *coalescer) key(request *command.GoxRequest) string {
+	return requestKey(c.api, request, c.api.CoalesceKeyHeaders)
+}
+
+// requestKey identifies a request of an api by its method, resolved url (path and query params) and the given headers
+func requestKey(api *command.Api, request *command.GoxRequest, headers []string) string {
+	path := api.Path
+	for name, values := range request.PathParam {
+		if len(values) > 0 {
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(values[0]))
+		}
+	}
+	query := url.Values{}
+	for name, values := range request.QueryParam {
+		query[name] = values
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(api.Method) + " " + path + "?" + query.Encode())
+	headers = append([]string{}, headers...)
+	sort.Strings(headers)
+	for _, name := range headers {
+		b.WriteString("\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(request.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func (c *coalescer) report() {
+	if EnableGoxHttpMetricLogging {
+		c.Metric().Tagged(map[string]string{"server": c.server.Name, "api": c.api.Name}).Counter("gox_http_coalesced").Inc(1)
+	}
+}
+
+// copyCoalescedResponse gives a caller its own copy of the shared response. The response object is built again with
+// the response builder of the caller.
+func copyCoalescedResponse(request *command.GoxRequest, response *command.GoxResponse, err error) (*command.GoxResponse, error) {
+	if response == nil {
+		return nil, copyGoxError(err)
+	}
+
+	copied := *response
+	copied.Body = append([]byte(nil), response.Body...)
+	copied.Header = response.Header.Clone()
+	copied.Trailer = response.Trailer.Clone()
+	copied.Response = nil
+	copied.Err = copyGoxError(response.Err)
+	if response.Err == err {
+		err = copied.Err
+	} else {
+		err = copyGoxError(err)
+	}
+
+	if copied.Err == nil && request.ResponseBuilder != nil && response.Body != nil {
+		var buildErr error
+		if copied.Response, buildErr = request.ResponseBuilder.Response(copied.Body); buildErr != nil {
+			copied.Err = &command.GoxHttpError{
+				Err:        errors.Wrap(buildErr, "failed to create response using response builder"),
+				StatusCode: copied.StatusCode,
+				Message:    "failed to create response using response builder",
+				ErrorCode:  "failed_to_build_response_using_response_builder",
+				Body:       copied.Body,
+			}
+			return &copied, copied.Err
+		}
+	}
+	return &copied, err
+}
+
+// copyGoxError gives a copy of the error if it is a GoxHttpError, so that callers can change it
+func copyGoxError(err error) error {
+	if goxErr, ok := err.(*command.GoxHttpError); ok {
+		e := *goxErr
+		e.Body = append([]byte(nil), goxErr.Body...)
+		return &e
+	}
+	return err
+}
+
+// coalescerOf gives the coalescer of a http command, it is used by the commands which wrap a http command (circuit
+// breakers) so that coalesced requests take a single concurrency slot
+func coalescerOf(cmd command.Command) *coalescer {
+	if hc, ok := cmd.(*HttpCommand); ok {
+		return hc.coalescer
+	}
+	return nil
+}
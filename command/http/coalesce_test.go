@@ -0,0 +1,187 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCoalesceTestCommand(t *testing.T, serverUrl string, method string) (command.Command, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/users/{id}", Method: method, Timeout: 2000, Concurrency: 10,
+			Coalesce: true, CoalesceKeyHeaders: []string{"X-Tenant"},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+	return NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+}
+
+// slowServer answers every call after 100ms with the path of the request
+func slowServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+}
+
+func TestHttpCommand_Coalesce(t *testing.T) {
+	var calls int32
+	ts := slowServer(&calls)
+	defer ts.Close()
+
+	cmd, err := newCoalesceTestCommand(t, ts.URL, "GET")
+	assert.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	responses := make([]*command.GoxResponse, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], _ = cmd.Execute(context.Background(), &command.GoxRequest{PathParam: command.MultivaluedMap{"id": []string{"1"}}})
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Every caller has its own copy
+	responses[0].Body[0] = 'x'
+	for i := 1; i < 10; i++ {
+		assert.Equal(t, "/users/1", string(responses[i].Body))
+	}
+}
+
+func TestHttpCommand_Coalesce_DifferentKey(t *testing.T) {
+	var calls int32
+	ts := slowServer(&calls)
+	defer ts.Close()
+
+	cmd, err := newCoalesceTestCommand(t, ts.URL, "GET")
+	assert.NoError(t, err)
+
+	requests := []*command.GoxRequest{
+		{PathParam: command.MultivaluedMap{"id": []string{"1"}}},
+		{PathParam: command.MultivaluedMap{"id": []string{"2"}}},
+		{PathParam: command.MultivaluedMap{"id": []string{"1"}}, Header: http.Header{"X-Tenant": []string{"a"}}},
+	}
+	wg := &sync.WaitGroup{}
+	for _, request := range requests {
+		wg.Add(1)
+		go func(request *command.GoxRequest) {
+			defer wg.Done()
+			_, err := cmd.Execute(context.Background(), request)
+			assert.NoError(t, err)
+		}(request)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Coalesce_CancelOneCaller(t *testing.T) {
+	var calls int32
+	ts := slowServer(&calls)
+	defer ts.Close()
+
+	cmd, err := newCoalesceTestCommand(t, ts.URL, "GET")
+	assert.NoError(t, err)
+	request := &command.GoxRequest{PathParam: command.MultivaluedMap{"id": []string{"1"}}}
+
+	// First caller gives up, the second one still gets the response of the shared call
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := cmd.Execute(ctx, request)
+		cancelled <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	response, err := cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/1", string(response.Body))
+
+	err = <-cancelled
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsRequestTimeout())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, err = newCoalesceTestCommand(t, ts.URL, "POST")
+	assert.Error(t, err)
+}
+
+func TestHttpCommand_Coalesce_Deadline(t *testing.T) {
+	var calls int32
+	ts := slowServer(&calls)
+	defer ts.Close()
+
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/users/{id}", Timeout: 50, Concurrency: 10, DisableHystrix: true, Coalesce: true}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	// Callers have no deadline, the shared call still ends at the timeout of the api
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cmd.Execute(context.Background(), &command.GoxRequest{PathParam: command.MultivaluedMap{"id": []string{"1"}}})
+			var goxErr *command.GoxHttpError
+			assert.ErrorAs(t, err, &goxErr)
+			assert.True(t, goxErr.IsRequestTimeout())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Coalesce_RequestScopeHeaders(t *testing.T) {
+	var calls int32
+	lock := &sync.Mutex{}
+	users := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		lock.Lock()
+		users[r.Header.Get("X-User")]++
+		lock.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(r.Header.Get("X-User")))
+	}))
+	defer ts.Close()
+
+	cmd, err := newCoalesceTestCommand(t, ts.URL, "GET")
+	assert.NoError(t, err)
+
+	// Requests with different request scope headers are not coalesced, and each one sends its own header
+	wg := &sync.WaitGroup{}
+	for _, user := range []string{"a", "a", "b"} {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), ContextBasedHeaderPrefix, map[string]interface{}{"X-User": user})
+			response, err := cmd.Execute(ctx, &command.GoxRequest{PathParam: command.MultivaluedMap{"id": []string{"1"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, user, string(response.Body))
+		}(user)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, users)
+}
@@ -0,0 +1,68 @@
+package httpCommand
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type codecTestOrder struct {
+	XMLName xml.Name `xml:"order"`
+	Id      int      `xml:"id"`
+}
+
+func newCodecTestCommand(t *testing.T, serverUrl string, requestCodec string, responseCodec string) (command.Command, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: "POST", Timeout: 1000, Concurrency: 2,
+			RequestCodec: requestCodec, ResponseCodec: responseCodec,
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+	return NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+}
+
+func TestHttpCommand_RequestCodec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Accept", r.Header.Get("Accept"))
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+
+	cmd, err := newCodecTestCommand(t, ts.URL, command.ContentTypeXml, command.ContentTypeXml)
+	assert.NoError(t, err)
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{Body: codecTestOrder{Id: 7}})
+	assert.NoError(t, err)
+	assert.Equal(t, "<order><id>7</id></order>", string(response.Body))
+	assert.Equal(t, command.ContentTypeXml, response.Header.Get("X-Content-Type"))
+	assert.Equal(t, command.ContentTypeXml, response.Header.Get("X-Accept"))
+
+	// Content type of the request is used over request_codec
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{
+		Header: http.Header{"Content-Type": []string{command.ContentTypeForm}},
+		Body:   map[string]string{"id": "7"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "id=7", string(response.Body))
+
+	// json is the default
+	cmd, err = newCodecTestCommand(t, ts.URL, "", "")
+	assert.NoError(t, err)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{Body: map[string]int{"id": 7}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": 7}`, string(response.Body))
+	assert.Equal(t, command.ContentTypeJson, response.Header.Get("X-Content-Type"))
+
+	_, err = newCodecTestCommand(t, ts.URL, "application/unknown", "")
+	assert.Error(t, err)
+}
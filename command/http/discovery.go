@@ -0,0 +1,193 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-base/v2/serialization"
+	"github.com/devlibx/gox-http/v4/command"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewResolver creates the built-in resolver (service discovery) for the discovery config of a server
+func NewResolver(server *command.Server) (command.Resolver, error) {
+	config := server.Discovery
+	switch config.Type {
+	case command.DiscoveryTypeDnsSrv, command.DiscoveryTypeDnsA:
+		if config.Name == "" {
+			return nil, errors.New("discovery name is required for type=%s in server=%s", config.Type, server.Name)
+		}
+		port := config.Port
+		if port == 0 {
+			port = server.Port
+		}
+		return &dnsResolver{name: config.Name, srv: config.Type == command.DiscoveryTypeDnsSrv, port: port, resolver: newNetResolver(config.DnsServer)}, nil
+	case command.DiscoveryTypeFile:
+		if config.File == "" {
+			return nil, errors.New("discovery file is required for type=file in server=%s", server.Name)
+		}
+		return &fileResolver{file: config.File}, nil
+	default:
+		return nil, errors.New("invalid discovery type=%s for server=%s (expected dns_srv, dns_a or file)", config.Type, server.Name)
+	}
+}
+
+// newNetResolver gives a DNS resolver which uses the given DNS server, or the system resolver if it is empty
+func newNetResolver(dnsServer string) *net.Resolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, dnsServer)
+		},
+	}
+}
+
+// dnsResolver finds endpoints with DNS SRV records (host, port and weight) or A/AAAA records (host only)
+type dnsResolver struct {
+	name     string
+	srv      bool
+	port     int
+	resolver *net.Resolver
+}
+
+func (d *dnsResolver) Resolve(ctx context.Context) ([]*command.Endpoint, error) {
+	var endpoints []*command.Endpoint
+	if d.srv {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to lookup SRV records: name=%s", d.name)
+		}
+		for _, record := range records {
+			endpoints = append(endpoints, &command.Endpoint{Host: strings.TrimSuffix(record.Target, "."), Port: int(record.Port), Weight: int(record.Weight)})
+		}
+	} else {
+		hosts, err := d.resolver.LookupHost(ctx, d.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to lookup host: name=%s", d.name)
+		}
+		for _, host := range hosts {
+			endpoints = append(endpoints, &command.Endpoint{Host: host, Port: d.port})
+		}
+	}
+	return endpoints, nil
+}
+
+// fileResolver reads endpoints from a yaml file (same format as "endpoints" of a server), so they can be changed
+// without a restart
+type fileResolver struct {
+	file string
+}
+
+func (f *fileResolver) Resolve(ctx context.Context) ([]*command.Endpoint, error) {
+	var endpoints []*command.Endpoint
+	if err := serialization.ReadYaml(f.file, &endpoints); err != nil {
+		return nil, errors.Wrap(err, "failed to read endpoints from file: file=%s", f.file)
+	}
+	return endpoints, nil
+}
+
+// endpointRefresher resolves the endpoints of a server periodically, and updates them in the load balancer. If a
+// refresh fails or finds no endpoint then the last known endpoints are kept.
+type endpointRefresher struct {
+	gox.CrossFunction
+	logger       *zap.Logger
+	serverName   string
+	resolver     command.Resolver
+	loadBalancer *loadBalancer
+	interval     time.Duration
+	timeout      time.Duration
+	startOnce    *sync.Once
+	stop         chan struct{}
+	stopOnce     *sync.Once
+}
+
+// newEndpointRefresher creates the refresher of a server with service discovery (nil otherwise). It resolves the
+// endpoints once before returning, and does not refresh them until start is called.
+func newEndpointRefresher(cf gox.CrossFunction, server *command.Server, loadBalancer *loadBalancer) (*endpointRefresher, error) {
+	resolver := server.Resolver
+	if resolver == nil && server.Discovery == nil {
+		return nil, nil
+	} else if resolver == nil {
+		var err error
+		if resolver, err = NewResolver(server); err != nil {
+			return nil, err
+		}
+	}
+
+	config := command.NewDefaultDiscoveryConfig()
+	if server.Discovery != nil && server.Discovery.RefreshIntervalMs > 0 {
+		config.RefreshIntervalMs = server.Discovery.RefreshIntervalMs
+	}
+	if server.Discovery != nil && server.Discovery.TimeoutMs > 0 {
+		config.TimeoutMs = server.Discovery.TimeoutMs
+	}
+	r := &endpointRefresher{
+		CrossFunction: cf,
+		logger:        cf.Logger().Named("goxHttp").Named("discovery").Named(server.Name),
+		serverName:    server.Name,
+		resolver:      resolver,
+		loadBalancer:  loadBalancer,
+		interval:      time.Duration(config.RefreshIntervalMs) * time.Millisecond,
+		timeout:       time.Duration(config.TimeoutMs) * time.Millisecond,
+		startOnce:     &sync.Once{},
+		stop:          make(chan struct{}),
+		stopOnce:      &sync.Once{},
+	}
+	r.refresh()
+	return r, nil
+}
+
+// start refreshes the endpoints in background until close is called
+func (r *endpointRefresher) start() {
+	if r != nil {
+		r.startOnce.Do(func() { go r.run() })
+	}
+}
+
+func (r *endpointRefresher) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *endpointRefresher) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	endpoints, err := r.resolver.Resolve(ctx)
+	if err == nil && len(endpoints) == 0 {
+		err = errors.New("no endpoint found")
+	}
+	if err == nil {
+		err = r.loadBalancer.setEndpoints(endpoints)
+	}
+	if err != nil {
+		r.logger.Warn("failed to refresh endpoints - last known endpoints are used", zap.Error(err))
+		if EnableGoxHttpMetricLogging {
+			r.Metric().Tagged(map[string]string{"server": r.serverName}).Counter("gox_http_discovery_error").Inc(1)
+		}
+		return
+	}
+	r.logger.Debug("endpoints refreshed", zap.Int("count", len(endpoints)))
+}
+
+// close stops the background refresh
+func (r *endpointRefresher) close() {
+	if r != nil {
+		r.stopOnce.Do(func() { close(r.stop) })
+	}
+}
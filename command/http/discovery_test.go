@@ -0,0 +1,169 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startFakeDnsServer runs a udp DNS server which answers SRV queries with the given records, and A queries with
+// 127.0.0.1
+func startFakeDnsServer(t *testing.T, srv []dnsmessage.SRVResource) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var request dnsmessage.Message
+			if err := request.Unpack(buf[:n]); err != nil || len(request.Questions) == 0 {
+				continue
+			}
+			question := request.Questions[0]
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: request.ID, Response: true, Authoritative: true},
+				Questions: request.Questions,
+			}
+			header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 1}
+			switch question.Type {
+			case dnsmessage.TypeSRV:
+				for i := range srv {
+					response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &srv[i]})
+				}
+			case dnsmessage.TypeA:
+				response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}})
+			}
+			if out, err := response.Pack(); err == nil {
+				_, _ = conn.WriteTo(out, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDnsResolver(t *testing.T) {
+	dnsServer := startFakeDnsServer(t, []dnsmessage.SRVResource{
+		{Target: dnsmessage.MustNewName("users-1.internal."), Port: 8080, Weight: 10},
+		{Target: dnsmessage.MustNewName("users-2.internal."), Port: 8081, Weight: 5},
+	})
+
+	resolver, err := NewResolver(&command.Server{Name: "users", Discovery: &command.DiscoveryConfig{Type: "dns_srv", Name: "_http._tcp.users.internal", DnsServer: dnsServer}})
+	assert.NoError(t, err)
+	endpoints, err := resolver.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []*command.Endpoint{{Host: "users-1.internal", Port: 8080, Weight: 10}, {Host: "users-2.internal", Port: 8081, Weight: 5}}, endpoints)
+
+	resolver, err = NewResolver(&command.Server{Name: "users", Port: 80, Discovery: &command.DiscoveryConfig{Type: "dns_a", Name: "users.internal", Port: 9090, DnsServer: dnsServer}})
+	assert.NoError(t, err)
+	endpoints, err = resolver.Resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*command.Endpoint{{Host: "127.0.0.1", Port: 9090}}, endpoints)
+
+	_, err = NewResolver(&command.Server{Name: "users", Discovery: &command.DiscoveryConfig{Type: "consul"}})
+	assert.Error(t, err)
+}
+
+func TestHttpCommand_FileDiscovery(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer second.Close()
+
+	file := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints := func(serverUrl string) {
+		u, _ := url.Parse(serverUrl)
+		err := os.WriteFile(file, []byte("- host: "+u.Hostname()+"\n  port: "+u.Port()+"\n"), 0600)
+		assert.NoError(t, err)
+	}
+	writeEndpoints(first.URL)
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{Discovery: &command.DiscoveryConfig{Type: "file", File: file, RefreshIntervalMs: 20}}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	defer runtime.Close()
+	cmd, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(response.Body))
+
+	// Endpoints are changed in the file - they are not refreshed till the runtime is started
+	writeEndpoints(second.URL)
+	time.Sleep(100 * time.Millisecond)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(response.Body))
+
+	// Requests go to the new endpoint after refresh
+	runtime.Start()
+	time.Sleep(100 * time.Millisecond)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(response.Body))
+
+	// Broken file - last known endpoints are used
+	assert.NoError(t, os.WriteFile(file, []byte("not: [valid"), 0600))
+	time.Sleep(100 * time.Millisecond)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(response.Body))
+}
+
+type staticResolver []*command.Endpoint
+
+func (s staticResolver) Resolve(ctx context.Context) ([]*command.Endpoint, error) {
+	return s, nil
+}
+
+func TestHttpCommand_CustomResolver(t *testing.T) {
+	cf, _ := test.MockCf(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(u.Port())
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{Resolver: staticResolver{{Host: u.Hostname(), Port: port}}}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	defer runtime.Close()
+	cmd, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.NoError(t, err)
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(response.Body))
+}
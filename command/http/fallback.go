@@ -0,0 +1,167 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fallbackContextKey struct{}
+
+// FallbackSetter is implemented by commands which support a FallbackFunc
+type FallbackSetter interface {
+	SetFallback(fallback command.FallbackFunc)
+}
+
+// fallback gives a response when a request of an api fails due to open circuit, timeout or 5xx - from the
+// FallbackFunc registered for the api, the last known good response, or the static response (in this order).
+//
+// All methods are safe to call on nil, in this case the result of the request is given as is.
+type fallback struct {
+	gox.CrossFunction
+	server *command.Server
+	api    *command.Api
+	config *command.FallbackConfig
+
+	lock *sync.RWMutex
+	fn   command.FallbackFunc
+
+	// lastKnownGood keeps the last successful response of each request (nil if not enabled)
+	lastKnownGood command.Cache
+}
+
+func newFallback(cf gox.CrossFunction, server *command.Server, api *command.Api) (*fallback, error) {
+	f := &fallback{CrossFunction: cf, server: server, api: api, config: api.Fallback, lock: &sync.RWMutex{}}
+	if f.config == nil {
+		f.config = command.NewDefaultFallbackConfig()
+	}
+	for _, trigger := range f.config.Triggers {
+		if trigger != command.FallbackTriggerCircuitOpen && trigger != command.FallbackTriggerTimeout && trigger != command.FallbackTrigger5xx {
+			return nil, errors.New("invalid fallback trigger=%s for api=%s (expected circuit_open, timeout or 5xx)", trigger, api.Name)
+		}
+	}
+	if f.config.LastKnownGood {
+		if method := strings.ToUpper(api.Method); method != http.MethodGet && method != http.MethodHead {
+			return nil, errors.New("fallback last_known_good is supported only for GET and HEAD apis: api=%s, method=%s", api.Name, api.Method)
+		}
+		f.lastKnownGood = NewLruCache(f.config.MaxEntries)
+	}
+	return f, nil
+}
+
+func (f *fallback) setFunc(fn command.FallbackFunc) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.fn = fn
+}
+
+func (f *fallback) getFunc() command.FallbackFunc {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.fn
+}
+
+// run executes the request, and gives the fallback response if it fails. The fallback is applied once by the
+// outermost command - a http command wrapped by a circuit breaker command does not apply it again.
+func (f *fallback) run(ctx context.Context, request *command.GoxRequest, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) (*command.GoxResponse, error) {
+	if f == nil || ctx.Value(fallbackContextKey{}) != nil {
+		return execute(ctx, request)
+	}
+
+	response, err := execute(context.WithValue(ctx, fallbackContextKey{}, true), request)
+	if err == nil {
+		f.remember(request, response)
+		return response, err
+	}
+	trigger, ok := f.trigger(response, err)
+	if !ok {
+		return response, err
+	}
+
+	if fn := f.getFunc(); fn != nil {
+		f.report(trigger, "func")
+		fallbackResponse, fallbackErr := fn(ctx, request, err)
+		if fallbackResponse != nil {
+			fallbackResponse.FromFallback = true
+		}
+		return fallbackResponse, fallbackErr
+	}
+
+	if f.lastKnownGood != nil {
+		if entry, found := f.lastKnownGood.Get(requestKey(f.api, request, nil)); found && f.isUsable(entry) {
+			f.report(trigger, "last_known_good")
+			return f.response(request, entry.StatusCode, entry.Header.Clone(), append([]byte(nil), entry.Body...))
+		}
+	}
+
+	if f.config.StaticStatusCode != 0 {
+		f.report(trigger, "static")
+		return f.response(request, f.config.StaticStatusCode, nil, []byte(f.config.StaticBody))
+	}
+	return response, err
+}
+
+// remember keeps the successful response as the last known good response of the request
+func (f *fallback) remember(request *command.GoxRequest, response *command.GoxResponse) {
+	if f.lastKnownGood == nil || response == nil || response.FromFallback || !f.api.IsHttpCodeAcceptable(response.StatusCode) {
+		return
+	}
+	f.lastKnownGood.Set(requestKey(f.api, request, nil), &command.CachedResponse{
+		StatusCode: response.StatusCode,
+		Body:       append([]byte(nil), response.Body...),
+		Header:     response.Header.Clone(),
+		StoredAt:   time.Now(),
+	})
+}
+
+// trigger gives the failure (circuit_open, timeout or 5xx) of the request, returns false if the fallback must not be
+// used for it
+func (f *fallback) trigger(response *command.GoxResponse, err error) (string, bool) {
+	var trigger string
+	var goxErr *command.GoxHttpError
+	isGoxErr := errors.As(err, &goxErr)
+	switch {
+	case isGoxErr && goxErr.IsHystrixCircuitOpenError():
+		trigger = command.FallbackTriggerCircuitOpen
+	case isGoxErr && (goxErr.IsHystrixTimeoutError() || goxErr.ErrorCode == "request_timeout_on_client"):
+		trigger = command.FallbackTriggerTimeout
+	case response != nil && response.StatusCode >= http.StatusInternalServerError:
+		trigger = command.FallbackTrigger5xx
+	case isGoxErr && goxErr.Is5xx():
+		trigger = command.FallbackTrigger5xx
+	default:
+		return "", false
+	}
+	return trigger, len(f.config.Triggers) == 0 || contains(f.config.Triggers, trigger)
+}
+
+func (f *fallback) isUsable(entry *command.CachedResponse) bool {
+	maxAge := time.Duration(f.config.LastKnownGoodMaxAgeMs) * time.Millisecond
+	return maxAge <= 0 || time.Since(entry.StoredAt) <= maxAge
+}
+
+func (f *fallback) response(request *command.GoxRequest, statusCode int, header http.Header, body []byte) (*command.GoxResponse, error) {
+	response := newResponseFromBody(request, statusCode, header, body)
+	response.FromFallback = true
+	return response, response.Err
+}
+
+func (f *fallback) report(trigger string, source string) {
+	if EnableGoxHttpMetricLogging {
+		f.Metric().Tagged(map[string]string{"server": f.server.Name, "api": f.api.Name, "trigger": trigger, "source": source}).Counter("gox_http_fallback").Inc(1)
+	}
+}
+
+// fallbackOf gives the fallback of a http command, it is used by the commands which wrap a http command (circuit
+// breakers) so that the fallback is applied to the result of the circuit breaker
+func fallbackOf(cmd command.Command) *fallback {
+	if hc, ok := cmd.(*HttpCommand); ok {
+		return hc.fallback
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newFallbackTestCommand(t *testing.T, serverUrl string, method string, fallback *command.FallbackConfig) (command.Command, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: method, Timeout: 1000, Concurrency: 2, Fallback: fallback}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+	return NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+}
+
+func TestHttpCommand_Fallback_Static(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cmd, err := newFallbackTestCommand(t, ts.URL, "GET", &command.FallbackConfig{StaticBody: `{"items": []}`})
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{ResponseBuilder: command.NewJsonToObjectResponseBuilder(&map[string]interface{}{})})
+	assert.NoError(t, err)
+	assert.True(t, response.FromFallback)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, `{"items": []}`, string(response.Body))
+	assert.NotNil(t, response.Response)
+
+	// 5xx is not a trigger, so the error is given as is
+	cmd, err = newFallbackTestCommand(t, ts.URL, "GET", &command.FallbackConfig{StaticBody: "x", Triggers: []string{command.FallbackTriggerTimeout}})
+	assert.NoError(t, err)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.False(t, response.FromFallback)
+}
+
+func TestHttpCommand_Fallback_LastKnownGood(t *testing.T) {
+	var failing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Query().Get("id")))
+	}))
+	defer ts.Close()
+
+	cmd, err := newFallbackTestCommand(t, ts.URL, "GET", &command.FallbackConfig{LastKnownGood: true, StaticBody: "static"})
+	assert.NoError(t, err)
+
+	request := &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"1"}}}
+	response, err := cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.False(t, response.FromFallback)
+
+	atomic.StoreInt32(&failing, 1)
+	response, err = cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.True(t, response.FromFallback)
+	assert.Equal(t, "1", string(response.Body))
+
+	// Request without a known good response gets the static response
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"id": []string{"2"}}})
+	assert.NoError(t, err)
+	assert.True(t, response.FromFallback)
+	assert.Equal(t, "static", string(response.Body))
+}
+
+func TestFallback_Trigger(t *testing.T) {
+	f := &fallback{config: &command.FallbackConfig{}}
+
+	trigger, ok := f.trigger(nil, &command.GoxHttpError{ErrorCode: "hystrix_circuit_open", StatusCode: http.StatusBadRequest})
+	assert.True(t, ok)
+	assert.Equal(t, command.FallbackTriggerCircuitOpen, trigger)
+
+	trigger, ok = f.trigger(nil, &command.GoxHttpError{ErrorCode: "request_timeout_on_client", StatusCode: http.StatusRequestTimeout})
+	assert.True(t, ok)
+	assert.Equal(t, command.FallbackTriggerTimeout, trigger)
+
+	trigger, ok = f.trigger(&command.GoxResponse{StatusCode: http.StatusBadGateway}, &command.GoxHttpError{StatusCode: http.StatusBadGateway})
+	assert.True(t, ok)
+	assert.Equal(t, command.FallbackTrigger5xx, trigger)
+
+	_, ok = f.trigger(&command.GoxResponse{StatusCode: http.StatusNotFound}, &command.GoxHttpError{StatusCode: http.StatusNotFound})
+	assert.False(t, ok)
+
+	_, err := newFallbackTestCommand(t, "http://localhost:1", "GET", &command.FallbackConfig{Triggers: []string{"bad"}})
+	assert.Error(t, err)
+	_, err = newFallbackTestCommand(t, "http://localhost:1", "POST", &command.FallbackConfig{LastKnownGood: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthReport is the health of all servers of a gox http context, it can be used by readiness probes
+type HealthReport struct {
+	// Healthy is true if all servers are healthy
+	Healthy bool
+	Servers map[string]*ServerHealth
+}
+
+// ServerHealth is the health of a server, it is healthy if at least one of its endpoints is healthy
+type ServerHealth struct {
+	Server    string
+	Healthy   bool
+	Endpoints []*EndpointHealth
+}
+
+// EndpointHealth is the health of one endpoint (or the host of a server without endpoints)
+type EndpointHealth struct {
+	Endpoint string
+
+	// Healthy is true if endpoint is up and not ejected
+	Healthy bool
+
+	// Up is false if health check marked this endpoint down (always true without health check)
+	Up bool
+
+	// Ejected is true if endpoint is ejected by outlier detection
+	Ejected bool
+
+	LastCheck time.Time
+	LastError string
+}
+
+// healthChecker checks the health of all endpoints of a server in background, and marks them up or down. Endpoints
+// which are down are not used by the load balancer (unless all are down).
+type healthChecker struct {
+	gox.CrossFunction
+	logger       *zap.Logger
+	server       *command.Server
+	config       *command.HealthCheckConfig
+	client       *http.Client
+	loadBalancer *loadBalancer
+
+	// lock guards the health state of endpoints - it is the load balancer lock if server has endpoints
+	lock *sync.Mutex
+
+	// single is the state of the host of a server without endpoints
+	single *endpointState
+
+	startOnce *sync.Once
+	stop      chan struct{}
+	stopOnce  *sync.Once
+}
+
+// newHealthChecker creates the health checker of a server (nil if health check is not configured). It does not run
+// until start is called.
+func newHealthChecker(cf gox.CrossFunction, server *command.Server, transport http.RoundTripper, loadBalancer *loadBalancer) *healthChecker {
+	if server.HealthCheck == nil {
+		return nil
+	}
+	h := &healthChecker{
+		CrossFunction: cf,
+		logger:        cf.Logger().Named("goxHttp").Named("healthCheck").Named(server.Name),
+		server:        server,
+		config:        server.HealthCheck,
+		client:        &http.Client{Transport: transport, Timeout: time.Duration(server.HealthCheck.TimeoutMs) * time.Millisecond},
+		loadBalancer:  loadBalancer,
+		lock:          &sync.Mutex{},
+		single:        &endpointState{endpoint: &command.Endpoint{Host: server.Host, Port: server.Port}},
+		startOnce:     &sync.Once{},
+		stop:          make(chan struct{}),
+		stopOnce:      &sync.Once{},
+	}
+	if loadBalancer != nil {
+		h.lock = loadBalancer.lock
+	}
+	return h
+}
+
+// start runs the health check in background until close is called
+func (h *healthChecker) start() {
+	if h != nil {
+		h.startOnce.Do(func() { go h.run() })
+	}
+}
+
+// close stops the health check
+func (h *healthChecker) close() {
+	if h != nil {
+		h.stopOnce.Do(func() { close(h.stop) })
+	}
+}
+
+func (h *healthChecker) run() {
+	ticker := time.NewTicker(time.Duration(h.config.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		h.checkAll()
+		select {
+		case <-ticker.C:
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// targets gives the endpoints to check
+func (h *healthChecker) targets() []*endpointState {
+	if h.loadBalancer == nil {
+		return []*endpointState{h.single}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]*endpointState{}, h.loadBalancer.endpoints...)
+}
+
+// checkAll checks all endpoints in parallel
+func (h *healthChecker) checkAll() {
+	wg := &sync.WaitGroup{}
+	for _, state := range h.targets() {
+		wg.Add(1)
+		go func(state *endpointState) {
+			defer wg.Done()
+			h.record(state, h.check(state))
+		}(state)
+	}
+	wg.Wait()
+}
+
+func (h *healthChecker) check(state *endpointState) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, h.server.GetUrlForEndpoint(state.endpoint, h.config.Path), nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	for _, code := range h.config.ExpectedCodes {
+		if response.StatusCode == code {
+			return nil
+		}
+	}
+	return errors.New("unexpected status code %d", response.StatusCode)
+}
+
+// record the result of a health check, and mark the endpoint up or down if threshold is reached
+func (h *healthChecker) record(state *endpointState, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state.lastHealthCheck = time.Now()
+	if err == nil {
+		state.lastHealthCheckError = ""
+		state.healthCheckFailures = 0
+		state.healthCheckSuccesses++
+		if state.down && state.healthCheckSuccesses >= h.config.HealthyThreshold {
+			state.down = false
+			h.logger.Info("endpoint is up", zap.String("endpoint", state.String()))
+			h.reportStateChange(state, "up")
+		}
+		return
+	}
+
+	state.lastHealthCheckError = err.Error()
+	state.healthCheckSuccesses = 0
+	state.healthCheckFailures++
+	if !state.down && state.healthCheckFailures >= h.config.UnhealthyThreshold {
+		state.down = true
+		h.logger.Warn("endpoint is down - health check failed", zap.String("endpoint", state.String()), zap.Error(err))
+		h.reportStateChange(state, "down")
+	}
+}
+
+func (h *healthChecker) reportStateChange(state *endpointState, status string) {
+	if EnableGoxHttpMetricLogging {
+		h.Metric().Tagged(map[string]string{"server": h.server.Name, "endpoint": state.String(), "status": status}).Counter("gox_http_health_check").Inc(1)
+	}
+}
+
+// Health gives the health of the server and its endpoints. A server without endpoints and health check is always
+// healthy.
+func (s *ServerRuntime) Health() *ServerHealth {
+	var states []*endpointState
+	lock := &sync.Mutex{}
+	if s.healthChecker != nil {
+		states, lock = s.healthChecker.targets(), s.healthChecker.lock
+	} else if s.loadBalancer != nil {
+		lock = s.loadBalancer.lock
+		lock.Lock()
+		states = append(states, s.loadBalancer.endpoints...)
+		lock.Unlock()
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	report := &ServerHealth{Server: s.server.Name, Healthy: len(states) == 0}
+	now := time.Now()
+	for _, state := range states {
+		endpoint := &EndpointHealth{
+			Endpoint:  state.String(),
+			Up:        !state.down,
+			Ejected:   state.isEjected(now),
+			LastCheck: state.lastHealthCheck,
+			LastError: state.lastHealthCheckError,
+		}
+		endpoint.Healthy = endpoint.Up && !endpoint.Ejected
+		report.Healthy = report.Healthy || endpoint.Healthy
+		report.Endpoints = append(report.Endpoints, endpoint)
+	}
+	return report
+}
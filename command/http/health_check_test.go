@@ -0,0 +1,116 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker_MarksEndpointDownAndUp(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var firstHealthy int32 = 1
+	var firstCalls, secondCalls int32
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			if atomic.LoadInt32(&firstHealthy) == 1 {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		atomic.AddInt32(&firstCalls, 1)
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" {
+			atomic.AddInt32(&secondCalls, 1)
+		}
+	}))
+	defer second.Close()
+
+	endpoint := func(serverUrl string) *command.Endpoint {
+		u, _ := url.Parse(serverUrl)
+		port, _ := strconv.Atoi(u.Port())
+		return &command.Endpoint{Host: u.Hostname(), Port: port}
+	}
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{
+			Endpoints:   []*command.Endpoint{endpoint(first.URL), endpoint(second.URL)},
+			HealthCheck: &command.HealthCheckConfig{Path: "/ping", IntervalMs: 10, HealthyThreshold: 1, UnhealthyThreshold: 2, ExpectedCodes: []int{200, 204}},
+		}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	runtime.Start()
+	defer runtime.Close()
+	cmd, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, runtime.Health().Healthy)
+
+	// First endpoint fails health check - it gets no requests
+	atomic.StoreInt32(&firstHealthy, 0)
+	time.Sleep(100 * time.Millisecond)
+	health := runtime.Health()
+	assert.True(t, health.Healthy)
+	assert.False(t, health.Endpoints[0].Up)
+	assert.Contains(t, health.Endpoints[0].LastError, "503")
+	assert.True(t, health.Endpoints[1].Healthy)
+
+	atomic.StoreInt32(&firstCalls, 0)
+	for i := 0; i < 4; i++ {
+		_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&firstCalls))
+
+	// First endpoint is back
+	atomic.StoreInt32(&firstHealthy, 1)
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, runtime.Health().Endpoints[0].Up)
+	for i := 0; i < 4; i++ {
+		_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&firstCalls))
+}
+
+func TestHealthChecker_ServerWithoutEndpoints(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	config := command.Config{Servers: command.Servers{"testServer": &command.Server{HealthCheck: &command.HealthCheckConfig{IntervalMs: 10, UnhealthyThreshold: 1}}}}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+
+	// Not started - nothing is checked
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, runtime.Health().Healthy)
+
+	runtime.Start()
+	time.Sleep(50 * time.Millisecond)
+	runtime.Close()
+	assert.False(t, runtime.Health().Healthy)
+	assert.Len(t, runtime.Health().Endpoints, 1)
+}
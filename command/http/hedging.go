@@ -0,0 +1,138 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// usedEndpoints are the endpoints already used by the attempts of one request, so that a hedged attempt goes to a
+// different endpoint. All methods are safe to call on nil.
+type usedEndpoints struct {
+	lock      *sync.Mutex
+	endpoints []*endpointState
+}
+
+func (u *usedEndpoints) add(endpoint *endpointState) {
+	if u == nil {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.endpoints = append(u.endpoints, endpoint)
+}
+
+func (u *usedEndpoints) list() []*endpointState {
+	if u == nil {
+		return nil
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return append([]*endpointState{}, u.endpoints...)
+}
+
+type hedgeResult struct {
+	response *resty.Response
+	err      error
+	hedged   bool
+}
+
+// sendWithHedging sends the request. If hedging is enabled for this api and the request is idempotent, then every
+// delay_ms without a response one more attempt (up to max_extra) is sent in parallel - preferably to another endpoint.
+// The first acceptable response is returned and the other attempts are cancelled. A request with multipart body, or
+// a request of ExecuteStream, is never hedged.
+//
+// Hedged attempts need a free concurrency slot of the api (from its wait queue, or its concurrency if it has no queue)
+// and a token from the rate limit, they are skipped (not queued) if these are not available at once. Like other
+// requests, hedged attempts are recorded for adaptive concurrency.
+func (h *HttpCommand) sendWithHedging(ctx context.Context, request *command.GoxRequest, r *resty.Request, rebuildRequest func(ctx context.Context) (*resty.Request, error), url string) (*resty.Response, error) {
+	hedging := h.api.Hedging
+	if hedging == nil || hedging.MaxExtra <= 0 || !isIdempotent(h.api.Method, request) || len(request.Multipart) > 0 || isStream(ctx) {
+		return h.sendToEndpoint(ctx, r, url, nil)
+	}
+
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	used := &usedEndpoints{lock: &sync.Mutex{}}
+	results := make(chan hedgeResult, 1+hedging.MaxExtra)
+	send := func(r *resty.Request, hedged bool) {
+		start := time.Now()
+		response, err := h.sendToEndpoint(hedgeCtx, r, url, used)
+		if hedged {
+			h.recordHedge(hedgeCtx, start, response, err)
+		}
+		results <- hedgeResult{response: response, err: err, hedged: hedged}
+	}
+
+	r.SetContext(hedgeCtx)
+	go send(r, false)
+
+	delay := time.Duration(hedging.DelayMs) * time.Millisecond
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	pending, extra := 1, 0
+	var last hedgeResult
+	for pending > 0 {
+		select {
+		case result := <-results:
+			pending--
+			last = result
+			if result.err == nil && result.response != nil && h.isAcceptable(request, result.response.StatusCode()) {
+				if result.hedged {
+					h.reportHedge("won")
+				}
+				return result.response, result.err
+			}
+
+		case <-timer.C:
+			if !h.limiter.tryAcquire() {
+				h.reportHedge("skipped")
+				continue
+			} else if !h.tryTakeRateLimit() {
+				h.limiter.release()
+				h.reportHedge("skipped")
+				continue
+			}
+			hr, err := rebuildRequest(hedgeCtx)
+			if err != nil {
+				h.limiter.release()
+				h.logger.Info("failed to build hedged request", zap.Error(err))
+				continue
+			}
+
+			pending++
+			extra++
+			h.reportHedge("sent")
+			go func() {
+				defer h.limiter.release()
+				send(hr, true)
+			}()
+			if extra < hedging.MaxExtra {
+				timer.Reset(delay)
+			}
+		}
+	}
+	return last.response, last.err
+}
+
+// recordHedge records a hedged attempt for adaptive concurrency, same as executeAndRecord does for a request
+func (h *HttpCommand) recordHedge(ctx context.Context, start time.Time, response *resty.Response, err error) {
+	if err != nil {
+		r := h.handleError(err)
+		h.record(ctx, start, r, r.Err)
+	} else if response != nil {
+		h.record(ctx, start, &command.GoxResponse{StatusCode: response.StatusCode()}, nil)
+	}
+}
+
+// reportHedge counts hedged attempts separately from other calls (sent, skipped due to concurrency limit, or won)
+func (h *HttpCommand) reportHedge(result string) {
+	if EnableGoxHttpMetricLogging {
+		h.Metric().Tagged(map[string]string{"server": h.server.Name, "api": h.api.Name, "result": result}).Counter("gox_http_hedge").Inc(1)
+	}
+}
@@ -0,0 +1,153 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newHedgingTestCommand(t *testing.T, server *command.Server, serverUrl string, method string, concurrency int) command.Command {
+	return newHedgingTestCommandWithApi(t, server, serverUrl, &command.Api{Server: "testServer", Path: "/", Method: method, Timeout: 2000,
+		Concurrency: concurrency, QueueSize: 1, Hedging: &command.HedgingConfig{DelayMs: 20, MaxExtra: 1},
+	})
+}
+
+func newHedgingTestCommandWithApi(t *testing.T, server *command.Server, serverUrl string, api *command.Api) command.Command {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": server},
+		Apis:    command.Apis{"api": api},
+	}
+	if serverUrl != "" {
+		config.UpdateServerWithUrl("testServer", serverUrl)
+	}
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	return cmd
+}
+
+// slowFirstCallServer answers the first call after 500ms, and all other calls immediately
+func slowFirstCallServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+			_, _ = w.Write([]byte("slow"))
+			return
+		}
+		_, _ = w.Write([]byte("fast"))
+	}))
+}
+
+func TestHttpCommand_Hedging(t *testing.T) {
+	var calls int32
+	ts := slowFirstCallServer(&calls)
+	defer ts.Close()
+
+	cmd := newHedgingTestCommand(t, &command.Server{}, ts.URL, "GET", 2)
+
+	start := time.Now()
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", string(response.Body))
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Hedging_NotDoneForNonIdempotentOrBusyApi(t *testing.T) {
+	var calls int32
+	ts := slowFirstCallServer(&calls)
+	defer ts.Close()
+
+	// POST is not hedged
+	cmd := newHedgingTestCommand(t, &command.Server{}, ts.URL, "POST", 2)
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{Body: []byte("{}")})
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", string(response.Body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// All concurrency slots are in use - hedged attempt is skipped
+	atomic.StoreInt32(&calls, 0)
+	cmd = newHedgingTestCommand(t, &command.Server{}, ts.URL, "GET", 1)
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", string(response.Body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Hedging_LimitedByConcurrencyWithoutQueue(t *testing.T) {
+	var calls int32
+	ts := slowFirstCallServer(&calls)
+	defer ts.Close()
+
+	newApi := func(concurrency int) *command.Api {
+		return &command.Api{Server: "testServer", Path: "/", Method: "GET", Timeout: 2000, Concurrency: concurrency,
+			Hedging: &command.HedgingConfig{DelayMs: 20, MaxExtra: 1},
+		}
+	}
+
+	// The api has no wait queue - the request uses the only slot, hedged attempt is skipped
+	cmd := newHedgingTestCommandWithApi(t, &command.Server{}, ts.URL, newApi(1))
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", string(response.Body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// A free slot is used by the hedged attempt
+	atomic.StoreInt32(&calls, 0)
+	cmd = newHedgingTestCommandWithApi(t, &command.Server{}, ts.URL, newApi(2))
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", string(response.Body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Hedging_UsesOtherEndpoint(t *testing.T) {
+	var slowCalls, fastCalls int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowCalls, 1)
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastCalls, 1)
+	}))
+	defer fast.Close()
+
+	endpoint := func(serverUrl string) *command.Endpoint {
+		u, _ := url.Parse(serverUrl)
+		port, _ := strconv.Atoi(u.Port())
+		return &command.Endpoint{Host: u.Hostname(), Port: port}
+	}
+
+	// Weighted strategy would send both attempts to the slow endpoint, if hedging did not avoid it
+	server := &command.Server{
+		Endpoints:    []*command.Endpoint{endpoint(slow.URL), endpoint(fast.URL)},
+		LoadBalancer: &command.LoadBalancerConfig{Strategy: command.LoadBalancerWeighted},
+	}
+	server.Endpoints[0].Weight = 100
+	cmd := newHedgingTestCommand(t, server, "", "GET", 2)
+
+	start := time.Now()
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowCalls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fastCalls))
+}
@@ -0,0 +1,239 @@
+package httpCommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/devlibx/gox-base/v2"
+	goxError "github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var errBreakerTimeout = goxError.New("circuit breaker timeout")
+var errMaxConcurrency = goxError.New("max concurrency")
+
+// HttpBreakerCommand runs a http command behind the native circuit breaker (circuit_breaker.type=native). Unlike
+// hystrix, the call runs in the caller goroutine and the settings are not kept in global state.
+//
+// Errors use the same error codes as hystrix, so IsHystrixCircuitOpenError, IsHystrixTimeoutError etc. work for both.
+type HttpBreakerCommand struct {
+	gox.CrossFunction
+	logger  *zap.Logger
+	breaker Breaker
+	timeout time.Duration
+	api     *command.Api
+
+	// command is the underlying http command, it is replaced when the api is reloaded
+	command atomic.Pointer[command.Command]
+
+	serverName string
+	apiName    string
+
+	// admission is the bounded wait queue in front of breaker - it is taken over from the underlying http command, and
+	// replaced when the command is updated
+	admission atomic.Pointer[admissionQueue]
+
+	// inFlight limits concurrency (like hystrix max concurrency) if the api has no admission queue - it is taken over
+	// from the underlying http command, and replaced when the command is updated
+	inFlight atomic.Pointer[inFlightLimit]
+}
+
+// GetRestyClient method will return underlying resty client if it uses it
+// Returns:
+// - resty client if this command is implemented using resty client under the hood
+// - bool - true if resty client is returned otherwise false
+func (h *HttpBreakerCommand) GetRestyClient() (*resty.Client, bool) {
+	if c, ok := h.inner().(*HttpCommand); ok {
+		return c.GetRestyClient()
+	}
+	return nil, false
+}
+
+// Breaker gives the circuit breaker used by this command
+func (h *HttpBreakerCommand) Breaker() Breaker {
+	return h.breaker
+}
+
+// CircuitState gives the current state of the circuit breaker
+func (h *HttpBreakerCommand) CircuitState() CircuitState {
+	return h.breaker.State()
+}
+
+func (h *HttpBreakerCommand) UpdateCommand(command command.Command) {
+	takeOverAdmission(command, &h.admission)
+	takeOverInFlightLimit(command, &h.inFlight)
+	h.command.Store(&command)
+}
+
+// inner gives the current underlying http command
+func (h *HttpBreakerCommand) inner() command.Command {
+	return *h.command.Load()
+}
+
+func (h *HttpBreakerCommand) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
+	return executeAsync(ctx, h, request)
+}
+
+func (h *HttpBreakerCommand) Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	// Failed request (including open circuit) gets the response from fallback of the http command
+	return fallbackOf(h.inner()).run(ctx, request, h.serve)
+}
+
+// ExecuteStream executes the request behind the circuit breaker, and gives the response body as a stream which the
+// caller must close. Circuit breaker sees the result of the request until the response headers are received.
+func (h *HttpBreakerCommand) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	return executeStream(ctx, h.api, request, h.execute)
+}
+
+// SetFallback sets the func which gives the response of a failed request of this api
+func (h *HttpBreakerCommand) SetFallback(fallback command.FallbackFunc) {
+	if setter, ok := h.inner().(FallbackSetter); ok {
+		setter.SetFallback(fallback)
+	}
+}
+
+func (h *HttpBreakerCommand) serve(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	ctx, response, ok := fromCache(ctx, h.inner(), request, h.Execute)
+	if ok {
+		return response, response.Err
+	}
+
+	// Identical requests which are in flight share one call
+	return coalescerOf(h.inner()).do(ctx, request, h.execute)
+}
+
+func (h *HttpBreakerCommand) execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	if admission := h.admission.Load(); admission != nil {
+		if err := admission.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer admission.release()
+	} else if inFlight := h.inFlight.Load(); !inFlight.tryAcquire() {
+		h.logBreakerError("hystrix_error__max_concurrency")
+		return nil, &command.GoxHttpError{
+			Err:        errMaxConcurrency,
+			StatusCode: http.StatusBadRequest,
+			Message:    "rejected - all concurrency slots are in use",
+			ErrorCode:  "hystrix_rejected",
+		}
+	} else {
+		defer inFlight.release()
+	}
+
+	done, err := h.breaker.Allow()
+	if err != nil {
+		h.logBreakerError("hystrix_error__circuit_open")
+		return nil, &command.GoxHttpError{
+			Err:        err,
+			StatusCode: http.StatusBadRequest,
+			Message:    "circuit open",
+			ErrorCode:  "hystrix_circuit_open",
+		}
+	}
+
+	breakerCtx, cancel := context.WithTimeoutCause(ctx, h.timeout, errBreakerTimeout)
+	defer cancel()
+	response, err := h.inner().Execute(breakerCtx, request)
+
+	// Timeout of the breaker (not of the caller)
+	if err != nil && ctx.Err() == nil && context.Cause(breakerCtx) == errBreakerTimeout {
+		h.logBreakerError("hystrix_error__timeout")
+		err = &command.GoxHttpError{
+			Err:        errBreakerTimeout,
+			StatusCode: http.StatusBadRequest,
+			Message:    "circuit breaker timeout",
+			ErrorCode:  "hystrix_timeout",
+		}
+		response = nil
+	}
+
+	// Failure caused by caller (cancelled context or client side rate limit) does not count for or against the backend.
+	// Deadline of the caller is a failure - a slow backend must open the circuit.
+	switch {
+	case err == nil:
+		done(BreakerSuccess)
+	case errors.Is(ctx.Err(), context.Canceled) || isRateLimitedError(err):
+		done(BreakerIgnore)
+	default:
+		done(BreakerFailure)
+	}
+	return response, err
+}
+
+// logBreakerError logs breaker errors with the same metric as hystrix, so existing dashboards keep working
+func (h *HttpBreakerCommand) logBreakerError(errorTag string) {
+	if EnableGoxHttpMetricLogging {
+		h.Metric().Tagged(map[string]string{"server": h.serverName, "api": h.apiName, "status": fmt.Sprintf("%d", 500), "error": errorTag}).Counter("gox_http_call").Inc(1)
+	}
+}
+
+// NewHttpBreakerCommand creates a command with native circuit breaker and its own connection pool. Use
+// NewHttpBreakerCommandWithRuntime to share the connection pool of a server across multiple APIs.
+func NewHttpBreakerCommand(cf gox.CrossFunction, server *command.Server, api *command.Api) (command.Command, error) {
+	runtime, err := NewServerRuntime(cf, server)
+	if err != nil {
+		return nil, err
+	}
+	return NewHttpBreakerCommandWithRuntime(cf, runtime, api)
+}
+
+// NewHttpBreakerCommandWithRuntime creates a command with native circuit breaker, which uses the shared connection
+// pool of the server runtime
+func NewHttpBreakerCommandWithRuntime(cf gox.CrossFunction, runtime *ServerRuntime, api *command.Api) (command.Command, error) {
+	server := runtime.Server()
+	breakerConfig := api.GetCircuitBreakerConfig(server)
+
+	var breaker *slidingWindowBreaker
+	switch breakerConfig.Scope {
+	case command.CircuitBreakerScopeApi:
+		breaker = newSlidingWindowBreaker(api.Name, breakerConfig)
+	case command.CircuitBreakerScopeServer:
+		breaker = runtime.sharedBreaker("server__"+server.Name, breakerConfig)
+	default:
+		return nil, goxError.New("invalid circuit_breaker scope=%s for api=%s (expected api or server)", breakerConfig.Scope, api.Name)
+	}
+
+	hc, err := NewHttpCommandWithRuntime(cf, runtime, api)
+	if err != nil {
+		return nil, goxError.Wrap(err, "failed to crate http command for %s", api.Name)
+	}
+
+	c := &HttpBreakerCommand{
+		CrossFunction: cf,
+		logger:        cf.Logger().Named("goxHttp").Named(api.Name),
+		breaker:       breaker,
+		timeout:       time.Duration(breakerTimeout(api, breakerConfig)) * time.Millisecond,
+		api:           api,
+		serverName:    server.Name,
+		apiName:       api.Name,
+	}
+	c.UpdateCommand(hc)
+
+	if breakerConfig.Scope == command.CircuitBreakerScopeApi {
+		breaker.addListener(func(from CircuitState, to CircuitState, reason string) {
+			runtime.circuitStateChanged(c.logger, api.Name, from, to, reason)
+		})
+	}
+	return c, nil
+}
+
+// NewCommandWithRuntime creates the command for an api as per its config - a plain http command if hystrix is
+// disabled, otherwise a command with native or hystrix circuit breaker
+func NewCommandWithRuntime(cf gox.CrossFunction, runtime *ServerRuntime, api *command.Api) (command.Command, error) {
+	if api.DisableHystrix {
+		return NewHttpCommandWithRuntime(cf, runtime, api)
+	}
+	switch breakerType := api.GetCircuitBreakerConfig(runtime.Server()).Type; breakerType {
+	case command.CircuitBreakerTypeNative:
+		return NewHttpBreakerCommandWithRuntime(cf, runtime, api)
+	case command.CircuitBreakerTypeHystrix:
+		return NewHttpHystrixCommandWithRuntime(cf, runtime, api)
+	default:
+		return nil, goxError.New("invalid circuit_breaker type=%s for api=%s (expected hystrix or native)", breakerType, api.Name)
+	}
+}
@@ -2,7 +2,6 @@ package httpCommand
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"github.com/devlibx/gox-base/v2"
 	"github.com/devlibx/gox-base/v2/errors"
@@ -16,9 +15,8 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -41,12 +39,46 @@ var ContextBasedHeaderPrefix = "__request_scope_headers__"
 
 type HttpCommand struct {
 	gox.CrossFunction
-	server           *command.Server
-	api              *command.Api
-	logger           *zap.Logger
-	debugLogger      *zap.SugaredLogger
-	client           *resty.Client
-	setRetryFuncOnce *sync.Once
+	server      *command.Server
+	api         *command.Api
+	logger      *zap.Logger
+	debugLogger *zap.SugaredLogger
+	client      *resty.Client
+	retryPolicy RetryPolicy
+
+	// streamClient sends the requests of ExecuteStream, it does not have the timeout of the api
+	streamClient *resty.Client
+
+	// retry budget of this api, and of the server (shared by all apis of the server) - nil if not configured
+	retryBudget       *retryBudget
+	serverRetryBudget *retryBudget
+
+	// admission is the bounded wait queue in front of this api (nil if someone else e.g. hystrix command owns it)
+	admission *admissionQueue
+
+	// inFlight limits the in-flight requests of this api if it has no admission queue (nil if someone else e.g. breaker
+	// command owns it)
+	inFlight *inFlightLimit
+
+	// limiter is the admission queue or the in-flight limit of this api, even when it is owned by another command (e.g.
+	// hystrix command) - hedged attempts take extra slots from it
+	limiter concurrencyLimiter
+
+	// rate limit of this api, and of the server (shared by all apis of the server) - nil if not configured
+	rateLimiter       *rateLimiter
+	serverRateLimiter *rateLimiter
+
+	// cache serves responses from the response cache of this api (nil if not configured)
+	cache *responseCache
+
+	// coalescer shares one call between identical requests in flight (nil if not enabled)
+	coalescer *coalescer
+
+	// fallback gives the response of a failed request from the fallback func or fallback config of this api
+	fallback *fallback
+
+	// loadBalancer picks the endpoint for each attempt if server has multiple endpoints (nil otherwise)
+	loadBalancer *loadBalancer
 
 	deepCopyOfApi *command.Api
 }
@@ -60,15 +92,7 @@ func (h *HttpCommand) GetRestyClient() (*resty.Client, bool) {
 }
 
 func (h *HttpCommand) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
-	responseChannel := make(chan *command.GoxResponse)
-	go func() {
-		if result, err := h.Execute(ctx, request); err != nil {
-			responseChannel <- &command.GoxResponse{Err: err}
-		} else {
-			responseChannel <- result
-		}
-	}()
-	return responseChannel
+	return executeAsync(ctx, h, request)
 }
 
 func (h *HttpCommand) Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
@@ -80,7 +104,49 @@ func (h *HttpCommand) Execute(ctx context.Context, request *command.GoxRequest)
 		}
 	}
 
-	response, err := h.internalExecute(ctx, request)
+	// Stream is not served from cache or fallback, and it is not shared with other requests
+	if isStream(ctx) {
+		return h.execute(ctx, request)
+	}
+
+	// Failed request gets the response from fallback (if configured)
+	return h.fallback.run(ctx, request, h.serve)
+}
+
+// ExecuteStream executes the request, and gives the response body as a stream which the caller must close
+func (h *HttpCommand) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	return executeStream(ctx, h.api, request, h.execute)
+}
+
+// SetFallback sets the func which gives the response of a failed request of this api
+func (h *HttpCommand) SetFallback(fallback command.FallbackFunc) {
+	h.fallback.setFunc(fallback)
+}
+
+func (h *HttpCommand) serve(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	// Fresh response from cache does not need a concurrency slot
+	if response, ok := h.cache.serve(ctx, request, h.Execute); ok {
+		return response, response.Err
+	}
+
+	// Identical requests which are in flight share one call
+	return h.coalescer.do(ctx, request, h.execute)
+}
+
+func (h *HttpCommand) execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	var response *command.GoxResponse
+	var err error
+	if h.admission != nil {
+		if err = h.admission.acquire(ctx); err == nil {
+			response, err = h.executeAndRecord(ctx, request)
+			h.admission.release()
+		}
+	} else {
+		// Not limited here (hystrix limits it, or hystrix is disabled) - only counted for hedged attempts
+		h.inFlight.hold()
+		response, err = h.executeAndRecord(ctx, request)
+		h.inFlight.release()
+	}
 
 	// Log HTTP metrics
 	if EnableGoxHttpMetricLogging {
@@ -110,6 +176,22 @@ func (h *HttpCommand) Execute(ctx context.Context, request *command.GoxRequest)
 	return response, err
 }
 
+// executeAndRecord runs the request, and gives its latency and outcome to the adaptive concurrency limit. Requests
+// which did not reach the server (rate limited, or cancelled by the caller) are not used.
+func (h *HttpCommand) executeAndRecord(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	start := time.Now()
+	response, err := h.internalExecute(ctx, request)
+	h.record(ctx, start, response, err)
+	return response, err
+}
+
+// record gives the latency and outcome of a request (or of a hedged attempt) to the adaptive concurrency limit
+func (h *HttpCommand) record(ctx context.Context, start time.Time, response *command.GoxResponse, err error) {
+	if !isRateLimitedError(err) && ctx.Err() != context.Canceled {
+		h.limiter.record(time.Since(start), isOverload(response, err))
+	}
+}
+
 func (h *HttpCommand) internalExecute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
 	// sp, ctxWithSpan := opentracing.StartSpanFromContext(ctx, h.api.Name)
 	sp, ctxWithSpan := DefaultStartSpanFromContextFunc(ctx, h.api.Name)
@@ -117,9 +199,29 @@ func (h *HttpCommand) internalExecute(ctx context.Context, request *command.GoxR
 
 	var response *resty.Response
 
+	// Wait for the rate limit of api and server - before connection_request_timeout starts
+	if err := h.takeRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	// Revalidate the stale response in cache (if any) with a conditional request - not for a stream
+	var cacheKey string
+	var staleEntry *command.CachedResponse
+	if !isStream(ctx) {
+		cacheKey, staleEntry, request = h.cache.prepare(request)
+	}
+
+	// Count the requests sent to the server (retries and hedged attempts)
+	attempts := new(int32)
+	ctxWithSpan = context.WithValue(ctxWithSpan, attemptsContextKey{}, attempts)
+
+	// Request of ExecuteStream is detached from the contexts of this call once the response headers are received
+	stream := newStreamRequest(ctxWithSpan)
+
 	// Build request with all parameters
-	r, err := h.buildRequest(ctxWithSpan, request, sp)
+	r, err := h.buildRequest(stream.context(ctxWithSpan), request, sp)
 	if err != nil {
+		stream.release()
 		h.debugLogger.Debug("got request to execute (err)", zap.Stringer("request", request))
 		return nil, err
 	}
@@ -135,18 +237,8 @@ func (h *HttpCommand) internalExecute(ctx context.Context, request *command.GoxR
 	ht.trackHttp(request, r, h.api, h.server)
 
 	start := time.Now()
-	switch strings.ToUpper(h.api.Method) {
-	case "GET":
-		response, err = r.Get(finalUrlToRequest)
-	case "POST":
-		response, err = r.Post(finalUrlToRequest)
-	case "PUT":
-		response, err = r.Put(finalUrlToRequest)
-	case "DELETE":
-		response, err = r.Delete(finalUrlToRequest)
-	case "PATCH":
-		response, err = r.Patch(finalUrlToRequest)
-	}
+	rebuildRequest := func(ctx context.Context) (*resty.Request, error) { return h.buildRequest(ctx, request, sp) }
+	response, retryBudgetExhausted, err := h.executeWithRetry(ctxWithSpan, request, r, rebuildRequest, finalUrlToRequest)
 	end := time.Now()
 
 	urlToPrint := finalUrlToRequest
@@ -157,7 +249,7 @@ func (h *HttpCommand) internalExecute(ctx context.Context, request *command.GoxR
 		h.logger.Info("Time taken: ", zap.Int64("time_taken", end.UnixMilli()-start.UnixMilli()), zap.Int64("start", start.UnixMilli()), zap.Int64("end", end.UnixMilli()), zap.String("url", urlToPrint))
 	}
 
-	if EnableRequestResponseBodyLogging {
+	if EnableRequestResponseBodyLogging && response != nil {
 		if response.Body() != nil && len(response.Body()) > 0 {
 			h.debugLogger.Debug("request/response of http call", zap.String("url", finalUrlToRequest), zap.Stringer("request", request), zap.String("response", string(response.Body())), zap.Int("response_code", response.StatusCode()))
 		} else {
@@ -170,12 +262,189 @@ func (h *HttpCommand) internalExecute(ctx context.Context, request *command.GoxR
 		h.publishTracking(request, r, finalUrlToRequest, ht)
 	}()
 
+	var responseObject *command.GoxResponse
 	if err != nil {
-		responseObject := h.handleError(err)
-		return responseObject, responseObject.Err
+		if stream != nil && ctxWithSpan.Err() != nil {
+			// Request of a stream is only cancelled (not timed out) when the context of this call is done
+			err = errors.Wrap(ctxWithSpan.Err(), "%v", err)
+		}
+		stream.release()
+		responseObject = h.handleError(err)
+	} else if stream != nil {
+		if responseObject, err = stream.response(h.api, response); err != nil {
+			responseObject = h.handleError(err)
+		}
+	} else if staleEntry != nil && response.StatusCode() == http.StatusNotModified {
+		responseObject = h.cache.revalidated(request, cacheKey, staleEntry, response)
 	} else {
-		responseObject := h.processResponse(request, response)
-		return responseObject, responseObject.Err
+		responseObject = h.processResponse(request, response)
+		if responseObject.Err == nil && h.api.IsHttpCodeAcceptable(response.StatusCode()) {
+			h.cache.save(cacheKey, response)
+		}
+	}
+
+	setResponseMetadata(responseObject, response, int(atomic.LoadInt32(attempts)), end.Sub(start))
+
+	// Request failed and we did not retry as the retry budget is used up - keep the status and body of the last attempt
+	if retryBudgetExhausted {
+		if goxErr, ok := responseObject.Err.(*command.GoxHttpError); ok {
+			goxErr.Err = errors.Wrap(errRetryBudgetExhausted, "%v", goxErr.Err)
+			goxErr.Message = "request failed and it is not retried - retry budget is exhausted"
+			goxErr.ErrorCode = command.ErrorCodeRetryBudgetExhausted
+		}
+	}
+	return responseObject, responseObject.Err
+}
+
+// executeWithRetry sends the request, and retries it as long as the retry policy and the retry budget of this api
+// allows. It returns true if a retry was needed but was not done because the retry budget is used up. rebuildRequest
+// is used to create another copy of the request for hedged attempts.
+func (h *HttpCommand) executeWithRetry(ctx context.Context, request *command.GoxRequest, r *resty.Request, rebuildRequest func(ctx context.Context) (*resty.Request, error), url string) (*resty.Response, bool, error) {
+	h.retryBudget.deposit()
+	h.serverRetryBudget.deposit()
+
+	var wait time.Duration
+	for attempt := 1; ; attempt++ {
+		response, err := h.sendWithHedging(ctx, request, r, rebuildRequest, url)
+
+		// Stop if we got a response which is acceptable or the caller is gone
+		if err == nil && response != nil && h.isAcceptable(request, response.StatusCode()) {
+			return response, false, err
+		} else if ctx.Err() != nil {
+			return response, false, err
+		}
+
+		retryAttempt := &RetryAttempt{Api: h.api, Method: h.api.Method, Request: request, Attempt: attempt, Err: err, PreviousWait: wait}
+		retryAttempt.Deadline, _ = ctx.Deadline()
+		if response != nil {
+			retryAttempt.StatusCode = response.StatusCode()
+			retryAttempt.Header = response.Header()
+		}
+		retry, nextWait := h.retryPolicy.ShouldRetry(retryAttempt)
+		if !retry || !canResend(r) || isResponseTooLargeError(err) {
+			return response, false, err
+		}
+
+		// Retry only if api and server both have budget for it
+		refundApi, ok := h.retryBudget.tryWithdraw()
+		if !ok {
+			h.reportRetryBudgetExhausted()
+			return response, true, err
+		}
+		refundServer, ok := h.serverRetryBudget.tryWithdraw()
+		if !ok {
+			refundApi()
+			h.reportRetryBudgetExhausted()
+			return response, true, err
+		}
+
+		discardStreamBody(ctx, response)
+		if response != nil {
+			h.logger.Info("retrying api after error", zap.Int("attempt", attempt), zap.Int("status", response.StatusCode()), zap.Duration("wait", nextWait))
+		} else if err != nil {
+			h.logger.Info("retrying api after error", zap.Int("attempt", attempt), zap.String("err", err.Error()), zap.Duration("wait", nextWait))
+		}
+		if EnableGoxHttpMetricLogging {
+			h.Metric().Tagged(map[string]string{"server": h.server.Name, "api": h.api.Name}).Counter("gox_http_retry").Inc(1)
+		}
+
+		// Retry is also a call to the server, so it needs a token from the rate limit. If it is not allowed then we
+		// return the result of the last attempt, and the retry budget taken for it is given back.
+		wait = nextWait
+		if !sleepWithContext(ctx, wait) || h.takeRateLimit(ctx) != nil {
+			refundApi()
+			refundServer()
+			return response, false, err
+		}
+	}
+}
+
+// isAcceptable checks if the status code is acceptable for this api, 304 is also acceptable for a conditional request
+func (h *HttpCommand) isAcceptable(request *command.GoxRequest, statusCode int) bool {
+	return h.api.IsHttpCodeAcceptable(statusCode) || (statusCode == http.StatusNotModified && isConditional(request))
+}
+
+func (h *HttpCommand) reportRetryBudgetExhausted() {
+	if EnableGoxHttpMetricLogging {
+		h.Metric().Tagged(map[string]string{"server": h.server.Name, "api": h.api.Name}).Counter("gox_http_retry_budget_exhausted").Inc(1)
+	}
+}
+
+// sendToEndpoint sends the request to the next endpoint from the load balancer, or to the given url if the server has
+// a single host (or service discovery did not find any endpoint yet). If used is not nil then endpoints in it are
+// avoided, and the selected endpoint is added to it.
+func (h *HttpCommand) sendToEndpoint(ctx context.Context, r *resty.Request, url string, used *usedEndpoints) (*resty.Response, error) {
+	var endpoint *endpointState
+	if h.loadBalancer != nil {
+		endpoint = h.loadBalancer.pick(used.list()...)
+	}
+	if endpoint == nil {
+		response, err := h.send(ctx, r, url)
+		h.adaptRateLimit(response)
+		return response, err
+	}
+	used.add(endpoint)
+	start := time.Now()
+	response, err := h.send(ctx, r, h.api.GetPathForEndpoint(h.server, endpoint.endpoint))
+	h.adaptRateLimit(response)
+
+	outcome := endpointSuccess
+	if ctx.Err() != nil {
+		outcome = endpointCancelled
+	} else if err != nil {
+		outcome = endpointConnectFailure
+	} else if response != nil && response.StatusCode() >= http.StatusInternalServerError {
+		outcome = endpointServerError
+	}
+	h.loadBalancer.release(endpoint, outcome, time.Since(start))
+	return response, err
+}
+
+func (h *HttpCommand) send(ctx context.Context, r *resty.Request, url string) (*resty.Response, error) {
+	if attempts, ok := ctx.Value(attemptsContextKey{}).(*int32); ok {
+		atomic.AddInt32(attempts, 1)
+	}
+	if body, ok := r.Body.(*multipartBody); ok {
+		if err := body.rewind(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Bound the time to get a connection for this attempt with connection_request_timeout
+	requestCtx := r.Context()
+	attemptCtx, cancel := withConnectionRequestTimeout(requestCtx, h.server)
+	r.SetContext(attemptCtx)
+	defer r.SetContext(requestCtx)
+
+	response, err := r.Execute(strings.ToUpper(h.api.Method), url)
+	if err != nil && context.Cause(attemptCtx) == errConnectionRequestTimeout {
+		err = errors.Wrap(errConnectionRequestTimeout, "%v", err)
+	}
+
+	// Body of a stream is read after this call, it is done when the request of the stream is released
+	if err != nil || !isStream(ctx) {
+		cancel()
+	}
+	return response, err
+}
+
+type attemptsContextKey struct{}
+
+// setResponseMetadata copies the headers and protocol details of the response from server to the response of the
+// caller. Header which is already set (response from cache) is kept.
+func setResponseMetadata(responseObject *command.GoxResponse, response *resty.Response, attempts int, latency time.Duration) {
+	responseObject.Attempts = attempts
+	responseObject.Latency = latency
+	if response == nil || response.RawResponse == nil {
+		return
+	}
+	if responseObject.Header == nil {
+		responseObject.Header = response.Header()
+	}
+	responseObject.Trailer = response.RawResponse.Trailer
+	responseObject.Proto = response.RawResponse.Proto
+	if response.RawResponse.Request != nil && response.RawResponse.Request.URL != nil {
+		responseObject.Url = response.RawResponse.Request.URL.String()
 	}
 }
 
@@ -193,37 +462,11 @@ func (h *HttpCommand) publishTracking(request *command.GoxRequest, r *resty.Requ
 
 func (h *HttpCommand) buildRequest(ctx context.Context, request *command.GoxRequest, sp opentracing.Span) (*resty.Request, error) {
 	r := h.client.R()
+	if isStream(ctx) {
+		r = h.streamClient.R().SetDoNotParseResponse(true)
+	}
 	r.SetContext(ctx)
 
-	// If retry is enabled then we will setup retrying
-	h.setRetryFuncOnce.Do(func() {
-		if h.api.RetryCount >= 0 {
-
-			// Set retry count defined
-			h.client.SetRetryCount(h.api.RetryCount)
-
-			// Set initial retry time
-			if h.api.InitialRetryWaitTimeMs > 0 {
-				h.client.SetRetryWaitTime(time.Duration(h.api.InitialRetryWaitTimeMs) * time.Millisecond)
-			}
-
-			// Set retry function to avoid retry if this status is acceptable
-			h.client.AddRetryCondition(func(response *resty.Response, err error) bool {
-				if response != nil && h.api.IsHttpCodeAcceptable(response.StatusCode()) {
-					return false
-				}
-				if response != nil {
-					h.logger.Info("retrying api after error", zap.Any("response", response))
-				} else if err != nil {
-					h.logger.Info("retrying api after error", zap.String("err", err.Error()))
-				} else {
-					h.logger.Info("retrying api after error")
-				}
-				return true
-			})
-		}
-	})
-
 	// inject opentracing in the outgoing request
 	tracer := opentracing.GlobalTracer()
 	_ = tracer.Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
@@ -278,12 +521,17 @@ func (h *HttpCommand) buildRequest(ctx context.Context, request *command.GoxRequ
 		}
 	}
 
-	// Auto set application/json as default
-	if _, ok := request.Header["Content-Type"]; !ok {
-		if _, ok := request.Header["content-type"]; !ok {
-			r.SetHeader("content-type", "application/json")
+	// Set content type of request_codec (or application/json) as default, and ask for the content type of response_codec
+	if r.Header.Get("Content-Type") == "" {
+		if h.api.RequestCodec != "" {
+			r.SetHeader("Content-Type", h.api.RequestCodec)
+		} else {
+			r.SetHeader("Content-Type", command.ContentTypeJson)
 		}
 	}
+	if h.api.ResponseCodec != "" && r.Header.Get("Accept") == "" {
+		r.SetHeader("Accept", h.api.ResponseCodec)
+	}
 
 	// Add request scope header
 	if ctx.Value(ContextBasedHeaderPrefix) != nil {
@@ -312,7 +560,19 @@ func (h *HttpCommand) buildRequest(ctx context.Context, request *command.GoxRequ
 		}
 	}
 
-	if b, ok := request.Body.([]byte); ok {
+	if len(request.Multipart) > 0 {
+		body, err := newMultipartBody(request.Multipart)
+		if err != nil {
+			return nil, &command.GoxHttpError{
+				Err:        err,
+				StatusCode: http.StatusInternalServerError,
+				Message:    "failed to build multipart body",
+				ErrorCode:  command.ErrorCodeFailedToBuildRequest,
+			}
+		}
+		r.SetHeader("Content-Type", body.ContentType())
+		r.SetBody(body)
+	} else if b, ok := request.Body.([]byte); ok {
 		r.SetBody(b)
 	} else if request.BodyProvider != nil {
 		if b, err := request.BodyProvider.Body(request.Body); err == nil {
@@ -326,13 +586,19 @@ func (h *HttpCommand) buildRequest(ctx context.Context, request *command.GoxRequ
 			}
 		}
 	} else if request.Body != nil {
-		if b, err := serialization.Stringify(request.Body); err == nil {
+		// Encode with the codec of the content type, json is used if the content type does not have a codec
+		contentType := r.Header.Get("Content-Type")
+		codec, ok := command.GetCodec(contentType)
+		if !ok {
+			codec = command.JsonCodec{}
+		}
+		if b, err := codec.Encode(request.Body); err == nil {
 			r.SetBody(b)
 		} else {
 			return nil, &command.GoxHttpError{
 				Err:        err,
 				StatusCode: http.StatusInternalServerError,
-				Message:    "failed to read body using Stringify",
+				Message:    fmt.Sprintf("failed to encode body with codec of content-type=%s", contentType),
 				ErrorCode:  command.ErrorCodeFailedToBuildRequest,
 			}
 		}
@@ -448,6 +714,8 @@ func (h *HttpCommand) handleError(err error) *command.GoxResponse {
 	// Timeout errors are handled here
 	var e net.Error
 	switch {
+	case isResponseTooLargeError(err):
+		responseObject = &command.GoxResponse{StatusCode: http.StatusBadGateway, Err: newResponseTooLargeError(err)}
 	case errors.As(err, &e):
 		if e.Timeout() {
 			responseObject = &command.GoxResponse{
@@ -478,39 +746,71 @@ func (h *HttpCommand) handleError(err error) *command.GoxResponse {
 	return responseObject
 }
 
+// NewHttpCommand creates a http command with its own connection pool. Use NewHttpCommandWithRuntime to share the
+// connection pool of a server across multiple APIs.
 func NewHttpCommand(cf gox.CrossFunction, server *command.Server, api *command.Api) (command.Command, error) {
+	runtime, err := NewServerRuntime(cf, server)
+	if err != nil {
+		return nil, err
+	}
+	return NewHttpCommandWithRuntime(cf, runtime, api)
+}
 
-	// We need to build a client and also consider if we need to use proxy or not
-	var client *resty.Client
-	if server.ProxyUrl == "" {
-		client = resty.New()
-	} else {
-		if proxyURL, err := url.Parse(server.ProxyUrl); err != nil {
-			return nil, errors.Wrap(err, "failed to parse proxy url: url=%s", server.ProxyUrl)
-		} else {
-			client = resty.New()
-			client.SetTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)})
-			if server.SkipCertVerify == "true" {
-				client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
-			}
+// NewHttpCommandWithRuntime creates a http command which uses the shared connection pool of the server runtime
+func NewHttpCommandWithRuntime(cf gox.CrossFunction, runtime *ServerRuntime, api *command.Api) (command.Command, error) {
+	server := runtime.Server()
+	if !command.IsKnownHttpMethod(api.Method) {
+		return nil, errors.New("invalid method=%s for api=%s (use command.RegisterHttpMethod to allow a custom method)", api.Method, api.Name)
+	}
+	for _, contentType := range []string{api.RequestCodec, api.ResponseCodec} {
+		if _, ok := command.GetCodec(contentType); contentType != "" && !ok {
+			return nil, errors.New("codec not found for content-type=%s of api=%s (use command.RegisterCodec to add a codec)", contentType, api.Name)
 		}
 	}
-
+	retryPolicy, err := NewRetryPolicy(api)
+	if err != nil {
+		return nil, err
+	}
+	client, streamClient := runtime.newRestyClients(api)
 	c := &HttpCommand{
-		CrossFunction:    cf,
-		server:           server,
-		api:              api,
-		logger:           cf.Logger().Named("goxHttp").Named(api.Name),
-		client:           client,
-		setRetryFuncOnce: &sync.Once{},
+		CrossFunction:     cf,
+		server:            server,
+		api:               api,
+		logger:            cf.Logger().Named("goxHttp").Named(api.Name),
+		client:            client,
+		streamClient:      streamClient,
+		retryPolicy:       retryPolicy,
+		retryBudget:       newRetryBudget(api.RetryBudget),
+		serverRetryBudget: runtime.retryBudget,
+		rateLimiter:       newRateLimiter(api.RateLimit),
+		serverRateLimiter: runtime.rateLimiter,
+		loadBalancer:      runtime.loadBalancer,
+	}
+	if c.admission, err = newAdmissionQueue(cf, server, api); err != nil {
+		return nil, err
+	}
+	if c.inFlight = newInFlightLimit(api, c.admission); c.inFlight != nil {
+		c.limiter = c.inFlight
+	} else {
+		c.limiter = c.admission
+	}
+	if c.cache, err = newResponseCache(cf, server, api); err != nil {
+		return nil, err
+	}
+	if c.coalescer, err = newCoalescer(cf, server, api); err != nil {
+		return nil, err
+	}
+	if c.fallback, err = newFallback(cf, server, api); err != nil {
+		return nil, err
 	}
 	c.debugLogger = c.logger.Sugar()
 	c.client.SetAllowGetMethodPayload(true)
-	c.client.SetTimeout(time.Duration(api.Timeout) * time.Millisecond)
+	c.streamClient.SetAllowGetMethodPayload(true)
 
 	// If Resty Debug is enabled then we will dump request response
 	if EnableRestyDebug || api.EnableRequestResponseLogging {
 		c.client.SetDebug(true)
+		c.streamClient.SetDebug(true)
 	}
 
 	return c, nil
@@ -13,19 +13,69 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var HystrixConfigMap = gox.StringObjectMap{}
 
+// hystrixCommandLimits keeps the timeout and max concurrency of each api which uses a hystrix command. If a command is
+// shared by many apis (circuit breaker with server scope), it must allow the sum of their concurrency and the max of
+// their timeouts.
+var hystrixCommandLimits = map[string]map[string]hystrixLimits{}
+var hystrixCommandLimitsMutex = &sync.Mutex{}
+
+type hystrixLimits struct {
+	timeout               int
+	maxConcurrentRequests int
+}
+
+// sharedHystrixLimits registers the limits of an api for a hystrix command, and gives the limits to use for the command
+func sharedHystrixLimits(commandName string, apiName string, timeout int, maxConcurrentRequests int) (int, int) {
+	hystrixCommandLimitsMutex.Lock()
+	defer hystrixCommandLimitsMutex.Unlock()
+
+	if _, ok := hystrixCommandLimits[commandName]; !ok {
+		hystrixCommandLimits[commandName] = map[string]hystrixLimits{}
+	}
+	hystrixCommandLimits[commandName][apiName] = hystrixLimits{timeout: timeout, maxConcurrentRequests: maxConcurrentRequests}
+
+	timeout, maxConcurrentRequests = 0, 0
+	for _, limits := range hystrixCommandLimits[commandName] {
+		if limits.timeout > timeout {
+			timeout = limits.timeout
+		}
+		maxConcurrentRequests += limits.maxConcurrentRequests
+	}
+	return timeout, maxConcurrentRequests
+}
+
 type HttpHystrixCommand struct {
 	gox.CrossFunction
 	logger             *zap.Logger
-	command            command.Command
 	hystrixCommandName string
 	api                *command.Api
 
+	// command is the underlying http command, it is replaced when the api is reloaded
+	command atomic.Pointer[command.Command]
+
 	serverName string
 	apiName    string
+
+	// admission is the bounded wait queue in front of hystrix - it is taken over from the underlying http command, and
+	// replaced when the command is updated
+	admission atomic.Pointer[admissionQueue]
+
+	// runtime is used to send circuit state changes, hystrix has no callback so we check state after every call
+	runtime *ServerRuntime
+
+	// sharedCircuit is true if the hystrix circuit is shared by all APIs of the server (circuit breaker with server scope)
+	sharedCircuit bool
+
+	// timeout is the hystrix timeout, it is also the deadline of the request context - so that the request does not
+	// continue (e.g. wait for Retry-After) after hystrix gave up on it
+	timeout time.Duration
 }
 
 // GetRestyClient method will return underlying resty client if it uses it
@@ -33,14 +83,20 @@ type HttpHystrixCommand struct {
 // - resty client if this command is implemented using resty client under the hood
 // - bool - true if resty client is returned otherwise false
 func (h *HttpHystrixCommand) GetRestyClient() (*resty.Client, bool) {
-	if c, ok := h.command.(*HttpCommand); ok {
+	if c, ok := h.inner().(*HttpCommand); ok {
 		return c.GetRestyClient()
 	}
 	return nil, false
 }
 
 func (h *HttpHystrixCommand) UpdateCommand(command command.Command) {
-	h.command = command
+	takeOverAdmission(command, &h.admission)
+	h.command.Store(&command)
+}
+
+// inner gives the current underlying http command
+func (h *HttpHystrixCommand) inner() command.Command {
+	return *h.command.Load()
 }
 
 type result struct {
@@ -49,10 +105,53 @@ type result struct {
 }
 
 func (h *HttpHystrixCommand) Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	// Failed request (including open circuit) gets the response from fallback of the http command
+	return fallbackOf(h.inner()).run(ctx, request, h.serve)
+}
+
+// ExecuteStream executes the request behind the circuit breaker, and gives the response body as a stream which the
+// caller must close. Circuit breaker sees the result of the request until the response headers are received.
+func (h *HttpHystrixCommand) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	return executeStream(ctx, h.api, request, h.execute)
+}
+
+// SetFallback sets the func which gives the response of a failed request of this api
+func (h *HttpHystrixCommand) SetFallback(fallback command.FallbackFunc) {
+	if setter, ok := h.inner().(FallbackSetter); ok {
+		setter.SetFallback(fallback)
+	}
+}
+
+func (h *HttpHystrixCommand) serve(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	ctx, response, ok := fromCache(ctx, h.inner(), request, h.Execute)
+	if ok {
+		return response, response.Err
+	}
+
+	// Identical requests which are in flight share one call
+	return coalescerOf(h.inner()).do(ctx, request, h.execute)
+}
+
+func (h *HttpHystrixCommand) execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
+	if admission := h.admission.Load(); admission != nil {
+		if err := admission.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer admission.release()
+	}
+
+	defer h.checkCircuitStateChange()
+
 	r := &result{}
 	if err := hystrix.Do(h.hystrixCommandName, func() error {
-		r.response, r.err = h.command.Execute(ctx, request)
+		ctx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		r.response, r.err = h.inner().Execute(ctx, request)
 		h.logHystrixError(ctx, request, r.err)
+		if isRateLimitedError(r.err) {
+			// Request was not sent due to our own rate limit - it is not a failure of the server
+			return nil
+		}
 		return r.err
 	}, nil); err != nil {
 		h.logHystrixError(ctx, request, err)
@@ -63,6 +162,35 @@ func (h *HttpHystrixCommand) Execute(ctx context.Context, request *command.GoxRe
 	}
 }
 
+// CircuitState gives the current state of the hystrix circuit (hystrix does not expose half-open state)
+func (h *HttpHystrixCommand) CircuitState() CircuitState {
+	if circuit, _, err := hystrix.GetCircuit(h.hystrixCommandName); err == nil && circuit.IsOpen() {
+		return CircuitOpen
+	}
+	return CircuitClosed
+}
+
+// checkCircuitStateChange sends an event if hystrix circuit state is changed since the last call. Hystrix changes the
+// state of a circuit only within a call, so no change is missed - but the half-open state (a single test request after
+// the sleep window) is not visible outside hystrix, so only open and closed are reported.
+func (h *HttpHystrixCommand) checkCircuitStateChange() {
+	state := h.CircuitState()
+	from, changed := h.runtime.hystrixStateChanged(h.hystrixCommandName, state)
+	if !changed {
+		return
+	}
+
+	reason := "hystrix circuit closed after a successful request"
+	if state == CircuitOpen {
+		reason = "hystrix circuit opened - error percentage is over threshold"
+	}
+	apiName := h.apiName
+	if h.sharedCircuit {
+		apiName = ""
+	}
+	h.runtime.circuitStateChanged(h.logger, apiName, from, state, reason)
+}
+
 // If this is a hystrix error then log it
 func (h *HttpHystrixCommand) logHystrixError(ctx context.Context, request *command.GoxRequest, err error) {
 	var e hystrix.CircuitError
@@ -87,7 +215,7 @@ func (h *HttpHystrixCommand) logHystrixError(ctx context.Context, request *comma
 }
 
 func (h *HttpHystrixCommand) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
-	return nil
+	return executeAsync(ctx, h, request)
 }
 
 func (h *HttpHystrixCommand) errorCreator(err error) error {
@@ -143,39 +271,73 @@ func (h *HttpHystrixCommand) errorCreator(err error) error {
 	}
 }
 
+// breakerTimeout gives the timeout of circuit breaker - api timeout (incl. retries) + 10%, or the timeout given in
+// circuit breaker config
+func breakerTimeout(api *command.Api, breakerConfig *command.CircuitBreakerConfig) int {
+	if breakerConfig.TimeoutMs > 0 {
+		return breakerConfig.TimeoutMs
+	}
+
+	// Set timeout + 10% delta
+	timeout := api.Timeout
+
+	// Add extra time to handle retry counts
+	if api.Retry != nil {
+		if api.Retry.MaxAttempts > 1 {
+			timeout = (timeout * api.Retry.MaxAttempts) + (api.Retry.MaxBackoffMs * (api.Retry.MaxAttempts - 1))
+		}
+	} else if api.RetryCount > 0 {
+		timeout = timeout + (timeout * api.RetryCount) + api.InitialRetryWaitTimeMs
+	}
+
+	if timeout/10 <= 0 {
+		timeout += 2
+	} else {
+		timeout += timeout / 10
+	}
+	return timeout
+}
+
+// NewHttpHystrixCommand creates a hystrix command with its own connection pool. Use NewHttpHystrixCommandWithRuntime to
+// share the connection pool of a server across multiple APIs.
 func NewHttpHystrixCommand(cf gox.CrossFunction, server *command.Server, api *command.Api) (command.Command, error) {
+	runtime, err := NewServerRuntime(cf, server)
+	if err != nil {
+		return nil, err
+	}
+	return NewHttpHystrixCommandWithRuntime(cf, runtime, api)
+}
 
-	hc, err := NewHttpCommand(cf, server, api)
+// NewHttpHystrixCommandWithRuntime creates a hystrix command which uses the shared connection pool of the server runtime
+func NewHttpHystrixCommandWithRuntime(cf gox.CrossFunction, runtime *ServerRuntime, api *command.Api) (command.Command, error) {
+	server := runtime.Server()
+	hc, err := NewHttpCommandWithRuntime(cf, runtime, api)
 	if err != nil {
 		return nil, goxError.Wrap(err, "failed to crate http command for %s", api.Name)
 	}
 
-	// name to register hystrix
+	// name to register hystrix - all apis of a server use the same name if breaker is shared by the server
+	breakerConfig := api.GetCircuitBreakerConfig(server)
 	commandName := api.Name
+	if breakerConfig.Scope == command.CircuitBreakerScopeServer {
+		commandName = "server__" + server.Name
+	} else if breakerConfig.Scope != command.CircuitBreakerScopeApi {
+		return nil, goxError.New("invalid circuit_breaker scope=%s for api=%s (expected api or server)", breakerConfig.Scope, api.Name)
+	}
 
 	c := &HttpHystrixCommand{
 		CrossFunction:      cf,
 		logger:             cf.Logger().Named("goxHttp").Named(api.Name),
-		command:            hc,
 		hystrixCommandName: commandName,
 		api:                api,
 		serverName:         server.Name,
 		apiName:            api.Name,
+		runtime:            runtime,
+		sharedCircuit:      breakerConfig.Scope == command.CircuitBreakerScopeServer,
 	}
+	c.UpdateCommand(hc)
 
-	// Set timeout + 10% delta
-	timeout := api.Timeout
-
-	// Add extra time to handle retry counts
-	if api.RetryCount > 0 {
-		timeout = timeout + (timeout * api.RetryCount) + api.InitialRetryWaitTimeMs
-	}
-
-	if timeout/10 <= 0 {
-		timeout += 2
-	} else {
-		timeout += timeout / 10
-	}
+	timeout := breakerTimeout(api, breakerConfig)
 
 	// Inject setting - mostly used in testing
 	config := HystrixConfigMap.StringObjectMapOrEmpty(api.Name)
@@ -183,10 +345,20 @@ func NewHttpHystrixCommand(cf gox.CrossFunction, server *command.Server, api *co
 		timeout = config.IntOrZero("timeout")
 	}
 
+	// Admission queue in front of hystrix (if any) already bounds in-flight calls to api.Concurrency. Hystrix returns
+	// its ticket asynchronously after the call completes, so we give it some room to avoid spurious rejections
+	maxConcurrentRequests := api.Concurrency
+	if c.admission.Load() != nil {
+		maxConcurrentRequests += api.QueueSize
+	}
+	timeout, maxConcurrentRequests = sharedHystrixLimits(commandName, api.Name, timeout, maxConcurrentRequests)
+	c.timeout = time.Duration(timeout) * time.Millisecond
 	hystrix.ConfigureCommand(commandName, hystrix.CommandConfig{
-		Timeout:               timeout,
-		MaxConcurrentRequests: api.Concurrency,
-		ErrorPercentThreshold: 25,
+		Timeout:                timeout,
+		MaxConcurrentRequests:  maxConcurrentRequests,
+		ErrorPercentThreshold:  breakerConfig.ErrorPercentThreshold,
+		RequestVolumeThreshold: breakerConfig.RequestVolumeThreshold,
+		SleepWindow:            breakerConfig.SleepWindowMs,
 	})
 
 	return c, nil
@@ -0,0 +1,53 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newMethodTestCommand(t *testing.T, serverUrl string, method string) (command.Command, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: method, Timeout: 1000, Concurrency: 2}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+	return NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+}
+
+func TestHttpCommand_Methods(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte(r.Method))
+		}
+	}))
+	defer ts.Close()
+
+	command.RegisterHttpMethod("custom-verb")
+	for _, method := range []string{"OPTIONS", "PURGE", "PROPFIND", "search", "CUSTOM-VERB"} {
+		cmd, err := newMethodTestCommand(t, ts.URL, method)
+		assert.NoError(t, err)
+		response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, strings.ToUpper(method), string(response.Body))
+	}
+
+	cmd, err := newMethodTestCommand(t, ts.URL, "HEAD")
+	assert.NoError(t, err)
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, response.Body)
+
+	_, err = newMethodTestCommand(t, ts.URL, "GTE")
+	assert.Error(t, err)
+}
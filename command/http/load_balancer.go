@@ -0,0 +1,264 @@
+package httpCommand
+
+import (
+	"fmt"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"go.uber.org/zap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// loadBalancer spreads requests over the endpoints of a server which runs on multiple hosts. Endpoints which fail (or
+// are slow) are ejected for some time by the outlier detector. If all endpoints are ejected then all of them are
+// used, as it is better to try than to fail every request.
+type loadBalancer struct {
+	gox.CrossFunction
+	logger          *zap.Logger
+	serverName      string
+	defaultPort     int
+	strategy        string
+	outlierDetector *outlierDetector
+
+	lock      *sync.Mutex
+	endpoints []*endpointState
+	next      int
+}
+
+// endpointState is the runtime state of one endpoint. All fields (except endpoint which never changes) are guarded by
+// the balancer lock.
+type endpointState struct {
+	endpoint    *command.Endpoint
+	outstanding int
+
+	// stats and state used by outlier detection
+	consecutive5xx             int
+	consecutiveConnectFailures int
+	requests                   int
+	latency                    time.Duration
+	ejected                    bool
+	ejectedUntil               time.Time
+	ejections                  int
+
+	// state set by active health check
+	down                 bool
+	healthCheckSuccesses int
+	healthCheckFailures  int
+	lastHealthCheck      time.Time
+	lastHealthCheckError string
+
+	// currentWeight is used by smooth weighted round-robin
+	currentWeight int
+}
+
+// newLoadBalancer creates the load balancer of a server, it returns nil if the server does not have endpoints or
+// service discovery
+func newLoadBalancer(cf gox.CrossFunction, server *command.Server) (*loadBalancer, error) {
+	if len(server.Endpoints) == 0 && server.Discovery == nil && server.Resolver == nil {
+		return nil, nil
+	}
+
+	config := server.LoadBalancer
+	if config == nil {
+		config = command.NewDefaultLoadBalancerConfig()
+	}
+	switch config.Strategy {
+	case command.LoadBalancerRoundRobin, command.LoadBalancerWeighted, command.LoadBalancerLeastOutstanding, command.LoadBalancerPowerOfTwoChoices:
+	default:
+		return nil, errors.New("invalid load_balancer strategy=%s for server=%s (expected round_robin, weighted, least_outstanding or power_of_two_choices)", config.Strategy, server.Name)
+	}
+
+	b := &loadBalancer{
+		CrossFunction:   cf,
+		logger:          cf.Logger().Named("goxHttp").Named("loadBalancer").Named(server.Name),
+		serverName:      server.Name,
+		defaultPort:     server.Port,
+		strategy:        config.Strategy,
+		outlierDetector: newOutlierDetector(server, config),
+		lock:            &sync.Mutex{},
+	}
+	if err := b.setEndpoints(server.Endpoints); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// setEndpoints replaces the endpoints (e.g. after service discovery refresh). Endpoints which are still present keep
+// their state (in-flight requests and health).
+func (b *loadBalancer) setEndpoints(endpoints []*command.Endpoint) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	existing := map[string]*endpointState{}
+	for _, state := range b.endpoints {
+		existing[state.String()] = state
+	}
+
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Host == "" {
+			return errors.New("endpoint without host in server=%s", b.serverName)
+		}
+		endpoint := *endpoint
+		if endpoint.Port == 0 {
+			endpoint.Port = b.defaultPort
+		}
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		state := &endpointState{endpoint: &endpoint}
+		if old, ok := existing[state.String()]; ok && old.endpoint.Weight == endpoint.Weight {
+			state = old
+		} else if ok {
+			state.ejected, state.ejectedUntil, state.ejections = old.ejected, old.ejectedUntil, old.ejections
+			state.down, state.healthCheckSuccesses, state.healthCheckFailures = old.down, old.healthCheckSuccesses, old.healthCheckFailures
+			state.lastHealthCheck, state.lastHealthCheckError = old.lastHealthCheck, old.lastHealthCheckError
+		}
+		states = append(states, state)
+	}
+	b.endpoints = states
+	return nil
+}
+
+// pick selects the endpoint for the next request, or nil if there is no endpoint. Endpoints in "avoid" are used only
+// if there is no other healthy endpoint. The caller must call release with the outcome of the request.
+func (b *loadBalancer) pick(avoid ...*endpointState) *endpointState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.endpoints) == 0 {
+		return nil
+	}
+
+	candidates := b.healthyEndpoints()
+	if len(avoid) > 0 {
+		if others := excludeEndpoints(candidates, avoid); len(others) > 0 {
+			candidates = others
+		}
+	}
+	var selected *endpointState
+	switch b.strategy {
+	case command.LoadBalancerWeighted:
+		selected = b.pickWeighted(candidates)
+	case command.LoadBalancerLeastOutstanding:
+		selected = b.pickLeastOutstanding(candidates)
+	case command.LoadBalancerPowerOfTwoChoices:
+		selected = b.pickPowerOfTwoChoices(candidates)
+	default:
+		selected = candidates[b.next%len(candidates)]
+		b.next++
+	}
+	selected.outstanding++
+	return selected
+}
+
+// release records the outcome of a request sent to the endpoint, and ejects the endpoint if it is an outlier
+func (b *loadBalancer) release(state *endpointState, outcome endpointOutcome, latency time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state.outstanding--
+	reason := b.outlierDetector.record(state, outcome, latency)
+	if reason == "" || state.ejected {
+		return
+	}
+
+	now := time.Now()
+	if !b.outlierDetector.canEject(b.endpoints, now) {
+		b.logger.Info("endpoint is an outlier but it is not ejected - max ejection percent reached", zap.String("endpoint", state.String()), zap.String("reason", reason))
+		return
+	}
+	duration := b.outlierDetector.eject(state, now)
+	b.logger.Warn("endpoint is ejected - it is taken out of rotation", zap.String("endpoint", state.String()), zap.String("reason", reason), zap.Duration("duration", duration))
+	if EnableGoxHttpMetricLogging {
+		b.Metric().Tagged(map[string]string{"server": b.serverName, "endpoint": state.String(), "reason": reason}).Counter("gox_http_endpoint_ejected").Inc(1)
+	}
+}
+
+// healthyEndpoints gives endpoints which are not ejected or down, or all endpoints if none is healthy. Must be called
+// with lock held.
+func (b *loadBalancer) healthyEndpoints() []*endpointState {
+	now := time.Now()
+	healthy := make([]*endpointState, 0, len(b.endpoints))
+	for _, state := range b.endpoints {
+		if state.ejected && !state.isEjected(now) {
+			state.ejected = false
+			b.logger.Info("ejected endpoint is back in rotation", zap.String("endpoint", state.String()))
+		}
+		if !state.ejected && !state.down {
+			healthy = append(healthy, state)
+		}
+	}
+	if len(healthy) == 0 {
+		return b.endpoints
+	}
+	return healthy
+}
+
+func excludeEndpoints(endpoints []*endpointState, exclude []*endpointState) []*endpointState {
+	result := make([]*endpointState, 0, len(endpoints))
+	for _, state := range endpoints {
+		excluded := false
+		for _, e := range exclude {
+			excluded = excluded || e == state
+		}
+		if !excluded {
+			result = append(result, state)
+		}
+	}
+	return result
+}
+
+// pickWeighted is the smooth weighted round-robin (as used by nginx), it spreads the requests of a heavy endpoint
+// instead of sending them in a burst
+func (b *loadBalancer) pickWeighted(candidates []*endpointState) *endpointState {
+	total := 0
+	var selected *endpointState
+	for _, state := range candidates {
+		state.currentWeight += state.endpoint.Weight
+		total += state.endpoint.Weight
+		if selected == nil || state.currentWeight > selected.currentWeight {
+			selected = state
+		}
+	}
+	selected.currentWeight -= total
+	return selected
+}
+
+// pickLeastOutstanding selects the endpoint with the least in-flight requests, ties are broken in round-robin order
+func (b *loadBalancer) pickLeastOutstanding(candidates []*endpointState) *endpointState {
+	start := b.next % len(candidates)
+	b.next++
+	selected := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		if state := candidates[(start+i)%len(candidates)]; state.outstanding < selected.outstanding {
+			selected = state
+		}
+	}
+	return selected
+}
+
+// pickPowerOfTwoChoices selects two random endpoints and uses the one with less in-flight requests
+func (b *loadBalancer) pickPowerOfTwoChoices(candidates []*endpointState) *endpointState {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	first := rand.Intn(len(candidates))
+	second := rand.Intn(len(candidates) - 1)
+	if second >= first {
+		second++
+	}
+	if candidates[second].outstanding < candidates[first].outstanding {
+		return candidates[second]
+	}
+	return candidates[first]
+}
+
+func (e *endpointState) isEjected(now time.Time) bool {
+	return e.ejected && now.Before(e.ejectedUntil)
+}
+
+func (e *endpointState) String() string {
+	return fmt.Sprintf("%s:%d", e.endpoint.Host, e.endpoint.Port)
+}
@@ -0,0 +1,129 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLoadBalancer(t *testing.T, strategy string, endpoints ...*command.Endpoint) *loadBalancer {
+	cf, _ := test.MockCf(t)
+	config := command.Config{Servers: command.Servers{"testServer": &command.Server{
+		Endpoints:    endpoints,
+		LoadBalancer: &command.LoadBalancerConfig{Strategy: strategy, UnhealthyThreshold: 2, UnhealthyDurationMs: 50},
+	}}}
+	config.SetupDefaults()
+
+	b, err := newLoadBalancer(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	return b
+}
+
+func TestLoadBalancer_Strategies(t *testing.T) {
+	countPicks := func(b *loadBalancer, picks int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < picks; i++ {
+			e := b.pick()
+			counts[e.endpoint.Host]++
+			b.release(e, endpointSuccess, time.Millisecond)
+		}
+		return counts
+	}
+
+	b := newTestLoadBalancer(t, command.LoadBalancerRoundRobin, &command.Endpoint{Host: "a"}, &command.Endpoint{Host: "b"})
+	assert.Equal(t, map[string]int{"a": 5, "b": 5}, countPicks(b, 10))
+
+	b = newTestLoadBalancer(t, command.LoadBalancerWeighted, &command.Endpoint{Host: "a", Weight: 3}, &command.Endpoint{Host: "b"})
+	assert.Equal(t, map[string]int{"a": 6, "b": 2}, countPicks(b, 8))
+
+	// Endpoint with requests in flight is not selected
+	for _, strategy := range []string{command.LoadBalancerLeastOutstanding, command.LoadBalancerPowerOfTwoChoices} {
+		b = newTestLoadBalancer(t, strategy, &command.Endpoint{Host: "a"}, &command.Endpoint{Host: "b"})
+		busy := b.pick()
+		for i := 0; i < 3; i++ {
+			e := b.pick()
+			assert.NotEqual(t, busy, e, strategy)
+			b.release(e, endpointSuccess, time.Millisecond)
+		}
+	}
+
+	_, err := newLoadBalancer(nil, &command.Server{Endpoints: []*command.Endpoint{{Host: "a"}}, LoadBalancer: &command.LoadBalancerConfig{Strategy: "random"}})
+	assert.Error(t, err)
+}
+
+func TestLoadBalancer_UnhealthyEndpoint(t *testing.T) {
+	b := newTestLoadBalancer(t, command.LoadBalancerRoundRobin, &command.Endpoint{Host: "a"}, &command.Endpoint{Host: "b"})
+
+	// Fail "a" two times in a row - it is taken out
+	for failures := 0; failures < 2; {
+		if e := b.pick(); e.endpoint.Host == "a" {
+			b.release(e, endpointServerError, time.Millisecond)
+			failures++
+		} else {
+			b.release(e, endpointSuccess, time.Millisecond)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		e := b.pick()
+		assert.Equal(t, "b", e.endpoint.Host)
+		b.release(e, endpointSuccess, time.Millisecond)
+	}
+
+	// It comes back after unhealthy duration
+	time.Sleep(60 * time.Millisecond)
+	hosts := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		e := b.pick()
+		hosts[e.endpoint.Host] = true
+		b.release(e, endpointSuccess, time.Millisecond)
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, hosts)
+}
+
+func TestHttpCommand_LoadBalancer(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var healthyCount, failingCount int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&healthyCount, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingCount, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	endpoint := func(serverUrl string) *command.Endpoint {
+		u, _ := url.Parse(serverUrl)
+		port, _ := strconv.Atoi(u.Port())
+		return &command.Endpoint{Host: u.Hostname(), Port: port}
+	}
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{
+			Endpoints:    []*command.Endpoint{endpoint(healthy.URL), endpoint(failing.URL)},
+			LoadBalancer: &command.LoadBalancerConfig{UnhealthyThreshold: 2, UnhealthyDurationMs: 60000},
+		}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, _ = cmd.Execute(context.Background(), &command.GoxRequest{})
+	}
+
+	// Failing endpoint is taken out after 2 failures
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failingCount))
+	assert.Equal(t, int32(8), atomic.LoadInt32(&healthyCount))
+}
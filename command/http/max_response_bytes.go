@@ -0,0 +1,76 @@
+package httpCommand
+
+import (
+	"fmt"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"io"
+	"net/http"
+)
+
+// responseTooLargeError is given when the response body is larger than max_response_bytes of the api
+type responseTooLargeError struct {
+	limit int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response body is larger than max_response_bytes=%d", e.limit)
+}
+
+// maxResponseBytesTransport fails a response which has a body larger than the limit - at once if Content-Length is
+// more than the limit, otherwise when the body is read beyond the limit. It works for buffered and stream requests,
+// and a large body is never read in memory.
+type maxResponseBytesTransport struct {
+	next  http.RoundTripper
+	limit int64
+}
+
+func (t *maxResponseBytesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(req)
+	if err != nil || response.Body == nil {
+		return response, err
+	}
+	if response.ContentLength > t.limit {
+		_ = response.Body.Close()
+		return nil, &responseTooLargeError{limit: t.limit}
+	}
+	response.Body = &limitedBody{ReadCloser: response.Body, limit: t.limit, remaining: t.limit}
+	return response, nil
+}
+
+// limitedBody gives an error when more than limit bytes are read (like http.MaxBytesReader does for a request body)
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, &responseTooLargeError{limit: b.limit}
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+	n, b.remaining = int(b.remaining), -1
+	return n, &responseTooLargeError{limit: b.limit}
+}
+
+func isResponseTooLargeError(err error) bool {
+	var e *responseTooLargeError
+	return err != nil && errors.As(err, &e)
+}
+
+func newResponseTooLargeError(err error) *command.GoxHttpError {
+	return &command.GoxHttpError{
+		Err:        err,
+		StatusCode: http.StatusBadGateway,
+		Message:    "response body is larger than max_response_bytes",
+		ErrorCode:  command.ErrorCodeResponseTooLarge,
+	}
+}
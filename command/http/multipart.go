@@ -0,0 +1,179 @@
+package httpCommand
+
+import (
+	"crypto/sha256"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+var errMultipartBodyRewound = errors.New("multipart body is rewound to send it again")
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody is a multipart/form-data body which is written to the request while it is sent (through a pipe), so a
+// file is never read in memory. It is rewound (readers are seeked back) to send it again on retry.
+type multipartBody struct {
+	parts    []*command.MultipartPart
+	offsets  []int64
+	boundary string
+
+	lock   *sync.Mutex
+	reader *io.PipeReader
+	done   chan struct{}
+}
+
+func newMultipartBody(parts []*command.MultipartPart) (*multipartBody, error) {
+	b := &multipartBody{
+		parts:    parts,
+		offsets:  make([]int64, len(parts)),
+		boundary: multipart.NewWriter(nil).Boundary(),
+		lock:     &sync.Mutex{},
+	}
+	for i, part := range parts {
+		if part == nil || part.Name == "" || part.Reader == nil {
+			return nil, errors.New("multipart part must have a name and a reader: index=%d", i)
+		}
+		b.offsets[i] = -1
+		if seeker, ok := part.Reader.(io.Seeker); ok {
+			offset, err := seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get position of reader of multipart part=%s", part.Name)
+			}
+			b.offsets[i] = offset
+		}
+	}
+	return b, nil
+}
+
+// ContentType is multipart/form-data with the boundary of this body
+func (b *multipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	if b.reader == nil {
+		reader, writer := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = writer.CloseWithError(b.writeTo(writer))
+		}()
+		b.reader, b.done = reader, done
+	}
+	reader := b.reader
+	b.lock.Unlock()
+	return reader.Read(p)
+}
+
+// Close is called by the http client when the request is done, it stops the writer if the body was not sent fully
+func (b *multipartBody) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reader != nil {
+		_ = b.reader.Close()
+	}
+	return nil
+}
+
+// Sha256 gives the digest of the body, it reads all parts once and seeks them back (so it does not keep the body in
+// memory). It is used by the hmac interceptor before the request is sent.
+func (b *multipartBody) Sha256() ([]byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reader != nil {
+		return nil, errors.New("digest of multipart body is not available after it is sent")
+	} else if !b.replayable() {
+		return nil, errors.New("digest of multipart body needs the reader of every part to be an io.Seeker")
+	}
+
+	hash := sha256.New()
+	if err := b.writeTo(hash); err != nil {
+		return nil, err
+	}
+	if err := b.seekToStart(); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// rewind makes the body ready to be sent again, it is a no-op if the body is not read yet
+func (b *multipartBody) rewind() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.reader == nil {
+		return nil
+	}
+	_ = b.reader.CloseWithError(errMultipartBodyRewound)
+	<-b.done
+	b.reader, b.done = nil, nil
+	if !b.replayable() {
+		return errors.New("multipart body cannot be sent again - the reader of every part must be an io.Seeker")
+	}
+	return b.seekToStart()
+}
+
+// replayable checks if all parts can be read again
+func (b *multipartBody) replayable() bool {
+	for _, offset := range b.offsets {
+		if offset < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *multipartBody) seekToStart() error {
+	for i, part := range b.parts {
+		if _, err := part.Reader.(io.Seeker).Seek(b.offsets[i], io.SeekStart); err != nil {
+			return errors.Wrap(err, "failed to seek reader of multipart part=%s", part.Name)
+		}
+	}
+	return nil
+}
+
+func (b *multipartBody) writeTo(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+	for _, part := range b.parts {
+		header := textproto.MIMEHeader{}
+		for name, values := range part.Header {
+			header[name] = values
+		}
+		disposition := `form-data; name="` + quoteEscaper.Replace(part.Name) + `"`
+		if part.FileName != "" {
+			disposition += `; filename="` + quoteEscaper.Replace(part.FileName) + `"`
+		}
+		header.Set("Content-Disposition", disposition)
+		if part.ContentType != "" {
+			header.Set("Content-Type", part.ContentType)
+		} else if part.FileName != "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(partWriter, part.Reader); err != nil {
+			return errors.Wrap(err, "failed to write multipart part=%s", part.Name)
+		}
+	}
+	return writer.Close()
+}
+
+// canResend checks if the body of the request can be sent again - a multipart body needs io.Seeker readers
+func canResend(r *resty.Request) bool {
+	if body, ok := r.Body.(*multipartBody); ok {
+		return body.replayable()
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package httpCommand
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// multipartServer gives "<name>=<filename>:<content-type>:<content>" for every part of the request
+func multipartServer(t *testing.T, calls *int32, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		reader, err := r.MultipartReader()
+		if !assert.NoError(t, err) {
+			return
+		}
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			} else if !assert.NoError(t, err) {
+				return
+			}
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.FormName()+"="+part.FileName()+":"+part.Header.Get("Content-Type")+":"+string(data))
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(strings.Join(parts, "\n")))
+	}))
+}
+
+func TestHttpCommand_Multipart(t *testing.T) {
+	var calls int32
+	ts := multipartServer(t, &calls, http.StatusOK)
+	defer ts.Close()
+
+	cmd := newRetryTestCommand(t, ts.URL, "POST", nil)
+	request := command.NewGoxRequestBuilder("api").
+		WithFormField("title", "report").
+		WithFormField("pages", 3).
+		WithFile("file", "report.csv", io.NopCloser(strings.NewReader("a,b\n1,2"))).
+		WithMultipartPart(&command.MultipartPart{Name: "meta", ContentType: "application/json", Reader: strings.NewReader(`{"v":1}`)}).
+		Build()
+	response, err := cmd.Execute(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "title=::report\npages=::3\nfile=report.csv:application/octet-stream:a,b\n1,2\nmeta=:application/json:{\"v\":1}", string(response.Body))
+
+	// A part without reader fails the request before it is sent
+	_, err = cmd.Execute(context.Background(), command.NewGoxRequestBuilder("api").WithMultipartPart(&command.MultipartPart{Name: "file"}).Build())
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.Equal(t, command.ErrorCodeFailedToBuildRequest, goxErr.ErrorCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_Multipart_Retry(t *testing.T) {
+	var calls int32
+	ts := multipartServer(t, &calls, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	// Seekable reader is sent again on retry
+	cmd := newRetryTestCommand(t, ts.URL, "PUT", newRetryTestConfig())
+	response, err := cmd.Execute(context.Background(), command.NewGoxRequestBuilder("api").WithFile("file", "a.txt", strings.NewReader("data")).Build())
+	assert.Error(t, err)
+	assert.Equal(t, "file=a.txt:application/octet-stream:data", string(response.Body))
+	assert.Equal(t, 3, response.Attempts)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Reader which is not seekable is sent only once
+	atomic.StoreInt32(&calls, 0)
+	response, err = cmd.Execute(context.Background(), command.NewGoxRequestBuilder("api").WithFile("file", "a.txt", io.NopCloser(strings.NewReader("data"))).Build())
+	assert.Error(t, err)
+	assert.Equal(t, 1, response.Attempts)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMultipartBody_Sha256(t *testing.T) {
+	reader := strings.NewReader("data")
+	body, err := newMultipartBody([]*command.MultipartPart{{Name: "file", FileName: "a.txt", Reader: reader}})
+	assert.NoError(t, err)
+
+	digest, err := body.Sha256()
+	assert.NoError(t, err)
+	assert.Len(t, digest, 32)
+	assert.Equal(t, 4, reader.Len())
+
+	// Digest is the digest of the body which is sent
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(data)
+	assert.Equal(t, sum[:], digest)
+	again, err := body.Sha256()
+	assert.Error(t, err)
+	assert.Nil(t, again)
+
+	body, err = newMultipartBody([]*command.MultipartPart{{Name: "file", Reader: io.NopCloser(strings.NewReader("data"))}})
+	assert.NoError(t, err)
+	_, err = body.Sha256()
+	assert.Error(t, err)
+}
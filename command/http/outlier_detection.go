@@ -0,0 +1,126 @@
+package httpCommand
+
+import (
+	"github.com/devlibx/gox-http/v4/command"
+	"time"
+)
+
+// endpointOutcome is the result of a request sent to an endpoint
+type endpointOutcome int
+
+const (
+	endpointSuccess endpointOutcome = iota
+	endpointServerError
+	endpointConnectFailure
+
+	// endpointCancelled is a request cancelled by the caller, it does not count for or against the endpoint
+	endpointCancelled
+)
+
+// outlierDetector finds endpoints which are failing or slow, so that the load balancer can eject them (Envoy style
+// passive outlier detection). It has no lock of its own, all methods are called with the load balancer lock held.
+type outlierDetector struct {
+	consecutive5xx             int
+	consecutiveConnectFailures int
+	latencyThreshold           time.Duration
+	minRequests                int
+	baseEjectionTime           time.Duration
+	maxEjectionTime            time.Duration
+	maxEjectionPercent         int
+}
+
+// newOutlierDetector creates the detector from outlier_detection config of the server. Without it, the
+// unhealthy_threshold and unhealthy_duration_ms of load balancer are used - with a fixed ejection time and no limit
+// on ejected endpoints.
+func newOutlierDetector(server *command.Server, loadBalancerConfig *command.LoadBalancerConfig) *outlierDetector {
+	if config := server.OutlierDetection; config != nil {
+		return &outlierDetector{
+			consecutive5xx:             config.Consecutive5xx,
+			consecutiveConnectFailures: config.ConsecutiveConnectFailures,
+			latencyThreshold:           time.Duration(config.LatencyThresholdMs) * time.Millisecond,
+			minRequests:                config.MinRequests,
+			baseEjectionTime:           time.Duration(config.BaseEjectionTimeMs) * time.Millisecond,
+			maxEjectionTime:            time.Duration(config.MaxEjectionTimeMs) * time.Millisecond,
+			maxEjectionPercent:         config.MaxEjectionPercent,
+		}
+	}
+	unhealthyDuration := time.Duration(loadBalancerConfig.UnhealthyDurationMs) * time.Millisecond
+	return &outlierDetector{
+		consecutive5xx:             loadBalancerConfig.UnhealthyThreshold,
+		consecutiveConnectFailures: loadBalancerConfig.UnhealthyThreshold,
+		baseEjectionTime:           unhealthyDuration,
+		maxEjectionTime:            unhealthyDuration,
+		maxEjectionPercent:         100,
+	}
+}
+
+// record updates the stats of the endpoint with the outcome of a request. It returns the reason to eject the endpoint,
+// or empty string if endpoint is fine.
+func (d *outlierDetector) record(state *endpointState, outcome endpointOutcome, latency time.Duration) string {
+	switch outcome {
+	case endpointCancelled:
+		return ""
+	case endpointServerError:
+		state.consecutive5xx++
+		state.consecutiveConnectFailures = 0
+	case endpointConnectFailure:
+		state.consecutiveConnectFailures++
+		state.consecutive5xx = 0
+	default:
+		state.consecutive5xx = 0
+		state.consecutiveConnectFailures = 0
+	}
+
+	// Average latency (exponentially weighted, so that recent requests count more)
+	if state.requests == 0 {
+		state.latency = latency
+	} else {
+		state.latency = (3*latency + 7*state.latency) / 10
+	}
+	state.requests++
+
+	switch {
+	case d.consecutive5xx > 0 && state.consecutive5xx >= d.consecutive5xx:
+		return "consecutive_5xx"
+	case d.consecutiveConnectFailures > 0 && state.consecutiveConnectFailures >= d.consecutiveConnectFailures:
+		return "consecutive_connect_failures"
+	case d.latencyThreshold > 0 && state.requests >= d.minRequests && state.latency > d.latencyThreshold:
+		return "latency"
+	}
+	return ""
+}
+
+// canEject checks if one more endpoint can be ejected without going over max_ejection_percent
+func (d *outlierDetector) canEject(endpoints []*endpointState, now time.Time) bool {
+	ejected := 0
+	for _, state := range endpoints {
+		if state.isEjected(now) {
+			ejected++
+		}
+	}
+	return ejected == 0 || (ejected+1)*100 <= d.maxEjectionPercent*len(endpoints)
+}
+
+// eject takes the endpoint out, and gives the time for which it is ejected. The time doubles with every ejection, and
+// it is reset if the endpoint was fine for max ejection time after the last ejection.
+func (d *outlierDetector) eject(state *endpointState, now time.Time) time.Duration {
+	if now.Sub(state.ejectedUntil) > d.maxEjectionTime {
+		state.ejections = 0
+	}
+	duration := d.baseEjectionTime
+	for i := 0; i < state.ejections && duration < d.maxEjectionTime; i++ {
+		duration *= 2
+	}
+	if duration > d.maxEjectionTime {
+		duration = d.maxEjectionTime
+	}
+
+	state.ejections++
+	state.ejected = true
+	state.ejectedUntil = now.Add(duration)
+	state.consecutive5xx = 0
+	state.consecutiveConnectFailures = 0
+	state.requests = 0
+	state.latency = 0
+	return duration
+}
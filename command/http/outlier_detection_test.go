@@ -0,0 +1,103 @@
+package httpCommand
+
+import (
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newOutlierTestLoadBalancer(t *testing.T, outlierDetection *command.OutlierDetectionConfig, hosts ...string) *loadBalancer {
+	cf, _ := test.MockCf(t)
+	server := &command.Server{Name: "testServer", OutlierDetection: outlierDetection}
+	for _, host := range hosts {
+		server.Endpoints = append(server.Endpoints, &command.Endpoint{Host: host})
+	}
+	config := command.Config{Servers: command.Servers{"testServer": server}}
+	config.SetupDefaults()
+
+	b, err := newLoadBalancer(cf, server)
+	assert.NoError(t, err)
+	return b
+}
+
+// sendTo picks endpoints until the given host is selected, and records the outcome for it
+func sendTo(b *loadBalancer, host string, outcome endpointOutcome, latency time.Duration) {
+	for {
+		e := b.pick()
+		if e.endpoint.Host == host {
+			b.release(e, outcome, latency)
+			return
+		}
+		b.release(e, endpointCancelled, 0)
+	}
+}
+
+func healthyHosts(b *loadBalancer) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var hosts []string
+	for _, e := range b.healthyEndpoints() {
+		hosts = append(hosts, e.endpoint.Host)
+	}
+	return hosts
+}
+
+func TestOutlierDetection_ConsecutiveFailures(t *testing.T) {
+	b := newOutlierTestLoadBalancer(t, &command.OutlierDetectionConfig{Consecutive5xx: 3, ConsecutiveConnectFailures: 2, BaseEjectionTimeMs: 60000}, "a", "b", "c", "d")
+
+	// Success in between resets the count
+	sendTo(b, "a", endpointServerError, time.Millisecond)
+	sendTo(b, "a", endpointServerError, time.Millisecond)
+	sendTo(b, "a", endpointSuccess, time.Millisecond)
+	sendTo(b, "a", endpointServerError, time.Millisecond)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, healthyHosts(b))
+
+	// Cancelled requests do not count
+	sendTo(b, "a", endpointCancelled, time.Millisecond)
+	sendTo(b, "a", endpointServerError, time.Millisecond)
+	sendTo(b, "a", endpointServerError, time.Millisecond)
+	assert.Equal(t, []string{"b", "c", "d"}, healthyHosts(b))
+
+	sendTo(b, "b", endpointConnectFailure, time.Millisecond)
+	sendTo(b, "b", endpointConnectFailure, time.Millisecond)
+	assert.Equal(t, []string{"c", "d"}, healthyHosts(b))
+
+	// Max 50% endpoints can be ejected
+	sendTo(b, "c", endpointConnectFailure, time.Millisecond)
+	sendTo(b, "c", endpointConnectFailure, time.Millisecond)
+	assert.Equal(t, []string{"c", "d"}, healthyHosts(b))
+}
+
+func TestOutlierDetection_Latency(t *testing.T) {
+	b := newOutlierTestLoadBalancer(t, &command.OutlierDetectionConfig{LatencyThresholdMs: 100, MinRequests: 3}, "a", "b")
+
+	sendTo(b, "a", endpointSuccess, 500*time.Millisecond)
+	sendTo(b, "a", endpointSuccess, 500*time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, healthyHosts(b))
+	sendTo(b, "a", endpointSuccess, 500*time.Millisecond)
+	assert.Equal(t, []string{"b"}, healthyHosts(b))
+
+	// Fast endpoint is not ejected
+	for i := 0; i < 5; i++ {
+		sendTo(b, "b", endpointSuccess, 10*time.Millisecond)
+	}
+	assert.Equal(t, []string{"b"}, healthyHosts(b))
+}
+
+func TestOutlierDetection_EjectionTimeGrows(t *testing.T) {
+	detector := &outlierDetector{baseEjectionTime: 10 * time.Second, maxEjectionTime: 35 * time.Second}
+	state := &endpointState{}
+
+	now := time.Now()
+	assert.Equal(t, 10*time.Second, detector.eject(state, now))
+	now = state.ejectedUntil.Add(time.Second)
+	assert.Equal(t, 20*time.Second, detector.eject(state, now))
+	now = state.ejectedUntil.Add(time.Second)
+	assert.Equal(t, 35*time.Second, detector.eject(state, now))
+
+	// Endpoint was fine for a long time - ejection time starts from base again
+	now = state.ejectedUntil.Add(time.Minute)
+	assert.Equal(t, 10*time.Second, detector.eject(state, now))
+}
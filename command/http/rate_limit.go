@@ -0,0 +1,242 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errRateLimited = errors.New("rate limited")
+
+// maxRateLimitPause caps the pause asked by a server with Retry-After or X-RateLimit-Reset header
+const maxRateLimitPause = time.Minute
+
+// rateLimiter is a token bucket which allows "rps" requests per second with bursts of up to "burst" requests. The
+// server can also pause it for some time (Retry-After or X-RateLimit-* headers) if adapt_to_headers is enabled.
+//
+// All methods are safe to call on a nil limiter (no rate limit configured), in this case requests are always allowed.
+type rateLimiter struct {
+	lock           *sync.Mutex
+	rps            float64
+	burst          float64
+	reject         bool
+	adaptToHeaders bool
+
+	// tokens is the number of tokens at time "last" - it goes below 0 when requests are waiting for a token, and
+	// "last" is in future when the limiter is paused
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(config *command.RateLimitConfig) *rateLimiter {
+	if config == nil || config.Rps <= 0 {
+		return nil
+	}
+	burst := float64(config.Burst)
+	if burst < 1 {
+		burst = max(1, config.Rps)
+	}
+	return &rateLimiter{
+		lock:           &sync.Mutex{},
+		rps:            config.Rps,
+		burst:          burst,
+		reject:         config.Mode == command.RateLimitModeReject,
+		adaptToHeaders: config.AdaptToHeaders,
+		tokens:         burst,
+		last:           time.Now(),
+	}
+}
+
+// refill adds tokens for the time passed since last refill. Must be called with lock held.
+func (l *rateLimiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+		l.last = now
+	}
+}
+
+// tryTake takes a token only if one is available now, it never waits
+func (l *rateLimiter) tryTake() bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.refill(now)
+	if !l.last.After(now) && l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	return false
+}
+
+// reserve takes a token which may become available in future, and gives the time to wait for it. Nothing is taken
+// if the token is not available before the deadline of the context.
+func (l *rateLimiter) reserve(ctx context.Context) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.refill(now)
+
+	ready := l.last
+	if l.tokens < 1 {
+		ready = ready.Add(time.Duration((1 - l.tokens) / l.rps * float64(time.Second)))
+	}
+	if deadline, ok := ctx.Deadline(); ok && ready.After(deadline) {
+		return 0, false
+	}
+	l.tokens--
+	return ready.Sub(now), true
+}
+
+// cancel gives back a token which was reserved but not used
+func (l *rateLimiter) cancel() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tokens = min(l.burst, l.tokens+1)
+}
+
+// take gets a token for a request - it fails at once in reject mode, otherwise it waits for a token as long as the
+// context allows
+func (l *rateLimiter) take(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if l.reject {
+		if l.tryTake() {
+			return nil
+		}
+		return newRateLimitedError("request rejected - rate limit is exceeded")
+	}
+
+	wait, ok := l.reserve(ctx)
+	if !ok {
+		return newRateLimitedError("request rejected - rate limit will not allow it before the deadline")
+	}
+	if !sleepWithContext(ctx, wait) {
+		l.cancel()
+		return &command.GoxHttpError{
+			Err:        ctx.Err(),
+			StatusCode: http.StatusRequestTimeout,
+			Message:    "request timeout on client while waiting for rate limit",
+			ErrorCode:  "request_timeout_on_client",
+		}
+	}
+	return nil
+}
+
+// pause stops new requests till the given time, and then requests start again at the normal rate (no burst)
+func (l *rateLimiter) pause(until time.Time) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if until = minTime(until, time.Now().Add(maxRateLimitPause)); until.After(l.last) {
+		l.refill(until)
+		l.tokens = min(l.tokens, 0)
+		l.last = until
+	}
+}
+
+// adapt pauses the limiter if the response says that the rate limit of the server is used up
+func (l *rateLimiter) adapt(response *resty.Response) {
+	if l == nil || !l.adaptToHeaders || response == nil {
+		return
+	}
+	if until, ok := rateLimitResetTime(response.StatusCode(), response.Header(), time.Now()); ok {
+		l.pause(until)
+	}
+}
+
+// rateLimitResetTime reads the time till which the server does not want more requests:
+// 1. Retry-After header of a 429 or 503 response
+// 2. X-RateLimit-Reset header if X-RateLimit-Remaining is 0 - it can be seconds to wait, or unix time in seconds
+func rateLimitResetTime(statusCode int, header http.Header, now time.Time) (time.Time, bool) {
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(header); ok {
+			return now.Add(wait), true
+		}
+	}
+	if header == nil || strings.TrimSpace(header.Get("X-RateLimit-Remaining")) != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(strings.TrimSpace(header.Get("X-RateLimit-Reset")), 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}, false
+	}
+	if reset > int64(365*24*time.Hour/time.Second) {
+		return time.Unix(reset, 0), true
+	}
+	return now.Add(time.Duration(reset) * time.Second), true
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func newRateLimitedError(message string) error {
+	return &command.GoxHttpError{
+		Err:        errRateLimited,
+		StatusCode: http.StatusTooManyRequests,
+		Message:    message,
+		ErrorCode:  command.ErrorCodeRateLimited,
+	}
+}
+
+// isRateLimitedError is true if request was not sent due to client side rate limit, it does not count as a failure
+// of the server (e.g. in circuit breaker)
+func isRateLimitedError(err error) bool {
+	var e *command.GoxHttpError
+	return errors.As(err, &e) && e.IsRateLimitedError()
+}
+
+// takeRateLimit gets a token from the rate limit of the api and of the server before an attempt is sent
+func (h *HttpCommand) takeRateLimit(ctx context.Context) error {
+	if err := h.rateLimiter.take(ctx); err != nil {
+		h.reportRateLimited("api")
+		return err
+	}
+	if err := h.serverRateLimiter.take(ctx); err != nil {
+		h.rateLimiter.cancel()
+		h.reportRateLimited("server")
+		return err
+	}
+	return nil
+}
+
+// tryTakeRateLimit is same as takeRateLimit, but it never waits (used for hedged attempts)
+func (h *HttpCommand) tryTakeRateLimit() bool {
+	if !h.rateLimiter.tryTake() {
+		return false
+	} else if !h.serverRateLimiter.tryTake() {
+		h.rateLimiter.cancel()
+		return false
+	}
+	return true
+}
+
+// adaptRateLimit lets the rate limits of the api and of the server follow the rate limit headers of the response
+func (h *HttpCommand) adaptRateLimit(response *resty.Response) {
+	h.rateLimiter.adapt(response)
+	h.serverRateLimiter.adapt(response)
+}
+
+func (h *HttpCommand) reportRateLimited(scope string) {
+	if EnableGoxHttpMetricLogging {
+		h.Metric().Tagged(map[string]string{"server": h.server.Name, "api": h.api.Name, "scope": scope}).Counter("gox_http_rate_limited").Inc(1)
+	}
+}
@@ -0,0 +1,146 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reject(t *testing.T) {
+	limiter := newRateLimiter(&command.RateLimitConfig{Rps: 10, Burst: 2, Mode: command.RateLimitModeReject})
+
+	// Burst is allowed at once, then one token every 100ms
+	assert.NoError(t, limiter.take(context.Background()))
+	assert.NoError(t, limiter.take(context.Background()))
+	err := limiter.take(context.Background())
+	assert.True(t, isRateLimitedError(err))
+
+	time.Sleep(120 * time.Millisecond)
+	assert.NoError(t, limiter.take(context.Background()))
+
+	// Nil limiter always allows
+	var noLimit *rateLimiter
+	assert.NoError(t, noLimit.take(context.Background()))
+	assert.True(t, noLimit.tryTake())
+	assert.Nil(t, newRateLimiter(&command.RateLimitConfig{Rps: 0}))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := newRateLimiter(&command.RateLimitConfig{Rps: 20, Burst: 1, Mode: command.RateLimitModeWait})
+
+	// 3 requests with 1 burst and 20 rps take ~100ms
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.take(context.Background()))
+	}
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	// Fails at once if the token is not available before the deadline (and the token is not used up)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err := limiter.take(ctx)
+	assert.True(t, isRateLimitedError(err))
+	assert.True(t, time.Since(start) < 10*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, limiter.tryTake())
+}
+
+func TestRateLimitResetTime(t *testing.T) {
+	now := time.Now()
+
+	until, ok := rateLimitResetTime(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"2"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(2*time.Second), until)
+
+	// Retry-After is used only with 429/503
+	_, ok = rateLimitResetTime(http.StatusOK, http.Header{"Retry-After": []string{"2"}}, now)
+	assert.False(t, ok)
+
+	// Reset in seconds or as unix time
+	until, ok = rateLimitResetTime(http.StatusOK, http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"3"}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(3*time.Second), until)
+	reset := now.Add(time.Minute).Unix()
+	until, ok = rateLimitResetTime(http.StatusOK, http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{strconv.FormatInt(reset, 10)}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(reset, 0), until)
+
+	_, ok = rateLimitResetTime(http.StatusOK, http.Header{"X-Ratelimit-Remaining": []string{"5"}, "X-Ratelimit-Reset": []string{"3"}}, now)
+	assert.False(t, ok)
+}
+
+func newRateLimitTestCommand(t *testing.T, serverUrl string, serverLimit *command.RateLimitConfig, apiLimit *command.RateLimitConfig) command.Command {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{RateLimit: serverLimit}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: "GET", Timeout: 1000, Concurrency: 10, RateLimit: apiLimit}},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	return cmd
+}
+
+func TestHttpCommand_RateLimit(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+
+	// Api allows 2 calls at once - the server limit is higher
+	cmd := newRateLimitTestCommand(t, ts.URL,
+		&command.RateLimitConfig{Rps: 100, Burst: 10},
+		&command.RateLimitConfig{Rps: 1, Burst: 2, Mode: command.RateLimitModeReject},
+	)
+	for i := 0; i < 2; i++ {
+		_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+		assert.NoError(t, err)
+	}
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsRateLimitedError())
+	assert.Equal(t, http.StatusTooManyRequests, goxErr.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHttpCommand_RateLimit_AdaptToHeaders(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	cmd := newRateLimitTestCommand(t, ts.URL, &command.RateLimitConfig{Rps: 100, Burst: 10, Mode: command.RateLimitModeWait, AdaptToHeaders: true}, nil)
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+
+	// Server asked to wait for 1 sec - this call can not wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = cmd.Execute(ctx, &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsRateLimitedError())
+
+	// This one waits till the pause is over
+	start := time.Now()
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 700*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,55 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHttpCommand_ResponseMetadata(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Add("Link", `</new?page=2>; rel="next"`)
+		_, _ = w.Write([]byte("data"))
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	defer ts.Close()
+
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/old", Method: "GET", Timeout: 1000, Concurrency: 2,
+			Retry: &command.RetryConfig{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusServiceUnavailable}},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(response.Body))
+	assert.Equal(t, `"v1"`, response.Header.Get("ETag"))
+	assert.Equal(t, `</new?page=2>; rel="next"`, response.Header.Get("Link"))
+	assert.Equal(t, "abc", response.Trailer.Get("X-Checksum"))
+	assert.Equal(t, ts.URL+"/new", response.Url)
+	assert.Equal(t, "HTTP/1.1", response.Proto)
+	assert.Equal(t, 2, response.Attempts)
+	assert.True(t, response.Latency > 0)
+}
@@ -0,0 +1,252 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryAttempt has the details of a failed attempt, which is given to RetryPolicy to decide if we should retry
+type RetryAttempt struct {
+	Api     *command.Api
+	Method  string
+	Request *command.GoxRequest
+
+	// Attempt is the number of the attempt which failed, starting with 1
+	Attempt int
+
+	// StatusCode and Header of the response - StatusCode is 0 if we did not get a response (Err is set in this case)
+	StatusCode int
+	Header     http.Header
+	Err        error
+
+	// PreviousWait is the wait time before this attempt (0 for the first attempt)
+	PreviousWait time.Duration
+
+	// Deadline is the deadline of the request (zero if it has none) - a retry after it can not be sent
+	Deadline time.Time
+}
+
+// RetryPolicy decides if a failed attempt should be retried, and how long to wait before the next attempt
+type RetryPolicy interface {
+	// ShouldRetry returns true and the time to wait, if the request should be tried again
+	ShouldRetry(attempt *RetryAttempt) (bool, time.Duration)
+}
+
+// RetryPolicyFunc is a func which implements RetryPolicy
+type RetryPolicyFunc func(attempt *RetryAttempt) (bool, time.Duration)
+
+func (f RetryPolicyFunc) ShouldRetry(attempt *RetryAttempt) (bool, time.Duration) {
+	return f(attempt)
+}
+
+var retryPolicyMap = make(map[string]RetryPolicy, 0)
+var retryPolicyMapMutex = &sync.RWMutex{}
+
+// RegisterRetryPolicy registers a custom retry policy, which is used by apis with "retry.policy=<id>"
+func RegisterRetryPolicy(id string, policy RetryPolicy) {
+	retryPolicyMapMutex.Lock()
+	defer retryPolicyMapMutex.Unlock()
+	retryPolicyMap[id] = policy
+}
+
+func UnregisterRetryPolicy(id string) {
+	retryPolicyMapMutex.Lock()
+	defer retryPolicyMapMutex.Unlock()
+	delete(retryPolicyMap, id)
+}
+
+// NewRetryPolicy gives the retry policy of the api:
+// 1. custom policy if "retry.policy" is set
+// 2. policy built from the "retry" block
+// 3. old behaviour (retry_count) - retry any error or any status which is not acceptable
+func NewRetryPolicy(api *command.Api) (RetryPolicy, error) {
+	if api.Retry == nil {
+		return &legacyRetryPolicy{api: api}, nil
+	}
+
+	if api.Retry.Policy != "" {
+		retryPolicyMapMutex.RLock()
+		policy, ok := retryPolicyMap[api.Retry.Policy]
+		retryPolicyMapMutex.RUnlock()
+		if !ok {
+			return nil, errors.New("retry policy is not registered: policy=%s, api=%s", api.Retry.Policy, api.Name)
+		}
+		return policy, nil
+	}
+
+	switch api.Retry.Backoff {
+	case "", "constant", "exponential", "decorrelated_jitter":
+	default:
+		return nil, errors.New("invalid retry backoff=%s for api=%s (expected constant, exponential or decorrelated_jitter)", api.Retry.Backoff, api.Name)
+	}
+	for _, e := range api.Retry.RetryableErrors {
+		if e != "timeout" && e != "connection" {
+			return nil, errors.New("invalid retryable error=%s for api=%s (expected timeout or connection)", e, api.Name)
+		}
+	}
+	return &configRetryPolicy{config: api.Retry}, nil
+}
+
+// configRetryPolicy is the retry policy built from the "retry" block of an api
+type configRetryPolicy struct {
+	config *command.RetryConfig
+}
+
+func (p *configRetryPolicy) ShouldRetry(attempt *RetryAttempt) (bool, time.Duration) {
+	if attempt.Attempt >= p.config.MaxAttempts {
+		return false, 0
+	}
+	if p.config.IdempotentOnly && !isIdempotent(attempt.Method, attempt.Request) {
+		return false, 0
+	}
+
+	if attempt.Err != nil {
+		if !p.isRetryableError(attempt.Err) {
+			return false, 0
+		}
+	} else if !p.isRetryableStatus(attempt.StatusCode) {
+		return false, 0
+	}
+
+	// Server asked us to wait - if the request can not wait that long then give up, instead of retrying early
+	if p.config.RespectRetryAfter {
+		if wait, ok := parseRetryAfter(attempt.Header); ok {
+			if !attempt.Deadline.IsZero() && time.Until(attempt.Deadline) < wait {
+				return false, 0
+			}
+			return true, wait
+		}
+	}
+	return true, p.backoff(attempt)
+}
+
+func (p *configRetryPolicy) backoff(attempt *RetryAttempt) time.Duration {
+	initial := time.Duration(p.config.InitialBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(p.config.MaxBackoffMs) * time.Millisecond
+
+	var wait time.Duration
+	switch p.config.Backoff {
+	case "constant":
+		wait = initial
+	case "decorrelated_jitter":
+		// wait = random between initial and 3 * previous wait
+		prev := attempt.PreviousWait
+		if prev < initial {
+			prev = initial
+		}
+		wait = initial + time.Duration(rand.Int63n(int64(3*prev-initial)+1))
+	default:
+		// exponential with full jitter on the upper half
+		wait = initial << (attempt.Attempt - 1)
+		if wait <= 0 || wait > maxBackoff {
+			wait = maxBackoff
+		}
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+func (p *configRetryPolicy) isRetryableStatus(code int) bool {
+	for _, c := range p.config.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *configRetryPolicy) isRetryableError(err error) bool {
+	class := "connection"
+	var e net.Error
+	if errors.As(err, &e) && e.Timeout() {
+		class = "timeout"
+	}
+	for _, c := range p.config.RetryableErrors {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyRetryPolicy keeps the behaviour of retry_count - retry any error or status which is not acceptable, with
+// exponential backoff starting from retry_initial_wait_time_ms
+type legacyRetryPolicy struct {
+	api *command.Api
+}
+
+func (p *legacyRetryPolicy) ShouldRetry(attempt *RetryAttempt) (bool, time.Duration) {
+	if attempt.Attempt > p.api.RetryCount {
+		return false, 0
+	}
+	if attempt.Err == nil && p.api.IsHttpCodeAcceptable(attempt.StatusCode) {
+		return false, 0
+	}
+
+	initial := 100 * time.Millisecond
+	if p.api.InitialRetryWaitTimeMs > 0 {
+		initial = time.Duration(p.api.InitialRetryWaitTimeMs) * time.Millisecond
+	}
+	wait := initial << (attempt.Attempt - 1)
+	if wait <= 0 || wait > 2*time.Second {
+		wait = 2 * time.Second
+	}
+	return true, wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// isIdempotent returns true for idempotent methods, or if the caller marked the request with an Idempotency-Key
+func isIdempotent(method string, request *command.GoxRequest) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return request != nil && request.Header != nil && request.Header.Get("Idempotency-Key") != ""
+}
+
+// parseRetryAfter reads Retry-After header - it can be seconds or a http date
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepWithContext waits for given duration, returns false if context is done before it
+func sleepWithContext(ctx context.Context, wait time.Duration) bool {
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,101 @@
+package httpCommand
+
+import (
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"sync"
+	"time"
+)
+
+var errRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget is a token bucket which allows retries only while they stay under a percentage of recent requests.
+// Every request deposits "percent/100" tokens and every retry withdraws 1 token. Apart from this, a small reserve of
+// min_retries_per_second is refilled with time, so that apis with low traffic can still retry.
+//
+// All methods are safe to call on a nil budget (no budget configured), in this case retries are always allowed.
+type retryBudget struct {
+	lock         *sync.Mutex
+	ratio        float64
+	maxTokens    float64
+	minPerSecond float64
+	balance      float64
+	reserve      float64
+	lastRefill   time.Time
+}
+
+func newRetryBudget(config *command.RetryBudgetConfig) *retryBudget {
+	if config == nil {
+		return nil
+	}
+	maxTokens := float64(config.MaxTokens)
+	if maxTokens <= 0 {
+		maxTokens = 100
+	}
+	return &retryBudget{
+		lock:         &sync.Mutex{},
+		ratio:        float64(config.Percent) / 100,
+		maxTokens:    maxTokens,
+		minPerSecond: float64(config.MinRetriesPerSecond),
+		reserve:      float64(config.MinRetriesPerSecond),
+		lastRefill:   time.Now(),
+	}
+}
+
+// deposit is called once for every request (not for retries)
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.balance += b.ratio
+	if b.balance > b.maxTokens {
+		b.balance = b.maxTokens
+	}
+}
+
+// tryWithdraw takes a token for a retry, returns false if budget is used up. If the retry is not sent after all, the
+// returned refund func gives the token back to the pool it was taken from (saved tokens or reserve).
+func (b *retryBudget) tryWithdraw() (refund func(), ok bool) {
+	if b == nil {
+		return func() {}, true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Refill the reserve with time
+	now := time.Now()
+	b.reserve += now.Sub(b.lastRefill).Seconds() * b.minPerSecond
+	if b.reserve > b.minPerSecond {
+		b.reserve = b.minPerSecond
+	}
+	b.lastRefill = now
+
+	if b.balance >= 1 {
+		b.balance--
+		return b.refundBalance, true
+	} else if b.reserve >= 1 {
+		b.reserve--
+		return b.refundReserve, true
+	}
+	return nil, false
+}
+
+func (b *retryBudget) refundBalance() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.balance++
+	if b.balance > b.maxTokens {
+		b.balance = b.maxTokens
+	}
+}
+
+func (b *retryBudget) refundReserve() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.reserve++
+	if b.reserve > b.minPerSecond {
+		b.reserve = b.minPerSecond
+	}
+}
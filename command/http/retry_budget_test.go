@@ -0,0 +1,192 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withdraw takes a token from the budget and keeps it
+func withdraw(budget *retryBudget) bool {
+	_, ok := budget.tryWithdraw()
+	return ok
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(&command.RetryBudgetConfig{Percent: 50, MinRetriesPerSecond: 0, MaxTokens: 2})
+
+	// No requests so far - no budget
+	assert.False(t, withdraw(budget))
+
+	// 2 requests = 1 retry
+	budget.deposit()
+	budget.deposit()
+	assert.True(t, withdraw(budget))
+	assert.False(t, withdraw(budget))
+
+	// Saved tokens are capped with max tokens
+	for i := 0; i < 100; i++ {
+		budget.deposit()
+	}
+	assert.True(t, withdraw(budget))
+	assert.True(t, withdraw(budget))
+	assert.False(t, withdraw(budget))
+
+	// Nil budget always allows retry
+	var noBudget *retryBudget
+	noBudget.deposit()
+	assert.True(t, withdraw(noBudget))
+}
+
+func TestRetryBudget_MinRetriesPerSecond(t *testing.T) {
+	budget := newRetryBudget(&command.RetryBudgetConfig{Percent: 0, MinRetriesPerSecond: 2, MaxTokens: 10})
+	assert.True(t, withdraw(budget))
+	assert.True(t, withdraw(budget))
+	assert.False(t, withdraw(budget))
+}
+
+func TestRetryBudget_RefundToSamePool(t *testing.T) {
+	budget := newRetryBudget(&command.RetryBudgetConfig{Percent: 50, MinRetriesPerSecond: 1, MaxTokens: 10})
+	budget.deposit()
+	budget.deposit()
+
+	// First token is from saved tokens, second one is from reserve - each goes back to its own pool
+	refundSaved, ok := budget.tryWithdraw()
+	assert.True(t, ok)
+	refundReserve, ok := budget.tryWithdraw()
+	assert.True(t, ok)
+	refundReserve()
+	refundSaved()
+
+	// Reserve is full even after a refill, so the budget has only the 2 tokens it had before
+	budget.lastRefill = time.Now().Add(-time.Second)
+	assert.True(t, withdraw(budget))
+	assert.True(t, withdraw(budget))
+	assert.False(t, withdraw(budget))
+}
+
+func TestHttpCommand_RetryBudgetExhausted(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// Every call can do 3 retries, but the budget allows 1 retry in total
+	retry := newRetryTestConfig()
+	retry.MaxAttempts = 4
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Retry: retry,
+			RetryBudget: &command.RetryBudgetConfig{Percent: 10, MinRetriesPerSecond: 1, MaxTokens: 10},
+		}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	if e, ok := err.(*command.GoxHttpError); ok {
+		assert.True(t, e.IsRetryBudgetExhaustedError())
+	} else {
+		assert.Fail(t, "expected GoxHttpError error")
+	}
+
+	// Budget is used up - next call fails fast without retry
+	atomic.StoreInt32(&count, 0)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestHttpCommand_ServerRetryBudgetIsSharedByApis(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{RetryBudget: &command.RetryBudgetConfig{Percent: 0, MinRetriesPerSecond: 1, MaxTokens: 10}}},
+		Apis: command.Apis{
+			"first":  &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Retry: newRetryTestConfig()},
+			"second": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Retry: newRetryTestConfig()},
+		},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	first, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["first"])
+	assert.NoError(t, err)
+	second, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["second"])
+	assert.NoError(t, err)
+
+	// First api takes the only retry of server budget
+	_, err = first.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	atomic.StoreInt32(&count, 0)
+	_, err = second.Execute(context.Background(), &command.GoxRequest{})
+	assert.True(t, err.(*command.GoxHttpError).IsRetryBudgetExhaustedError())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestHttpCommand_ServerRetryBudgetRefund(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// Server budget has a single retry, first api can not send its retry due to its own rate limit
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{RetryBudget: &command.RetryBudgetConfig{Percent: 0, MinRetriesPerSecond: 1, MaxTokens: 10}}},
+		Apis: command.Apis{
+			"first": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Retry: newRetryTestConfig(),
+				RateLimit: &command.RateLimitConfig{Rps: 0.001, Burst: 1, Mode: "reject"},
+			},
+			"second": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Retry: newRetryTestConfig()},
+		},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	first, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["first"])
+	assert.NoError(t, err)
+	second, err := NewHttpCommandWithRuntime(cf, runtime, config.Apis["second"])
+	assert.NoError(t, err)
+
+	_, err = first.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// Retry which was not sent gave its token back to the server budget, so the second api can still retry
+	atomic.StoreInt32(&count, 0)
+	_, err = second.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
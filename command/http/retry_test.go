@@ -0,0 +1,209 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRetryTestCommand(t *testing.T, url string, method string, retry *command.RetryConfig) command.Command {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Method: method, Timeout: 1000, Retry: retry}},
+	}
+	config.UpdateServerWithUrl("testServer", url)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	return cmd
+}
+
+func newRetryTestConfig() *command.RetryConfig {
+	retry := command.NewDefaultRetryConfig()
+	retry.InitialBackoffMs = 1
+	retry.MaxBackoffMs = 5
+	return retry
+}
+
+func TestHttpCommand_Retry_RetryableStatus(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cmd := newRetryTestCommand(t, ts.URL, "GET", newRetryTestConfig())
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
+
+func TestHttpCommand_Retry_NonRetryableStatusIsNotRetried(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	cmd := newRetryTestCommand(t, ts.URL, "GET", newRetryTestConfig())
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestHttpCommand_Retry_IdempotentOnly(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// POST is not retried
+	cmd := newRetryTestCommand(t, ts.URL, "POST", newRetryTestConfig())
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{Body: []byte("{}")})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// POST with Idempotency-Key is retried
+	atomic.StoreInt32(&count, 0)
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{Body: []byte("{}"), Header: http.Header{"Idempotency-Key": []string{"1"}}})
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
+
+func TestHttpCommand_Retry_RetryAfter(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	retry := newRetryTestConfig()
+	retry.RetryableStatusCodes = []int{http.StatusTooManyRequests}
+	retry.MaxBackoffMs = 300
+	cmd := newRetryTestCommand(t, ts.URL, "GET", retry)
+
+	// Retry-After is 1 sec - it is followed even if it is more than max_backoff_ms
+	start := time.Now()
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	assert.True(t, time.Since(start) >= time.Second)
+
+	// Deadline of request is before Retry-After - give up at once instead of retrying early
+	atomic.StoreInt32(&count, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = cmd.Execute(ctx, &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.Equal(t, http.StatusTooManyRequests, goxErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+}
+
+func TestHttpHystrixCommand_Retry_RetryAfterIsLimitedByHystrixTimeout(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cf, _ := test.MockCf(t)
+	retry := newRetryTestConfig()
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"retryAfterHystrixApi": &command.Api{Server: "testServer", Path: "/", Method: "GET", Timeout: 1000, Retry: retry}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpHystrixCommand(cf, config.Servers["testServer"], config.Apis["retryAfterHystrixApi"])
+	assert.NoError(t, err)
+
+	// Retry-After is after the hystrix timeout (there is no deadline from the caller) - give up at once
+	start := time.Now()
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.Equal(t, http.StatusServiceUnavailable, goxErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestHttpCommand_Retry_CustomPolicy(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	RegisterRetryPolicy("retry_bad_request_once", RetryPolicyFunc(func(attempt *RetryAttempt) (bool, time.Duration) {
+		return attempt.Attempt == 1 && attempt.StatusCode == http.StatusBadRequest, time.Millisecond
+	}))
+	defer UnregisterRetryPolicy("retry_bad_request_once")
+
+	cmd := newRetryTestCommand(t, ts.URL, "POST", &command.RetryConfig{Policy: "retry_bad_request_once"})
+	_, err := cmd.Execute(context.Background(), &command.GoxRequest{Body: []byte("{}")})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestNewRetryPolicy_InvalidConfig(t *testing.T) {
+	_, err := NewRetryPolicy(&command.Api{Name: "api", Retry: &command.RetryConfig{Policy: "not_registered"}})
+	assert.Error(t, err)
+
+	_, err = NewRetryPolicy(&command.Api{Name: "api", Retry: &command.RetryConfig{Backoff: "linear"}})
+	assert.Error(t, err)
+
+	_, err = NewRetryPolicy(&command.Api{Name: "api", Retry: &command.RetryConfig{RetryableErrors: []string{"dns"}}})
+	assert.Error(t, err)
+}
+
+func TestConfigRetryPolicy_Backoff(t *testing.T) {
+	config := &command.RetryConfig{MaxAttempts: 10, InitialBackoffMs: 10, MaxBackoffMs: 100, RetryableStatusCodes: []int{503}}
+	policy := &configRetryPolicy{config: config}
+
+	config.Backoff = "constant"
+	retry, wait := policy.ShouldRetry(&RetryAttempt{Method: "GET", Attempt: 5, StatusCode: 503})
+	assert.True(t, retry)
+	assert.Equal(t, 10*time.Millisecond, wait)
+
+	config.Backoff = "exponential"
+	for attempt := 1; attempt < 10; attempt++ {
+		_, wait = policy.ShouldRetry(&RetryAttempt{Method: "GET", Attempt: attempt, StatusCode: 503})
+		assert.True(t, wait <= 100*time.Millisecond)
+	}
+	_, wait = policy.ShouldRetry(&RetryAttempt{Method: "GET", Attempt: 4, StatusCode: 503})
+	assert.True(t, wait >= 40*time.Millisecond)
+
+	config.Backoff = "decorrelated_jitter"
+	for attempt := 1; attempt < 10; attempt++ {
+		_, wait = policy.ShouldRetry(&RetryAttempt{Method: "GET", Attempt: attempt, StatusCode: 503, PreviousWait: wait})
+		assert.True(t, wait >= 10*time.Millisecond && wait <= 100*time.Millisecond)
+	}
+
+	retry, _ = policy.ShouldRetry(&RetryAttempt{Method: "GET", Attempt: 10, StatusCode: 503})
+	assert.False(t, retry)
+}
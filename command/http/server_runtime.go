@@ -0,0 +1,202 @@
+package httpCommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/devlibx/gox-base/v2"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"golang.org/x/net/publicsuffix"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+)
+
+// ServerRuntime holds the resources of a server which are shared by all APIs using this server e.g. the connection
+// pool. All APIs of a server should be created with the same ServerRuntime, so that they reuse connections and TLS
+// sessions instead of opening a new pool per API.
+type ServerRuntime struct {
+	gox.CrossFunction
+	server    *command.Server
+	transport *http.Transport
+
+	// settings is the server config which was used to create this runtime, to find if the server is changed later
+	settings []byte
+
+	// retryBudget is shared by all APIs of this server (nil if not configured)
+	retryBudget *retryBudget
+
+	// rateLimiter is the rate limit shared by all APIs of this server (nil if not configured)
+	rateLimiter *rateLimiter
+
+	// loadBalancer spreads requests over the endpoints of the server (nil if server has a single host)
+	loadBalancer *loadBalancer
+
+	// endpointRefresher keeps endpoints of load balancer updated using service discovery (nil if not configured)
+	endpointRefresher *endpointRefresher
+
+	// healthChecker checks the health of endpoints in background once started (nil if not configured)
+	healthChecker *healthChecker
+
+	// breakers are the native circuit breakers shared by all APIs of this server (circuit breaker with server scope)
+	breakers     map[string]*slidingWindowBreaker
+	breakersLock *sync.Mutex
+
+	// hystrixStates are the last seen states of hystrix circuits of this server. Hystrix has no callback, so state is
+	// checked after every call - it is kept here so that a change of a circuit shared by many APIs is sent only once.
+	hystrixStates map[string]CircuitState
+
+	// circuitListener gets state changes of circuit breakers of all APIs of this server
+	circuitListener CircuitListener
+}
+
+// NewServerRuntime creates the shared resources (connection pool) for the given server
+func NewServerRuntime(cf gox.CrossFunction, server *command.Server) (*ServerRuntime, error) {
+	transport, err := newTransport(server)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancer, err := newLoadBalancer(cf, server)
+	if err != nil {
+		return nil, err
+	}
+	endpointRefresher, err := newEndpointRefresher(cf, server, loadBalancer)
+	if err != nil {
+		return nil, err
+	}
+	settings, _ := json.Marshal(server)
+	return &ServerRuntime{
+		CrossFunction:     cf,
+		server:            server,
+		transport:         transport,
+		settings:          settings,
+		retryBudget:       newRetryBudget(server.RetryBudget),
+		rateLimiter:       newRateLimiter(server.RateLimit),
+		loadBalancer:      loadBalancer,
+		endpointRefresher: endpointRefresher,
+		healthChecker:     newHealthChecker(cf, server, transport, loadBalancer),
+		breakers:          map[string]*slidingWindowBreaker{},
+		breakersLock:      &sync.Mutex{},
+		hystrixStates:     map[string]CircuitState{},
+	}, nil
+}
+
+// Server returns the server config of this runtime
+func (s *ServerRuntime) Server() *command.Server {
+	return s.server
+}
+
+// Start starts the background work of this runtime (active health check and refresh of endpoints with service
+// discovery, if configured). It is stopped by Close. A runtime which is not started does not leak any goroutine, its
+// endpoints are resolved once when it is created.
+func (s *ServerRuntime) Start() {
+	s.healthChecker.start()
+	s.endpointRefresher.start()
+}
+
+// IsChanged returns true if the given server config is not the same as the one used to create this runtime - in this
+// case a new runtime must be created to use the new settings (connection pool, endpoints, rate limit etc.). A custom
+// Resolver is not compared.
+func (s *ServerRuntime) IsChanged(server *command.Server) bool {
+	settings, _ := json.Marshal(server)
+	return !bytes.Equal(s.settings, settings)
+}
+
+// Close stops the background work of this runtime (health check and refresh of endpoints with service discovery), and
+// closes its idle connections. Requests already running are not cancelled.
+func (s *ServerRuntime) Close() {
+	s.healthChecker.close()
+	s.endpointRefresher.close()
+	s.transport.CloseIdleConnections()
+}
+
+// SetCircuitListener sets the listener which gets state changes of circuit breakers of all APIs of this server. It
+// must be set before commands are created using this runtime.
+func (s *ServerRuntime) SetCircuitListener(listener CircuitListener) {
+	s.circuitListener = listener
+}
+
+// circuitStateChanged logs the state change of a circuit breaker and sends it to the circuit listener. apiName is
+// empty for a circuit breaker which is shared by all APIs of the server.
+func (s *ServerRuntime) circuitStateChanged(logger *zap.Logger, apiName string, from CircuitState, to CircuitState, reason string) {
+	logger.Info("circuit breaker state changed", zap.String("from", string(from)), zap.String("to", string(to)), zap.String("reason", reason))
+	if EnableGoxHttpMetricLogging {
+		tags := map[string]string{"server": s.server.Name, "state": string(to)}
+		if apiName != "" {
+			tags["api"] = apiName
+		}
+		s.Metric().Tagged(tags).Counter("gox_http_circuit_state_change").Inc(1)
+	}
+	if s.circuitListener != nil {
+		s.circuitListener(CircuitEvent{Api: apiName, Server: s.server.Name, From: from, To: to, Reason: reason, Time: time.Now()})
+	}
+}
+
+// sharedBreaker gives the native circuit breaker which is shared by all APIs of this server, it is created by the
+// first API which asks for it. State changes of a shared breaker are sent once (not once per API) with empty api name.
+func (s *ServerRuntime) sharedBreaker(name string, config *command.CircuitBreakerConfig) *slidingWindowBreaker {
+	s.breakersLock.Lock()
+	defer s.breakersLock.Unlock()
+	if b, ok := s.breakers[name]; ok {
+		return b
+	}
+	b := newSlidingWindowBreaker(name, config)
+	logger := s.Logger().Named("goxHttp").Named(name)
+	b.addListener(func(from CircuitState, to CircuitState, reason string) {
+		s.circuitStateChanged(logger, "", from, to, reason)
+	})
+	s.breakers[name] = b
+	return b
+}
+
+// hystrixStateChanged records the current state of a hystrix circuit, and gives the previous state if it is changed
+func (s *ServerRuntime) hystrixStateChanged(name string, state CircuitState) (CircuitState, bool) {
+	s.breakersLock.Lock()
+	defer s.breakersLock.Unlock()
+	from, ok := s.hystrixStates[name]
+	if !ok {
+		from = CircuitClosed
+	}
+	s.hystrixStates[name] = state
+	return from, from != state
+}
+
+// newRestyClients gives the resty clients of an api - one for buffered requests and one for the stream requests
+// (ExecuteStream). The clients use the shared connection pool of the server, but they have their own api level
+// settings (timeout, retry, debug, middlewares) and their own cookie jar. The stream client does not have the timeout
+// of the api, because the body of a stream is read after the request returns - the timeout is applied with context
+// until the response headers are received.
+func (s *ServerRuntime) newRestyClients(api *command.Api) (*resty.Client, *resty.Client) {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	client := resty.NewWithClient(&http.Client{
+		Transport: s.roundTripper(api),
+		Jar:       jar,
+		Timeout:   time.Duration(api.Timeout) * time.Millisecond,
+	})
+	streamClient := resty.NewWithClient(&http.Client{
+		Transport: s.roundTripper(api),
+		Jar:       jar,
+	})
+	return client, streamClient
+}
+
+// roundTripper gives the shared transport of the server, with the response body limit of the api (if any). The shared
+// transport is always wrapped, so it can not be changed through the resty client of an api (e.g. SetTLSClientConfig or
+// SetProxy of resty fail with "current transport is not an *http.Transport instance").
+func (s *ServerRuntime) roundTripper(api *command.Api) http.RoundTripper {
+	if api.MaxResponseBytes > 0 {
+		return &maxResponseBytesTransport{next: s.transport, limit: int64(api.MaxResponseBytes)}
+	}
+	return &sharedTransport{next: s.transport}
+}
+
+// sharedTransport hides the shared transport of the server behind the resty client of an api
+type sharedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req)
+}
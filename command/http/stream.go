@@ -0,0 +1,189 @@
+package httpCommand
+
+import (
+	"bytes"
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/go-resty/resty/v2"
+	"io"
+	"sync"
+	"time"
+)
+
+type streamContextKey struct{}
+
+// StreamCommand is implemented by commands which can give the response body as a stream, without reading it in memory
+type StreamCommand interface {
+	ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error)
+}
+
+// streamState is shared by all the commands (circuit breaker and http command) which serve one ExecuteStream call. The
+// http command attaches the body of the response to it, and the caller gets the body of the response it receives.
+type streamState struct {
+	// ctx is the context of the caller, the body is read until it is done
+	ctx context.Context
+
+	lock   *sync.Mutex
+	bodies map[*command.GoxResponse]io.ReadCloser
+	done   bool
+}
+
+// executeStream runs execute in stream mode. Timeout of the api (including retries) applies until the response headers
+// are received, after that the body can be read until ctx is done.
+func executeStream(ctx context.Context, api *command.Api, request *command.GoxRequest, execute func(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error)) (*command.GoxStreamResponse, error) {
+	state := &streamState{ctx: ctx, lock: &sync.Mutex{}, bodies: map[*command.GoxResponse]io.ReadCloser{}}
+	callCtx, cancel := context.WithTimeout(context.WithValue(ctx, streamContextKey{}, state), time.Duration(api.GetTimeoutWithRetryIncluded())*time.Millisecond)
+	defer cancel()
+
+	response, err := execute(callCtx, request)
+	body := state.finish(response)
+	if response == nil {
+		return nil, err
+	}
+	if body != nil && err != nil {
+		// e.g. circuit breaker timed out just after the response headers are received
+		_ = body.Close()
+		body = nil
+	}
+	if body == nil {
+		body = io.NopCloser(bytes.NewReader(response.Body))
+	}
+	return &command.GoxStreamResponse{Body: body, StatusCode: response.StatusCode, ResponseMetadata: response.ResponseMetadata}, err
+}
+
+// attach keeps the body of a response, the body is closed if the call is already done (e.g. a response which is
+// received after the circuit breaker timed out)
+func (s *streamState) attach(response *command.GoxResponse, body io.ReadCloser) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.done {
+		_ = body.Close()
+		return
+	}
+	s.bodies[response] = body
+}
+
+// finish gives the body of the response which is returned to the caller, bodies of all other responses are closed
+func (s *streamState) finish(response *command.GoxResponse) io.ReadCloser {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done = true
+	body := s.bodies[response]
+	delete(s.bodies, response)
+	for _, other := range s.bodies {
+		_ = other.Close()
+	}
+	s.bodies = nil
+	return body
+}
+
+// streamRequest is the context of the request of a stream. The body of a stream is read after the command returns, so
+// the request is not bound to the contexts of the command (timeouts) once the response headers are received - from then
+// it is cancelled when the caller's context is done or the body is closed.
+//
+// All methods are safe to call on nil (request is not a stream).
+type streamRequest struct {
+	state  *streamState
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// stopParent stops the cancellation of this request with the contexts of the command
+	stopParent func() bool
+}
+
+// newStreamRequest gives the stream request if ExecuteStream is running, otherwise nil
+func newStreamRequest(ctx context.Context) *streamRequest {
+	state, ok := ctx.Value(streamContextKey{}).(*streamState)
+	if !ok {
+		return nil
+	}
+	requestCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &streamRequest{state: state, parent: ctx, ctx: requestCtx, cancel: cancel, stopParent: context.AfterFunc(ctx, cancel)}
+}
+
+func isStream(ctx context.Context) bool {
+	return ctx.Value(streamContextKey{}) != nil
+}
+
+// context gives the context to send the request with
+func (s *streamRequest) context(parent context.Context) context.Context {
+	if s == nil {
+		return parent
+	}
+	return s.ctx
+}
+
+// release cancels the request, it is used when there is no body to give to the caller
+func (s *streamRequest) release() {
+	if s != nil {
+		s.cancel()
+	}
+}
+
+// response gives the response of a stream request. The body of a successful response is attached to the stream state
+// without reading it, the body of an error response is read so that the error has it (like a buffered request).
+func (s *streamRequest) response(api *command.Api, response *resty.Response) (*command.GoxResponse, error) {
+	raw := response.RawBody()
+	if response.IsError() && !api.IsHttpCodeAcceptable(response.StatusCode()) {
+		body, err := io.ReadAll(raw)
+		_ = raw.Close()
+		s.release()
+		if isResponseTooLargeError(err) {
+			return nil, err
+		}
+		return &command.GoxResponse{
+			Body:       body,
+			StatusCode: response.StatusCode(),
+			Err: &command.GoxHttpError{
+				Err:        errors.New("got response with server with error"),
+				StatusCode: response.StatusCode(),
+				Message:    "got response from server with error",
+				ErrorCode:  "server_response_with_error",
+				Body:       body,
+			},
+		}, nil
+	}
+
+	// Request is cancelled with the caller's context from now
+	if !s.stopParent() {
+		_ = raw.Close()
+		return nil, s.parent.Err()
+	}
+	stopCaller := context.AfterFunc(s.state.ctx, s.cancel)
+	responseObject := &command.GoxResponse{StatusCode: response.StatusCode()}
+	s.state.attach(responseObject, &streamBody{ReadCloser: raw, close: func() {
+		stopCaller()
+		s.cancel()
+	}})
+	return responseObject, nil
+}
+
+// streamBody is the body given to the caller of ExecuteStream
+type streamBody struct {
+	io.ReadCloser
+	close     func()
+	closeOnce sync.Once
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if isResponseTooLargeError(err) {
+		return n, newResponseTooLargeError(err)
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closeOnce.Do(b.close)
+	return err
+}
+
+// discardStreamBody closes the body of a stream response which is not used (e.g. a response which is retried)
+func discardStreamBody(ctx context.Context, response *resty.Response) {
+	if isStream(ctx) && response != nil && response.RawBody() != nil {
+		_ = response.RawBody().Close()
+	}
+}
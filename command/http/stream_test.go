@@ -0,0 +1,194 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newStreamTestCommand(t *testing.T, serverUrl string, api *command.Api) command.Command {
+	cf, _ := test.MockCf(t)
+	api.Server = "testServer"
+	api.Path = "/"
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{}},
+		Apis:    command.Apis{"api": api},
+	}
+	config.UpdateServerWithUrl("testServer", serverUrl)
+	config.SetupDefaults()
+
+	runtime, err := NewServerRuntime(cf, config.Servers["testServer"])
+	assert.NoError(t, err)
+	cmd, err := NewCommandWithRuntime(cf, runtime, config.Apis["api"])
+	assert.NoError(t, err)
+	return cmd
+}
+
+// chunkedServer sends count chunks of 1KB, it waits for delay after the first chunk
+func chunkedServer(count int, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Count")
+		w.Header().Set("X-Export", "users")
+		chunk := []byte(strings.Repeat("a", 1024))
+		for i := 0; i < count; i++ {
+			_, _ = w.Write(chunk)
+			w.(http.Flusher).Flush()
+			if i == 0 {
+				time.Sleep(delay)
+			}
+		}
+		w.Header().Set("X-Count", strconv.Itoa(count))
+	}))
+}
+
+func TestHttpCommand_ExecuteStream(t *testing.T) {
+	ts := chunkedServer(1024, 200*time.Millisecond)
+	defer ts.Close()
+
+	// Body is read after the timeout of api (100ms), timeout applies only until headers are received
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 100, DisableHystrix: true})
+	response, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "users", response.Header.Get("X-Export"))
+	assert.Equal(t, 1, response.Attempts)
+
+	n, err := io.Copy(io.Discard, response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024*1024), n)
+	assert.NoError(t, response.Body.Close())
+	assert.Equal(t, "1024", response.Trailer.Get("X-Count"))
+}
+
+func TestHttpCommand_ExecuteStream_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 50, DisableHystrix: true})
+	_, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsRequestTimeout())
+}
+
+func TestHttpCommand_ExecuteStream_CallerCancel(t *testing.T) {
+	ts := chunkedServer(10, 500*time.Millisecond)
+	defer ts.Close()
+
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 1000, DisableHystrix: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	response, err := cmd.(StreamCommand).ExecuteStream(ctx, &command.GoxRequest{})
+	assert.NoError(t, err)
+	defer response.Body.Close()
+
+	cancel()
+	_, err = io.ReadAll(response.Body)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHttpCommand_ExecuteStream_Retry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("busy"))
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 1000, DisableHystrix: true, Retry: newRetryTestConfig()})
+	response, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, response.Attempts)
+	data, _ := io.ReadAll(response.Body)
+	assert.Equal(t, "data", string(data))
+	assert.NoError(t, response.Body.Close())
+
+	// Error response has the body of the error
+	atomic.StoreInt32(&calls, -10)
+	response, err = cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.Equal(t, http.StatusServiceUnavailable, goxErr.StatusCode)
+	assert.Equal(t, "busy", string(goxErr.Body))
+	data, _ = io.ReadAll(response.Body)
+	assert.Equal(t, "busy", string(data))
+}
+
+func TestHttpCommand_ExecuteStream_CircuitBreaker(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 1000, Concurrency: 5,
+		CircuitBreaker: &command.CircuitBreakerConfig{Type: "native", RequestVolumeThreshold: 3, ErrorPercentThreshold: 50, SleepWindowMs: 10000},
+	})
+	assert.IsType(t, &HttpBreakerCommand{}, cmd)
+	for i := 0; i < 3; i++ {
+		_, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+		assert.Error(t, err)
+	}
+
+	_, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsHystrixCircuitOpenError())
+}
+
+func TestHttpCommand_MaxResponseBytes(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Query().Get("length") == "true" {
+			w.Header().Set("Content-Length", "2048")
+			_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+			return
+		}
+		// Chunked response (without Content-Length)
+		for i := 0; i < 2; i++ {
+			_, _ = w.Write([]byte(strings.Repeat("a", 1024)))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	cmd := newStreamTestCommand(t, ts.URL, &command.Api{Timeout: 1000, DisableHystrix: true, Retry: newRetryTestConfig(), MaxResponseBytes: 1024})
+	for _, length := range []string{"true", "false"} {
+		// Buffered response is not read beyond the limit, and it is not retried
+		atomic.StoreInt32(&calls, 0)
+		_, err := cmd.Execute(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"length": []string{length}}})
+		var goxErr *command.GoxHttpError
+		assert.ErrorAs(t, err, &goxErr)
+		assert.True(t, goxErr.IsResponseTooLargeError())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	}
+
+	// Stream with Content-Length more than the limit fails at once
+	_, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"length": []string{"true"}}})
+	var goxErr *command.GoxHttpError
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsResponseTooLargeError())
+
+	// Otherwise the stream fails after the limit
+	response, err := cmd.(StreamCommand).ExecuteStream(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"length": []string{"false"}}})
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	assert.Len(t, data, 1024)
+	assert.ErrorAs(t, err, &goxErr)
+	assert.True(t, goxErr.IsResponseTooLargeError())
+}
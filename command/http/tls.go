@@ -0,0 +1,226 @@
+package httpCommand
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTlsConfig builds the TLS config of a server. It returns nil if server does not need any custom TLS setup.
+func newTlsConfig(server *command.Server) (*tls.Config, error) {
+	skipCertVerify := server.SkipCertVerify == "true"
+	if server.Tls == nil && !skipCertVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: skipCertVerify}
+	if server.Tls == nil {
+		return cfg, nil
+	}
+
+	tc := server.Tls
+	if tc.MinVersion != "" {
+		if v, ok := tlsVersions[tc.MinVersion]; ok {
+			cfg.MinVersion = v
+		} else {
+			return nil, errors.New("invalid tls min_version=%s for server=%s (expected 1.0, 1.1, 1.2 or 1.3)", tc.MinVersion, server.Name)
+		}
+	}
+
+	if len(tc.CipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[cs.Name] = cs.ID
+		}
+		for _, name := range tc.CipherSuites {
+			if id, ok := suites[strings.TrimSpace(name)]; ok {
+				cfg.CipherSuites = append(cfg.CipherSuites, id)
+			} else {
+				return nil, errors.New("invalid tls cipher suite=%s for server=%s", name, server.Name)
+			}
+		}
+	}
+
+	cfg.ServerName = tc.ServerName
+
+	pins := map[string]bool{}
+	for _, pin := range tc.PinnedSpkiSha256 {
+		pins[strings.TrimSpace(pin)] = true
+	}
+
+	// Load certificates once to fail fast on bad config
+	certs := newTlsCertificates(tc)
+	if err := certs.load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load tls certificates for server=%s", server.Name)
+	}
+
+	if tc.CertFile != "" || tc.CertPem != "" {
+		cfg.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.clientCertificate()
+		}
+	}
+
+	// With a custom CA we verify the chain ourselves, so that a rotated CA file is used without building a new config
+	customCa := tc.CaFile != "" || tc.CaPem != ""
+	if customCa && !skipCertVerify {
+		cfg.InsecureSkipVerify = true
+	}
+
+	if (customCa && !skipCertVerify) || len(pins) > 0 {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server did not send any certificate")
+			}
+			if customCa && !skipCertVerify {
+				opts := x509.VerifyOptions{DNSName: cs.ServerName, Roots: certs.rootCAs(), Intermediates: x509.NewCertPool()}
+				for _, c := range cs.PeerCertificates[1:] {
+					opts.Intermediates.AddCert(c)
+				}
+				if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+					return err
+				}
+			}
+			if len(pins) > 0 {
+				for _, c := range cs.PeerCertificates {
+					hash := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(hash[:])] {
+						return nil
+					}
+				}
+				return errors.New("server certificate does not match any pinned spki hash: server=%s", server.Name)
+			}
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// tlsCertificates holds CA pool and client certificate of a server. Files are checked for changes at most once in
+// reload interval, and loaded again if they are modified.
+type tlsCertificates struct {
+	config         *command.TlsConfig
+	reloadInterval time.Duration
+
+	lock       *sync.Mutex
+	lastCheck  time.Time
+	modTimes   map[string]time.Time
+	caPool     *x509.CertPool
+	clientCert *tls.Certificate
+}
+
+func newTlsCertificates(config *command.TlsConfig) *tlsCertificates {
+	reloadInterval := time.Duration(config.ReloadIntervalMs) * time.Millisecond
+	if reloadInterval <= 0 {
+		reloadInterval = 10 * time.Second
+	}
+	return &tlsCertificates{
+		config:         config,
+		reloadInterval: reloadInterval,
+		lock:           &sync.Mutex{},
+		modTimes:       map[string]time.Time{},
+	}
+}
+
+func (t *tlsCertificates) rootCAs() *x509.CertPool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.reloadIfChanged()
+	return t.caPool
+}
+
+func (t *tlsCertificates) clientCertificate() (*tls.Certificate, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.reloadIfChanged()
+	if t.clientCert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return t.clientCert, nil
+}
+
+// reloadIfChanged loads the files again if any of them is modified. On error, we keep using the old certificates
+// e.g. if we see a half written file during rotation. Must be called with lock held.
+func (t *tlsCertificates) reloadIfChanged() {
+	if time.Since(t.lastCheck) < t.reloadInterval {
+		return
+	}
+	t.lastCheck = time.Now()
+	for _, f := range []string{t.config.CaFile, t.config.CertFile, t.config.KeyFile} {
+		if f == "" {
+			continue
+		}
+		if info, err := os.Stat(f); err == nil && !info.ModTime().Equal(t.modTimes[f]) {
+			_ = t.loadLocked()
+			return
+		}
+	}
+}
+
+func (t *tlsCertificates) load() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastCheck = time.Now()
+	return t.loadLocked()
+}
+
+func (t *tlsCertificates) loadLocked() error {
+	modTimes := map[string]time.Time{}
+	readFileOrPem := func(file string, pem string) ([]byte, error) {
+		if file == "" {
+			return []byte(pem), nil
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+		return os.ReadFile(file)
+	}
+
+	var caPool *x509.CertPool
+	if t.config.CaFile != "" || t.config.CaPem != "" {
+		data, err := readFileOrPem(t.config.CaFile, t.config.CaPem)
+		if err != nil {
+			return errors.Wrap(err, "failed to read ca file")
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(data) {
+			return errors.New("no valid certificate found in ca bundle")
+		}
+	}
+
+	var clientCert *tls.Certificate
+	if t.config.CertFile != "" || t.config.CertPem != "" {
+		certData, err := readFileOrPem(t.config.CertFile, t.config.CertPem)
+		if err != nil {
+			return errors.Wrap(err, "failed to read client certificate")
+		}
+		keyData, err := readFileOrPem(t.config.KeyFile, t.config.KeyPem)
+		if err != nil {
+			return errors.Wrap(err, "failed to read client key")
+		}
+		cert, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse client certificate and key")
+		}
+		clientCert = &cert
+	}
+
+	t.caPool = caPool
+	t.clientCert = clientCert
+	t.modTimes = modTimes
+	return nil
+}
@@ -0,0 +1,211 @@
+package httpCommand
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPem string
+	keyPem  string
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCa bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCa,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPem:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair([]byte(c.certPem), []byte(c.keyPem))
+	assert.NoError(t, err)
+	return cert
+}
+
+func (c *testCert) spkiPin() string {
+	hash := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// newMutualTlsServer starts a https server which requires a client certificate signed by the given CA
+func newMutualTlsServer(t *testing.T, ca *testCert, serverCert *testCert) *httptest.Server {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"cn": "` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	ts.StartTLS()
+	return ts
+}
+
+func executeWithTls(t *testing.T, url string, tlsConfig *command.TlsConfig) (*command.GoxResponse, error) {
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{Tls: tlsConfig}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.UpdateServerWithUrl("testServer", url)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+	return cmd.Execute(context.Background(), &command.GoxRequest{})
+}
+
+func TestHttpCommand_MutualTls(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCert := newTestCert(t, "server", ca, false)
+	clientCert := newTestCert(t, "client", ca, false)
+	ts := newMutualTlsServer(t, ca, serverCert)
+	defer ts.Close()
+
+	response, err := executeWithTls(t, ts.URL, &command.TlsConfig{
+		CaPem:      ca.certPem,
+		CertPem:    clientCert.certPem,
+		KeyPem:     clientCert.keyPem,
+		MinVersion: "1.2",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cn": "client"}`, string(response.Body))
+
+	// Without client certificate the server must reject the handshake
+	_, err = executeWithTls(t, ts.URL, &command.TlsConfig{CaPem: ca.certPem})
+	assert.Error(t, err)
+
+	// Server certificate is not signed by a trusted CA
+	otherCa := newTestCert(t, "other-ca", nil, true)
+	_, err = executeWithTls(t, ts.URL, &command.TlsConfig{CaPem: otherCa.certPem, CertPem: clientCert.certPem, KeyPem: clientCert.keyPem})
+	assert.Error(t, err)
+}
+
+func TestHttpCommand_TlsPinning(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCert := newTestCert(t, "server", ca, false)
+	clientCert := newTestCert(t, "client", ca, false)
+	ts := newMutualTlsServer(t, ca, serverCert)
+	defer ts.Close()
+
+	tlsConfig := &command.TlsConfig{
+		CaPem:            ca.certPem,
+		CertPem:          clientCert.certPem,
+		KeyPem:           clientCert.keyPem,
+		PinnedSpkiSha256: []string{serverCert.spkiPin()},
+	}
+	_, err := executeWithTls(t, ts.URL, tlsConfig)
+	assert.NoError(t, err)
+
+	tlsConfig.PinnedSpkiSha256 = []string{clientCert.spkiPin()}
+	_, err = executeWithTls(t, ts.URL, tlsConfig)
+	assert.Error(t, err)
+}
+
+func TestHttpCommand_TlsClientCertificateIsReloaded(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCert := newTestCert(t, "server", ca, false)
+	ts := newMutualTlsServer(t, ca, serverCert)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	writeCert := func(c *testCert) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "client.crt"), []byte(c.certPem), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "client.key"), []byte(c.keyPem), 0600))
+	}
+	writeCert(newTestCert(t, "client-1", ca, false))
+
+	cf, _ := test.MockCf(t)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{Tls: &command.TlsConfig{
+			CaPem:            ca.certPem,
+			CertFile:         filepath.Join(dir, "client.crt"),
+			KeyFile:          filepath.Join(dir, "client.key"),
+			ReloadIntervalMs: 10,
+		}}},
+		Apis: command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cn": "client-1"}`, string(response.Body))
+
+	// Rotate the certificate on disk, new connections must use the new certificate
+	time.Sleep(20 * time.Millisecond)
+	writeCert(newTestCert(t, "client-2", ca, false))
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(filepath.Join(dir, "client.crt"), future, future)
+	_ = os.Chtimes(filepath.Join(dir, "client.key"), future, future)
+	ts.CloseClientConnections()
+
+	response, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cn": "client-2"}`, string(response.Body))
+}
+
+func TestNewTlsConfig_InvalidConfig(t *testing.T) {
+	_, err := newTlsConfig(&command.Server{Name: "s", Tls: &command.TlsConfig{MinVersion: "2.0"}})
+	assert.Error(t, err)
+
+	_, err = newTlsConfig(&command.Server{Name: "s", Tls: &command.TlsConfig{CipherSuites: []string{"BAD_SUITE"}}})
+	assert.Error(t, err)
+
+	cfg, err := newTlsConfig(&command.Server{Name: "s", SkipCertVerify: "true"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+}
@@ -0,0 +1,89 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/errors"
+	"github.com/devlibx/gox-http/v4/command"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+)
+
+// errConnectionRequestTimeout is a net.Error with Timeout()=true, so it is reported as client timeout
+var errConnectionRequestTimeout net.Error = &connectionRequestTimeoutError{}
+
+type connectionRequestTimeoutError struct{}
+
+func (e *connectionRequestTimeoutError) Error() string {
+	return "timeout in getting a connection to send request (connection_request_timeout)"
+}
+func (e *connectionRequestTimeoutError) Timeout() bool   { return true }
+func (e *connectionRequestTimeoutError) Temporary() bool { return true }
+
+// newTransport builds the http transport for a server using the connection settings of the server
+func newTransport(server *command.Server) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(server.ConnectTimeout) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   server.MaxIdleConnectionsPerHost,
+		MaxConnsPerHost:       server.MaxConnectionsPerHost,
+		IdleConnTimeout:       time.Duration(server.IdleConnectionTimeout) * time.Millisecond,
+		TLSHandshakeTimeout:   time.Duration(server.TlsHandshakeTimeout) * time.Millisecond,
+		ResponseHeaderTimeout: time.Duration(server.ResponseHeaderTimeout) * time.Millisecond,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if transport.MaxIdleConnsPerHost > transport.MaxIdleConns {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+
+	// We need to consider if we need to use proxy or not
+	if server.ProxyUrl != "" {
+		if proxyURL, err := url.Parse(server.ProxyUrl); err != nil {
+			return nil, errors.Wrap(err, "failed to parse proxy url: url=%s", server.ProxyUrl)
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	// TLS settings (skip_cert_verify, custom CA, mTLS, pinning) apply with or without proxy
+	if tlsConfig, err := newTlsConfig(server); err != nil {
+		return nil, err
+	} else if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// withConnectionRequestTimeout bounds the time taken by one attempt to get a connection (from the idle pool, or a new
+// connection including TLS handshake) to connection_request_timeout of the server. The returned context is cancelled
+// with errConnectionRequestTimeout as cause if no connection is obtained in time, there is no limit once a connection
+// is obtained. Caller must call the cancel function once the attempt is completed.
+func withConnectionRequestTimeout(ctx context.Context, server *command.Server) (context.Context, context.CancelFunc) {
+	if server.ConnectionRequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(time.Duration(server.ConnectionRequestTimeout)*time.Millisecond, func() {
+		cancel(errConnectionRequestTimeout)
+	})
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			timer.Stop()
+		},
+	})
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
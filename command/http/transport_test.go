@@ -0,0 +1,103 @@
+package httpCommand
+
+import (
+	"context"
+	"github.com/devlibx/gox-base/v2/test"
+	"github.com/devlibx/gox-http/v4/command"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTransport_UsesServerConnectionSettings(t *testing.T) {
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{
+			ConnectTimeout:        100,
+			ResponseHeaderTimeout: 300,
+			MaxConnectionsPerHost: 20,
+		}},
+	}
+	config.SetupDefaults()
+
+	transport, err := newTransport(config.Servers["testServer"])
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 300*time.Millisecond, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, transport.MaxConnsPerHost)
+	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+}
+
+func TestHttpCommand_ConnectionRequestTimeout(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// Only 1 connection is allowed, so the second request has to wait for a connection
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{ConnectionRequestTimeout: 50, MaxConnectionsPerHost: 1}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 2, QueueSize: 2}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = cmd.Execute(context.Background(), &command.GoxRequest{})
+	if e, ok := err.(*command.GoxHttpError); ok {
+		assert.Equal(t, "request_timeout_on_client", e.ErrorCode)
+	} else {
+		assert.Fail(t, "expected GoxHttpError error")
+	}
+	assert.NoError(t, <-first)
+}
+
+func TestHttpCommand_ConnectionRequestTimeout_IsPerAttempt(t *testing.T) {
+	cf, _ := test.MockCf(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hold") == "true" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// Only 1 connection is allowed - first attempt does not get a connection in time, the retry gets its own time to
+	// get a connection (after the connection is released by the first request)
+	config := command.Config{
+		Servers: command.Servers{"testServer": &command.Server{ConnectionRequestTimeout: 150, MaxConnectionsPerHost: 1}},
+		Apis:    command.Apis{"api": &command.Api{Server: "testServer", Path: "/", Timeout: 1000, Concurrency: 2, QueueSize: 2, Retry: newRetryTestConfig()}},
+	}
+	config.UpdateServerWithUrl("testServer", ts.URL)
+	config.SetupDefaults()
+
+	cmd, err := NewHttpCommand(cf, config.Servers["testServer"], config.Apis["api"])
+	assert.NoError(t, err)
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := cmd.Execute(context.Background(), &command.GoxRequest{QueryParam: command.MultivaluedMap{"hold": []string{"true"}}})
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	response, err := cmd.Execute(context.Background(), &command.GoxRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Attempts)
+	assert.NoError(t, <-first)
+}
@@ -2,10 +2,16 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/devlibx/gox-base/v2"
 	"github.com/devlibx/gox-base/v2/serialization"
@@ -24,17 +30,64 @@ type Servers map[string]*Server
 // ****************************************************************************************
 type Server struct {
 	Name                        string
-	ProxyUrl                    string                 `yaml:"proxy_url"`
-	Host                        string                 `yaml:"host"`
-	Port                        int                    `yaml:"port"`
-	Https                       bool                   `yaml:"https"`
-	SkipCertVerify              string                 `yaml:"skip_cert_verify"`
-	ConnectTimeout              int                    `yaml:"connect_timeout"`
-	ConnectionRequestTimeout    int                    `yaml:"connection_request_timeout"`
-	Properties                  map[string]interface{} `yaml:"properties"`
-	Headers                     map[string]interface{} `yaml:"headers"`
-	InterceptorConfig           *interceptor.Config    `yaml:"interceptor_config"`
-	EnableHttpConnectionTracing bool                   `yaml:"enable_http_connection_tracing"`
+	ProxyUrl                    string                  `yaml:"proxy_url"`
+	Host                        string                  `yaml:"host"`
+	Port                        int                     `yaml:"port"`
+	Https                       bool                    `yaml:"https"`
+	SkipCertVerify              string                  `yaml:"skip_cert_verify"`
+	ConnectTimeout              int                     `yaml:"connect_timeout"`
+	ConnectionRequestTimeout    int                     `yaml:"connection_request_timeout"`
+	TlsHandshakeTimeout         int                     `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout       int                     `yaml:"response_header_timeout"`
+	MaxIdleConnectionsPerHost   int                     `yaml:"max_idle_connections_per_host"`
+	MaxConnectionsPerHost       int                     `yaml:"max_connections_per_host"`
+	IdleConnectionTimeout       int                     `yaml:"idle_connection_timeout"`
+	Properties                  map[string]interface{}  `yaml:"properties"`
+	Headers                     map[string]interface{}  `yaml:"headers"`
+	InterceptorConfig           *interceptor.Config     `yaml:"interceptor_config"`
+	EnableHttpConnectionTracing bool                    `yaml:"enable_http_connection_tracing"`
+	Tls                         *TlsConfig              `yaml:"tls"`
+	RetryBudget                 *RetryBudgetConfig      `yaml:"retry_budget"`
+	CircuitBreaker              *CircuitBreakerConfig   `yaml:"circuit_breaker"`
+	Endpoints                   []*Endpoint             `yaml:"endpoints"`
+	LoadBalancer                *LoadBalancerConfig     `yaml:"load_balancer"`
+	Discovery                   *DiscoveryConfig        `yaml:"discovery"`
+	OutlierDetection            *OutlierDetectionConfig `yaml:"outlier_detection"`
+	HealthCheck                 *HealthCheckConfig      `yaml:"health_check"`
+	RateLimit                   *RateLimitConfig        `yaml:"rate_limit"`
+
+	// Resolver is a custom service discovery, it is used instead of the discovery config if set
+	Resolver Resolver `yaml:"-" json:"-"`
+}
+
+// TlsConfig is the TLS setup of a server. It is used with and without proxy.
+//
+// CA bundle and client certificate can be given as a file or as PEM. Files are checked for changes (at most once in
+// reload_interval_ms) when a new connection is made, so rotated certificates are picked up without restart.
+type TlsConfig struct {
+	CaFile string `json:"ca_file" yaml:"ca_file"`
+	CaPem  string `json:"ca_pem" yaml:"ca_pem"`
+
+	// Client certificate and key for mutual TLS
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	CertPem  string `json:"cert_pem" yaml:"cert_pem"`
+	KeyPem   string `json:"key_pem" yaml:"key_pem"`
+
+	// MinVersion is one of 1.0, 1.1, 1.2, 1.3
+	MinVersion string `json:"min_version" yaml:"min_version"`
+
+	// CipherSuites are names of cipher suites e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (not used with TLS 1.3)
+	CipherSuites []string `json:"cipher_suites" yaml:"cipher_suites"`
+
+	// ServerName overrides the SNI server name, which is also used to verify the server certificate
+	ServerName string `json:"server_name" yaml:"server_name"`
+
+	// PinnedSpkiSha256 is a list of base64 encoded sha256 hashes of SubjectPublicKeyInfo. If set then one of the
+	// certificates sent by server must match one of these pins.
+	PinnedSpkiSha256 []string `json:"pinned_spki_sha256" yaml:"pinned_spki_sha256"`
+
+	ReloadIntervalMs int `json:"reload_interval_ms" yaml:"reload_interval_ms"`
 }
 
 // List of all APIs
@@ -47,35 +100,468 @@ type Apis map[string]*Api
 // ****************************************************************************************
 type Api struct {
 	Name                         string
-	Method                       string              `yaml:"method"`
-	Path                         string              `yaml:"path"`
-	Server                       string              `yaml:"server"`
-	Timeout                      int                 `yaml:"timeout"`
-	Concurrency                  int                 `yaml:"concurrency"`
-	QueueSize                    int                 `yaml:"queue_size"`
-	Async                        bool                `yaml:"async"`
-	AcceptableCodes              string              `yaml:"acceptable_codes"`
-	RetryCount                   int                 `yaml:"retry_count"`
-	InitialRetryWaitTimeMs       int                 `yaml:"retry_initial_wait_time_ms"`
-	Headers                      map[string]string   `yaml:"headers"`
-	InterceptorConfig            *interceptor.Config `yaml:"interceptor_config"`
-	EnableRequestResponseLogging bool                `yaml:"enable_request_response_logging"`
-	EnableHttpConnectionTracing  bool                `yaml:"enable_http_connection_tracing"`
-	DisableHystrix               bool                `yaml:"disable_hystrix"`
+	Method                       string                     `yaml:"method"`
+	Path                         string                     `yaml:"path"`
+	Server                       string                     `yaml:"server"`
+	Timeout                      int                        `yaml:"timeout"`
+	Concurrency                  int                        `yaml:"concurrency"`
+	QueueSize                    int                        `yaml:"queue_size"`
+	AdaptiveConcurrency          *AdaptiveConcurrencyConfig `yaml:"adaptive_concurrency"`
+	Async                        bool                       `yaml:"async"`
+	AsyncQueueSize               int                        `yaml:"async_queue_size"`
+	AcceptableCodes              string                     `yaml:"acceptable_codes"`
+	RetryCount                   int                        `yaml:"retry_count"`
+	InitialRetryWaitTimeMs       int                        `yaml:"retry_initial_wait_time_ms"`
+	Retry                        *RetryConfig               `yaml:"retry"`
+	RetryBudget                  *RetryBudgetConfig         `yaml:"retry_budget"`
+	CircuitBreaker               *CircuitBreakerConfig      `yaml:"circuit_breaker"`
+	Hedging                      *HedgingConfig             `yaml:"hedging"`
+	RateLimit                    *RateLimitConfig           `yaml:"rate_limit"`
+	Cache                        *CacheConfig               `yaml:"cache"`
+	Coalesce                     bool                       `yaml:"coalesce"`
+	CoalesceKeyHeaders           []string                   `yaml:"coalesce_key_headers"`
+	Fallback                     *FallbackConfig            `yaml:"fallback"`
+	RequestCodec                 string                     `yaml:"request_codec"`
+	ResponseCodec                string                     `yaml:"response_codec"`
+	MaxResponseBytes             int                        `yaml:"max_response_bytes"`
+	Headers                      map[string]string          `yaml:"headers"`
+	InterceptorConfig            *interceptor.Config        `yaml:"interceptor_config"`
+	EnableRequestResponseLogging bool                       `yaml:"enable_request_response_logging"`
+	EnableHttpConnectionTracing  bool                       `yaml:"enable_http_connection_tracing"`
+	DisableHystrix               bool                       `yaml:"disable_hystrix"`
 	acceptableCodes              []int
+	queueSizeDefault             bool
 }
 
-func (a *Api) GetTimeoutWithRetryIncluded() int {
+// RetryConfig is the retry policy of an api. If it is not set then the old retry_count and retry_initial_wait_time_ms
+// settings are used (retry on any error or any status which is not acceptable).
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts including the first call e.g. 3 = 1 call + 2 retries
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
 
-	if a.RetryCount <= 0 {
-		return a.Timeout
+	// Backoff is one of constant, exponential, decorrelated_jitter
+	Backoff          string `json:"backoff" yaml:"backoff"`
+	InitialBackoffMs int    `json:"initial_backoff_ms" yaml:"initial_backoff_ms"`
+	MaxBackoffMs     int    `json:"max_backoff_ms" yaml:"max_backoff_ms"`
+
+	// RetryableStatusCodes are the response codes which are retried e.g. 502, 503, 504
+	RetryableStatusCodes []int `json:"retryable_status_codes" yaml:"retryable_status_codes"`
+
+	// RetryableErrors are the classes of errors (no response from server) which are retried - timeout, connection
+	RetryableErrors []string `json:"retryable_errors" yaml:"retryable_errors"`
+
+	// RespectRetryAfter uses the Retry-After header of the response as wait time (not capped to max_backoff_ms). If
+	// the deadline of the request is before Retry-After then the request is not retried.
+	RespectRetryAfter bool `json:"respect_retry_after" yaml:"respect_retry_after"`
+
+	// IdempotentOnly retries only idempotent methods (GET, HEAD, OPTIONS, PUT, DELETE, TRACE), or requests which have
+	// an Idempotency-Key header
+	IdempotentOnly bool `json:"idempotent_only" yaml:"idempotent_only"`
+
+	// Policy is the name of a custom retry policy registered with httpCommand.RegisterRetryPolicy
+	Policy string `json:"policy" yaml:"policy"`
+}
+
+// NewDefaultRetryConfig gives the retry config with default values, these are used for the properties which are not
+// set in the retry block
+func NewDefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:          3,
+		Backoff:              "exponential",
+		InitialBackoffMs:     100,
+		MaxBackoffMs:         2000,
+		RetryableStatusCodes: []int{502, 503, 504},
+		RetryableErrors:      []string{"timeout", "connection"},
+		RespectRetryAfter:    true,
+		IdempotentOnly:       true,
+	}
+}
+
+// RetryBudgetConfig limits retries to a percentage of recent requests (token bucket), so a failing backend does not
+// get N times the load. It can be set on an api and on a server (shared by all apis of the server).
+type RetryBudgetConfig struct {
+	// Percent of requests which can be retried e.g. 20 = every request adds 0.2 token, and every retry takes 1 token
+	Percent int `json:"percent" yaml:"percent"`
+
+	// MinRetriesPerSecond is always allowed, so that apis with low traffic can still retry
+	MinRetriesPerSecond int `json:"min_retries_per_second" yaml:"min_retries_per_second"`
+
+	// MaxTokens is the max tokens which can be saved, it limits the burst of retries after a long healthy period
+	MaxTokens int `json:"max_tokens" yaml:"max_tokens"`
+}
+
+// NewDefaultRetryBudgetConfig gives the retry budget config with default values
+func NewDefaultRetryBudgetConfig() *RetryBudgetConfig {
+	return &RetryBudgetConfig{
+		Percent:             20,
+		MinRetriesPerSecond: 10,
+		MaxTokens:           100,
+	}
+}
+
+// HedgingConfig is the setup of request hedging of an api. If the first attempt has no response within delay_ms, then
+// another attempt is sent in parallel (up to max_extra), and the first acceptable response is used. Only idempotent
+// requests are hedged.
+type HedgingConfig struct {
+	DelayMs  int `json:"delay_ms" yaml:"delay_ms"`
+	MaxExtra int `json:"max_extra" yaml:"max_extra"`
+}
+
+// NewDefaultHedgingConfig gives the hedging config with default values
+func NewDefaultHedgingConfig() *HedgingConfig {
+	return &HedgingConfig{
+		DelayMs:  20,
+		MaxExtra: 1,
+	}
+}
+
+// AdaptiveConcurrencyConfig changes the in-flight limit of an api with the observed latency and errors (like Netflix
+// concurrency-limits), instead of a fixed limit. The concurrency of the api is the max limit.
+type AdaptiveConcurrencyConfig struct {
+	// Algorithm is "gradient" (default) or "aimd"
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+
+	MinLimit int `json:"min_limit" yaml:"min_limit"`
+
+	// InitialLimit is the limit to start with, default is the concurrency of the api
+	InitialLimit int `json:"initial_limit" yaml:"initial_limit"`
+
+	// BackoffRatio is the factor by which aimd reduces the limit on a timeout or overload (429/503) response
+	BackoffRatio float64 `json:"backoff_ratio" yaml:"backoff_ratio"`
+
+	// LatencyThresholdMs makes aimd treat a slower request as overload (0 = only errors are used)
+	LatencyThresholdMs int `json:"latency_threshold_ms" yaml:"latency_threshold_ms"`
+
+	// Smoothing is the weight of a new sample in the limit of gradient (0 to 1)
+	Smoothing float64 `json:"smoothing" yaml:"smoothing"`
+
+	// RttTolerance is how much the latency can grow over the long term average before gradient reduces the limit
+	// e.g. 1.5 = 50% higher latency is fine
+	RttTolerance float64 `json:"rtt_tolerance" yaml:"rtt_tolerance"`
+}
+
+const AdaptiveConcurrencyGradient = "gradient"
+const AdaptiveConcurrencyAimd = "aimd"
+
+// NewDefaultAdaptiveConcurrencyConfig gives the adaptive concurrency config with default values
+func NewDefaultAdaptiveConcurrencyConfig() *AdaptiveConcurrencyConfig {
+	return &AdaptiveConcurrencyConfig{
+		Algorithm:    AdaptiveConcurrencyGradient,
+		MinLimit:     1,
+		BackoffRatio: 0.9,
+		Smoothing:    0.2,
+		RttTolerance: 1.5,
+	}
+}
+
+// RateLimitConfig is the client side rate limit (token bucket) of an api, or of a server (shared by all apis of the
+// server). It is checked before every attempt sent to the network, including retries and hedged attempts.
+type RateLimitConfig struct {
+	// Rps is the number of requests per second, 0 means no limit
+	Rps float64 `json:"rps" yaml:"rps"`
+
+	// Burst is the max number of requests which can be sent at once, default is rps (min 1)
+	Burst int `json:"burst" yaml:"burst"`
+
+	// Mode is "wait" (default) to wait for a token, or "reject" to fail the request at once. In wait mode a request
+	// fails at once if it cannot get a token before the deadline of its context.
+	Mode string `json:"mode" yaml:"mode"`
+
+	// AdaptToHeaders pauses requests when the server says so - Retry-After header with 429/503 response, or
+	// X-RateLimit-Remaining=0 with X-RateLimit-Reset header
+	AdaptToHeaders bool `json:"adapt_to_headers" yaml:"adapt_to_headers"`
+}
+
+const RateLimitModeWait = "wait"
+const RateLimitModeReject = "reject"
+
+// NewDefaultRateLimitConfig gives the rate limit config with default values
+func NewDefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Mode:           RateLimitModeWait,
+		AdaptToHeaders: true,
+	}
+}
+
+// CircuitBreakerConfig is the circuit breaker setup of an api. It can also be set on a server, to give defaults for
+// all apis of the server - a property which is not set (0 or empty) in the api is taken from the server.
+type CircuitBreakerConfig struct {
+	// ErrorPercentThreshold is the error percentage at which circuit opens
+	ErrorPercentThreshold int `json:"error_percent_threshold" yaml:"error_percent_threshold"`
+
+	// RequestVolumeThreshold is the min number of requests (in the rolling window) before circuit can open
+	RequestVolumeThreshold int `json:"request_volume_threshold" yaml:"request_volume_threshold"`
+
+	// SleepWindowMs is the time to wait after circuit opens, before we test if backend has recovered
+	SleepWindowMs int `json:"sleep_window_ms" yaml:"sleep_window_ms"`
+
+	// TimeoutMs overrides the timeout of the circuit breaker, by default it is the api timeout (incl. retries) + 10%
+	TimeoutMs int `json:"timeout_ms" yaml:"timeout_ms"`
+
+	// Scope is "api" (default) for a breaker per api, or "server" to share one breaker by all apis of the server
+	Scope string `json:"scope" yaml:"scope"`
+
+	// Type is "hystrix" (default) or "native" (built-in sliding window breaker)
+	Type string `json:"type" yaml:"type"`
+
+	// WindowMs is the rolling window in which errors are counted (only for native breaker)
+	WindowMs int `json:"window_ms" yaml:"window_ms"`
+
+	// HalfOpenProbes is the number of calls allowed in half-open state, circuit closes if all of them succeed (only
+	// for native breaker)
+	HalfOpenProbes int `json:"half_open_probes" yaml:"half_open_probes"`
+}
+
+const CircuitBreakerScopeApi = "api"
+const CircuitBreakerScopeServer = "server"
+const CircuitBreakerTypeHystrix = "hystrix"
+const CircuitBreakerTypeNative = "native"
+
+// Endpoint is one host of a server which runs on multiple hosts (replicas). If a server has endpoints, requests are
+// spread over them by the load balancer, and host/port of the server are not used.
+type Endpoint struct {
+	Host string `json:"host" yaml:"host"`
+
+	// Port of this endpoint, default is the port of the server
+	Port int `json:"port" yaml:"port"`
+
+	// Weight is used by the "weighted" strategy (default 1)
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+// LoadBalancerConfig is the setup to spread requests over the endpoints of a server
+type LoadBalancerConfig struct {
+	// Strategy is one of round_robin (default), weighted, least_outstanding or power_of_two_choices
+	Strategy string `json:"strategy" yaml:"strategy"`
+
+	// UnhealthyThreshold is the number of consecutive failures (error or 5xx) after which an endpoint is taken out
+	UnhealthyThreshold int `json:"unhealthy_threshold" yaml:"unhealthy_threshold"`
+
+	// UnhealthyDurationMs is the time an unhealthy endpoint is kept out, after this it gets requests again
+	UnhealthyDurationMs int `json:"unhealthy_duration_ms" yaml:"unhealthy_duration_ms"`
+}
+
+// OutlierDetectionConfig is the setup to eject bad endpoints of a server from the load balancer. An endpoint is ejected
+// for base_ejection_time_ms, and the time doubles every time the same endpoint is ejected again (up to
+// max_ejection_time_ms).
+type OutlierDetectionConfig struct {
+	// Consecutive5xx is the number of 5xx responses in a row after which the endpoint is ejected
+	Consecutive5xx int `json:"consecutive_5xx" yaml:"consecutive_5xx"`
+
+	// ConsecutiveConnectFailures is the number of connect failures (or timeouts) in a row after which the endpoint
+	// is ejected
+	ConsecutiveConnectFailures int `json:"consecutive_connect_failures" yaml:"consecutive_connect_failures"`
+
+	// LatencyThresholdMs ejects an endpoint when its average latency is over this (0 = disabled)
+	LatencyThresholdMs int `json:"latency_threshold_ms" yaml:"latency_threshold_ms"`
+
+	// MinRequests is the min number of requests to an endpoint before latency is checked
+	MinRequests int `json:"min_requests" yaml:"min_requests"`
+
+	BaseEjectionTimeMs int `json:"base_ejection_time_ms" yaml:"base_ejection_time_ms"`
+	MaxEjectionTimeMs  int `json:"max_ejection_time_ms" yaml:"max_ejection_time_ms"`
+
+	// MaxEjectionPercent is the max percentage of endpoints which can be ejected at the same time (one endpoint can
+	// always be ejected)
+	MaxEjectionPercent int `json:"max_ejection_percent" yaml:"max_ejection_percent"`
+}
+
+// NewDefaultOutlierDetectionConfig gives the outlier detection config with default values
+func NewDefaultOutlierDetectionConfig() *OutlierDetectionConfig {
+	return &OutlierDetectionConfig{
+		Consecutive5xx:             5,
+		ConsecutiveConnectFailures: 5,
+		MinRequests:                10,
+		BaseEjectionTimeMs:         30000,
+		MaxEjectionTimeMs:          300000,
+		MaxEjectionPercent:         50,
+	}
+}
+
+// HealthCheckConfig is the setup of active health check of a server. Every endpoint (or the host of a server without
+// endpoints) is checked with a GET request to the path.
+type HealthCheckConfig struct {
+	Path       string `json:"path" yaml:"path"`
+	IntervalMs int    `json:"interval_ms" yaml:"interval_ms"`
+	TimeoutMs  int    `json:"timeout_ms" yaml:"timeout_ms"`
+
+	// HealthyThreshold is the number of successful checks in a row to mark a down endpoint as up
+	HealthyThreshold int `json:"healthy_threshold" yaml:"healthy_threshold"`
+
+	// UnhealthyThreshold is the number of failed checks in a row to mark an endpoint as down
+	UnhealthyThreshold int `json:"unhealthy_threshold" yaml:"unhealthy_threshold"`
+
+	// ExpectedCodes are the status codes of a healthy response
+	ExpectedCodes []int `json:"expected_codes" yaml:"expected_codes"`
+}
+
+// NewDefaultHealthCheckConfig gives the health check config with default values
+func NewDefaultHealthCheckConfig() *HealthCheckConfig {
+	return &HealthCheckConfig{
+		Path:               "/health",
+		IntervalMs:         10000,
+		TimeoutMs:          1000,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+		ExpectedCodes:      []int{200},
+	}
+}
+
+const LoadBalancerRoundRobin = "round_robin"
+const LoadBalancerWeighted = "weighted"
+const LoadBalancerLeastOutstanding = "least_outstanding"
+const LoadBalancerPowerOfTwoChoices = "power_of_two_choices"
+
+// NewDefaultLoadBalancerConfig gives the load balancer config with default values
+func NewDefaultLoadBalancerConfig() *LoadBalancerConfig {
+	return &LoadBalancerConfig{
+		Strategy:            LoadBalancerRoundRobin,
+		UnhealthyThreshold:  5,
+		UnhealthyDurationMs: 10000,
+	}
+}
+
+// Resolver gives the current endpoints of a server (service discovery). It is called periodically to refresh the
+// endpoints used by the load balancer.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]*Endpoint, error)
+}
+
+// DiscoveryConfig is the setup of a built-in Resolver
+type DiscoveryConfig struct {
+	// Type is one of dns_srv, dns_a or file
+	Type string `json:"type" yaml:"type"`
+
+	// Name is the DNS name to resolve (for dns_srv e.g. "_http._tcp.users.service.consul")
+	Name string `json:"name" yaml:"name"`
+
+	// File is the yaml file with the list of endpoints (for file type), it is read again on every refresh
+	File string `json:"file" yaml:"file"`
+
+	// Port of the endpoints found with dns_a, default is the port of the server
+	Port int `json:"port" yaml:"port"`
+
+	// DnsServer is the address (host:port) of the DNS server to use, default is the system resolver
+	DnsServer string `json:"dns_server" yaml:"dns_server"`
+
+	// RefreshIntervalMs is the time between two refreshes of endpoints
+	RefreshIntervalMs int `json:"refresh_interval_ms" yaml:"refresh_interval_ms"`
+
+	// TimeoutMs is the max time of one refresh
+	TimeoutMs int `json:"timeout_ms" yaml:"timeout_ms"`
+}
+
+const DiscoveryTypeDnsSrv = "dns_srv"
+const DiscoveryTypeDnsA = "dns_a"
+const DiscoveryTypeFile = "file"
+
+// NewDefaultDiscoveryConfig gives the discovery config with default values
+func NewDefaultDiscoveryConfig() *DiscoveryConfig {
+	return &DiscoveryConfig{
+		RefreshIntervalMs: 30000,
+		TimeoutMs:         5000,
 	}
+}
+
+// Cache stores responses of GET apis (see CacheConfig). Implementations must be safe for concurrent use. Entries
+// must not be modified after Set, the same entry may be given to many callers.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+}
+
+// CachedResponse is a response stored in the Cache
+type CachedResponse struct {
+	StatusCode int
+	Body       []byte
+	Header     http.Header
+	StoredAt   time.Time
+
+	// FreshUntil is the time till which the response is used without asking the server
+	FreshUntil time.Time
+
+	// StaleUntil is the time till which a stale response is still used while it is revalidated in background
+	// (stale-while-revalidate)
+	StaleUntil time.Time
+}
+
+// CacheConfig is the setup of response cache of an api (only GET and HEAD). Responses are cached as per their
+// Cache-Control and Expires headers, and revalidated with ETag/Last-Modified when they are stale.
+type CacheConfig struct {
+	// MaxEntries is the size of the built-in in-memory LRU cache
+	MaxEntries int `json:"max_entries" yaml:"max_entries"`
+
+	// DefaultTtlMs is the time to cache a response which does not have Cache-Control or Expires (0 = not cached)
+	DefaultTtlMs int `json:"default_ttl_ms" yaml:"default_ttl_ms"`
+
+	// KeyPathParams and KeyQueryParams are the params used in the cache key, all params are used if empty
+	KeyPathParams  []string `json:"key_path_params" yaml:"key_path_params"`
+	KeyQueryParams []string `json:"key_query_params" yaml:"key_query_params"`
+
+	// KeyHeaders are the request headers used in the cache key e.g. Accept-Language
+	KeyHeaders []string `json:"key_headers" yaml:"key_headers"`
+
+	// Store is a custom cache, it is used instead of the built-in in-memory LRU cache if set
+	Store Cache `yaml:"-" json:"-"`
+}
+
+// NewDefaultCacheConfig gives the cache config with default values
+func NewDefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		MaxEntries: 1000,
+	}
+}
+
+const FallbackTriggerCircuitOpen = "circuit_open"
+const FallbackTriggerTimeout = "timeout"
+const FallbackTrigger5xx = "5xx"
+
+// FallbackFunc gives the response of a failed request of an api, err is the error of the request. The response and
+// error returned by it are given to the caller as is. ctx may be already done e.g. if the request timed out.
+type FallbackFunc func(ctx context.Context, request *GoxRequest, err error) (*GoxResponse, error)
+
+// FallbackConfig is the setup of fallback of an api - the response to give when a request fails due to open circuit,
+// timeout or 5xx. A FallbackFunc registered for the api is used first, then the last known good response, and then
+// the static response.
+type FallbackConfig struct {
+	// Triggers are the failures which use the fallback - circuit_open, timeout, 5xx (all if empty)
+	Triggers []string `json:"triggers" yaml:"triggers"`
+
+	// StaticBody and StaticStatusCode are the static response, it is used if any of them is set (status code
+	// defaults to 200)
+	StaticBody       string `json:"static_body" yaml:"static_body"`
+	StaticStatusCode int    `json:"static_status_code" yaml:"static_status_code"`
+
+	// LastKnownGood keeps the last successful response of each request (only GET and HEAD) to give it on failure, if
+	// it is not older than LastKnownGoodMaxAgeMs (0 = no limit)
+	LastKnownGood         bool `json:"last_known_good" yaml:"last_known_good"`
+	LastKnownGoodMaxAgeMs int  `json:"last_known_good_max_age_ms" yaml:"last_known_good_max_age_ms"`
+
+	// MaxEntries is the number of last known good responses kept in memory
+	MaxEntries int `json:"max_entries" yaml:"max_entries"`
+}
+
+// NewDefaultFallbackConfig gives the fallback config with default values
+func NewDefaultFallbackConfig() *FallbackConfig {
+	return &FallbackConfig{
+		MaxEntries: 1000,
+	}
+}
+
+func (a *Api) GetTimeoutWithRetryIncluded() int {
 
 	// Set timeout + 10% delta
 	timeout := a.Timeout
 
-	// Add extra time to handle retry counts
-	if a.RetryCount > 0 {
+	if a.Retry != nil {
+		if a.Retry.MaxAttempts <= 1 {
+			return a.Timeout
+		}
+		timeout = (timeout * a.Retry.MaxAttempts) + (a.Retry.MaxBackoffMs * (a.Retry.MaxAttempts - 1))
+	} else if a.RetryCount <= 0 {
+		return a.Timeout
+	} else {
+		// Add extra time to handle retry counts
 		timeout = timeout + (timeout * a.RetryCount) + a.InitialRetryWaitTimeMs
 	}
 
@@ -88,6 +574,32 @@ func (a *Api) GetTimeoutWithRetryIncluded() int {
 	return timeout
 }
 
+// knownHttpMethods are the methods which can be used in api config - standard methods, and the common extension
+// methods of WebDAV and caches. Any other method must be registered with RegisterHttpMethod.
+var knownHttpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+	"PURGE": true, "QUERY": true, "LINK": true, "UNLINK": true,
+	"PROPFIND": true, "PROPPATCH": true, "MKCOL": true, "COPY": true, "MOVE": true, "LOCK": true, "UNLOCK": true,
+	"SEARCH": true, "REPORT": true, "MKCALENDAR": true,
+}
+var knownHttpMethodsLock = &sync.RWMutex{}
+
+// RegisterHttpMethod allows a custom method (e.g. a method of an internal service) to be used in api config. It must
+// be called before the api is created.
+func RegisterHttpMethod(method string) {
+	knownHttpMethodsLock.Lock()
+	defer knownHttpMethodsLock.Unlock()
+	knownHttpMethods[strings.ToUpper(method)] = true
+}
+
+// IsKnownHttpMethod checks if the method (case-insensitive) can be used in api config
+func IsKnownHttpMethod(method string) bool {
+	knownHttpMethodsLock.RLock()
+	defer knownHttpMethodsLock.RUnlock()
+	return knownHttpMethods[strings.ToUpper(method)]
+}
+
 // ****************************************************************************************
 // IMP NOTE - "config_parser.go -> UnmarshalYAML() method is created to do custom parsing.
 // If you change anything here (add/update/delete) you must make changes in UnmarshalYAML()
@@ -118,6 +630,26 @@ type GoxRequest struct {
 	Body            interface{}     `json:"body"`
 	BodyProvider    BodyProvider    `json:"-"`
 	ResponseBuilder ResponseBuilder `json:"-"`
+
+	// Multipart are the parts of a multipart/form-data request, if set then it is the body of the request (Body and
+	// BodyProvider are not used)
+	Multipart []*MultipartPart `json:"-"`
+}
+
+// MultipartPart is a part (form field or file) of a multipart/form-data request. Reader is streamed to the server when
+// the request is sent. A retry, or the digest of the hmac interceptor, reads it again from the position it had when the
+// request was sent - this needs an io.Seeker (e.g. *os.File, *bytes.Reader or *strings.Reader).
+type MultipartPart struct {
+	Name     string
+	FileName string
+
+	// ContentType of the part, application/octet-stream is used for a file part without content type
+	ContentType string
+
+	// Header has extra headers of the part (Content-Disposition and Content-Type are set from the other fields)
+	Header textproto.MIMEHeader
+
+	Reader io.Reader
 }
 
 type GoxResponse struct {
@@ -125,6 +657,63 @@ type GoxResponse struct {
 	Response   interface{}
 	StatusCode int
 	Err        error
+
+	// ResponseMetadata has the headers and protocol details of the response from server
+	ResponseMetadata
+
+	// FromCache is true if the response is served from the response cache of the api (with or without revalidation)
+	FromCache bool
+
+	// FromFallback is true if the request failed and this response is given by the fallback of the api
+	FromFallback bool
+}
+
+// GoxStreamResponse is the response of ExecuteStream. Body is read from the server while the caller reads it (it is
+// not kept in memory), and the caller must close it. Trailer is filled when Body is read fully.
+//
+// If the request failed then Body has the body of the error response (if any).
+type GoxStreamResponse struct {
+	Body       io.ReadCloser
+	StatusCode int
+
+	// ResponseMetadata has the headers and protocol details of the response from server
+	ResponseMetadata
+}
+
+// ResponseMetadata is the detail of a response other than status and body. Header, Trailer, Url and Proto are empty if
+// there was no response from server (e.g. timeout), and Header has the stored headers for a response from cache.
+type ResponseMetadata struct {
+	Header  http.Header
+	Trailer http.Header
+
+	// Url is the final url of the request, after redirects
+	Url string
+
+	// Proto is the protocol of the response e.g. HTTP/1.1 or HTTP/2.0
+	Proto string
+
+	// Attempts is the number of requests sent to the server - including retries and hedged attempts
+	Attempts int
+
+	// Latency is the total time taken by the request to the server - including retries (but not the time spent in the
+	// wait queue or rate limit)
+	Latency time.Duration
+}
+
+// NewGoxResponseFromResult merges the result of Execute into a single response, which is used to deliver the result
+// of async execution. Err of the returned response is set to err if it is not already set.
+func NewGoxResponseFromResult(response *GoxResponse, err error) *GoxResponse {
+	if response == nil {
+		response = &GoxResponse{}
+		var goxErr *GoxHttpError
+		if errors.As(err, &goxErr) {
+			response.StatusCode = goxErr.StatusCode
+		}
+	}
+	if response.Err == nil {
+		response.Err = err
+	}
+	return response
 }
 
 func (r *GoxResponse) AsStringObjectMapOrEmpty() gox.StringObjectMap {
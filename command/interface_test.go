@@ -19,6 +19,11 @@ func TestParseConfig(t *testing.T) {
 	assert.Equal(t, true, config.Servers["jsonplaceholder"].Https)
 	assert.Equal(t, 1000, config.Servers["jsonplaceholder"].ConnectTimeout)
 	assert.Equal(t, 1000, config.Servers["jsonplaceholder"].ConnectionRequestTimeout)
+	assert.Equal(t, 10000, config.Servers["jsonplaceholder"].TlsHandshakeTimeout)
+	assert.Equal(t, 0, config.Servers["jsonplaceholder"].ResponseHeaderTimeout)
+	assert.Equal(t, 100, config.Servers["jsonplaceholder"].MaxIdleConnectionsPerHost)
+	assert.Equal(t, 0, config.Servers["jsonplaceholder"].MaxConnectionsPerHost)
+	assert.Equal(t, 90000, config.Servers["jsonplaceholder"].IdleConnectionTimeout)
 	assert.Equal(t, "localhost", config.Servers["testServer"].Host)
 	assert.Equal(t, 9123, config.Servers["testServer"].Port)
 
@@ -48,6 +53,33 @@ func TestParseConfig(t *testing.T) {
 	assert.Equal(t, false, config.Apis["post_api_with_delay_2000"].DisableHystrix)
 }
 
+func TestParseConfig_QueueSize(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    concurrency: 5
+    queue_size: 20
+  getOrder:
+    path: /orders
+    concurrency: 5
+    async: true
+    async_queue_size: 50
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	assert.Equal(t, 20, config.Apis["getUser"].QueueSize)
+	assert.True(t, config.Apis["getUser"].HasWaitQueue())
+	assert.Equal(t, 10, config.Apis["getOrder"].QueueSize)
+	assert.False(t, config.Apis["getOrder"].HasWaitQueue())
+
+	// Queue of async worker pool is not the wait queue of the api
+	assert.Equal(t, 10, config.Apis["getUser"].AsyncQueueSize)
+	assert.Equal(t, 50, config.Apis["getOrder"].AsyncQueueSize)
+}
+
 // servers:
 //
 //	jsonplaceholder:
@@ -92,8 +124,8 @@ func TestParseConfigWithParameterizedConfig_WithDefaultEnv(t *testing.T) {
 	assert.Equal(t, "localhost.prod", serverConfig.Host)
 	assert.Equal(t, 9123, serverConfig.Port)
 	assert.Equal(t, true, serverConfig.Https)
-	assert.Equal(t, 50, serverConfig.ConnectTimeout)
-	assert.Equal(t, 50, serverConfig.ConnectionRequestTimeout)
+	assert.Equal(t, 30000, serverConfig.ConnectTimeout)
+	assert.Equal(t, 0, serverConfig.ConnectionRequestTimeout)
 
 	// Test a parameterized var
 	assert.Equal(t, "localhost.prod", config.Servers["testServer"].Host)
@@ -153,8 +185,8 @@ func TestParseConfigWithParameterizedConfig_WithDev(t *testing.T) {
 	assert.Equal(t, "localhost.dev", serverConfig.Host)
 	assert.Equal(t, 9123, serverConfig.Port)
 	assert.Equal(t, false, serverConfig.Https)
-	assert.Equal(t, 50, serverConfig.ConnectTimeout)
-	assert.Equal(t, 50, serverConfig.ConnectionRequestTimeout)
+	assert.Equal(t, 30000, serverConfig.ConnectTimeout)
+	assert.Equal(t, 0, serverConfig.ConnectionRequestTimeout)
 
 	api := config.Apis["delay_timeout_10"]
 	assert.Equal(t, "GET", api.Method)
@@ -177,3 +209,418 @@ func TestParseConfigWithParameterizedConfig_WithDev(t *testing.T) {
 	assert.Equal(t, 200, api.Concurrency)
 	assert.True(t, api.DisableHystrix)
 }
+
+func TestParseConfig_Tls(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  secure:
+    host: localhost
+    port: 443
+    https: true
+    tls:
+      ca_file: /etc/certs/ca.pem
+      cert_file: /etc/certs/client.pem
+      key_file: /etc/certs/client-key.pem
+      min_version: "1.2"
+      cipher_suites:
+        - TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+      server_name: secure.example.com
+      pinned_spki_sha256:
+        - abc=
+      reload_interval_ms: 5000
+  plain:
+    host: localhost
+apis:
+  get:
+    path: /
+    server: secure
+`, &config)
+	assert.NoError(t, err)
+	tls := config.Servers["secure"].Tls
+	assert.NotNil(t, tls)
+	assert.Equal(t, "/etc/certs/ca.pem", tls.CaFile)
+	assert.Equal(t, "/etc/certs/client.pem", tls.CertFile)
+	assert.Equal(t, "/etc/certs/client-key.pem", tls.KeyFile)
+	assert.Equal(t, "1.2", tls.MinVersion)
+	assert.Equal(t, []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, tls.CipherSuites)
+	assert.Equal(t, "secure.example.com", tls.ServerName)
+	assert.Equal(t, []string{"abc="}, tls.PinnedSpkiSha256)
+	assert.Equal(t, 5000, tls.ReloadIntervalMs)
+	assert.Nil(t, config.Servers["plain"].Tls)
+}
+
+func TestParseConfig_Retry(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+apis:
+  withRetry:
+    path: /
+    server: testServer
+    timeout: 100
+    retry:
+      max_attempts: 4
+      backoff: decorrelated_jitter
+      retryable_status_codes: [429, 503]
+      idempotent_only: false
+  withoutRetry:
+    path: /
+    server: testServer
+    timeout: 100
+    retry_count: 2
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	retry := config.Apis["withRetry"].Retry
+	assert.NotNil(t, retry)
+	assert.Equal(t, 4, retry.MaxAttempts)
+	assert.Equal(t, "decorrelated_jitter", retry.Backoff)
+	assert.Equal(t, 100, retry.InitialBackoffMs)
+	assert.Equal(t, 2000, retry.MaxBackoffMs)
+	assert.Equal(t, []int{429, 503}, retry.RetryableStatusCodes)
+	assert.Equal(t, []string{"timeout", "connection"}, retry.RetryableErrors)
+	assert.True(t, retry.RespectRetryAfter)
+	assert.False(t, retry.IdempotentOnly)
+	assert.Equal(t, 7040, config.Apis["withRetry"].GetTimeoutWithRetryIncluded())
+
+	assert.Nil(t, config.Apis["withoutRetry"].Retry)
+	assert.Equal(t, 2, config.Apis["withoutRetry"].RetryCount)
+}
+
+func TestParseConfig_RetryBudget(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+    retry_budget:
+      percent: 10
+apis:
+  get:
+    path: /
+    server: testServer
+    retry_budget:
+      percent: 25
+      min_retries_per_second: 5
+      max_tokens: 50
+`, &config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, &RetryBudgetConfig{Percent: 10, MinRetriesPerSecond: 10, MaxTokens: 100}, config.Servers["testServer"].RetryBudget)
+	assert.Equal(t, &RetryBudgetConfig{Percent: 25, MinRetriesPerSecond: 5, MaxTokens: 50}, config.Apis["get"].RetryBudget)
+}
+
+func TestParseConfig_CircuitBreaker(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    host: localhost
+    circuit_breaker:
+      error_percent_threshold: 50
+      sleep_window_ms: 10000
+      scope: server
+apis:
+  withBreaker:
+    path: /
+    server: testServer
+    circuit_breaker:
+      request_volume_threshold: 30
+      timeout_ms: 500
+  withoutBreaker:
+    path: /
+    server: testServer
+`, &config)
+	assert.NoError(t, err)
+
+	server := config.Servers["testServer"]
+	assert.Equal(t, &CircuitBreakerConfig{ErrorPercentThreshold: 50, SleepWindowMs: 10000, Scope: "server"}, server.CircuitBreaker)
+	assert.Equal(t, &CircuitBreakerConfig{RequestVolumeThreshold: 30, TimeoutMs: 500}, config.Apis["withBreaker"].CircuitBreaker)
+
+	// Api config is merged with server config and defaults
+	assert.Equal(t,
+		&CircuitBreakerConfig{ErrorPercentThreshold: 50, RequestVolumeThreshold: 30, SleepWindowMs: 10000, TimeoutMs: 500, Scope: "server", Type: "hystrix", WindowMs: 10000, HalfOpenProbes: 1},
+		config.Apis["withBreaker"].GetCircuitBreakerConfig(server),
+	)
+	assert.Equal(t,
+		&CircuitBreakerConfig{ErrorPercentThreshold: 25, RequestVolumeThreshold: 20, SleepWindowMs: 5000, Scope: "api", Type: "hystrix", WindowMs: 10000, HalfOpenProbes: 1},
+		config.Apis["withoutBreaker"].GetCircuitBreakerConfig(&Server{}),
+	)
+}
+
+func TestParseConfig_Endpoints(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    port: 8080
+    endpoints:
+      - host: host-1
+      - host: host-2
+        port: 9090
+        weight: 3
+    load_balancer:
+      strategy: weighted
+      unhealthy_threshold: 2
+  otherServer:
+    endpoints:
+      - host: host-3
+apis:
+  getUser:
+    path: /users
+    server: testServer
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	server := config.Servers["testServer"]
+	assert.Equal(t, []*Endpoint{{Host: "host-1", Port: 8080, Weight: 1}, {Host: "host-2", Port: 9090, Weight: 3}}, server.Endpoints)
+	assert.Equal(t, &LoadBalancerConfig{Strategy: "weighted", UnhealthyThreshold: 2, UnhealthyDurationMs: 10000}, server.LoadBalancer)
+	assert.Equal(t, "http://host-2:9090/users", config.Apis["getUser"].GetPathForEndpoint(server, server.Endpoints[1]))
+
+	// Load balancer with defaults is used if not given
+	assert.Equal(t, NewDefaultLoadBalancerConfig(), config.Servers["otherServer"].LoadBalancer)
+}
+
+func TestParseConfig_Discovery(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    port: 8080
+    discovery:
+      type: dns_srv
+      name: _http._tcp.users.internal
+      refresh_interval_ms: 10000
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	server := config.Servers["testServer"]
+	assert.Equal(t, &DiscoveryConfig{Type: "dns_srv", Name: "_http._tcp.users.internal", RefreshIntervalMs: 10000, TimeoutMs: 5000}, server.Discovery)
+	assert.Equal(t, NewDefaultLoadBalancerConfig(), server.LoadBalancer)
+}
+
+func TestParseConfig_OutlierDetection(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    endpoints:
+      - host: host-1
+    outlier_detection:
+      consecutive_5xx: 3
+      latency_threshold_ms: 500
+      max_ejection_percent: 30
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	expected := NewDefaultOutlierDetectionConfig()
+	expected.Consecutive5xx = 3
+	expected.LatencyThresholdMs = 500
+	expected.MaxEjectionPercent = 30
+	assert.Equal(t, expected, config.Servers["testServer"].OutlierDetection)
+}
+
+func TestParseConfig_HealthCheck(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    health_check:
+      path: /ping
+      expected_codes: [200, 204]
+  defaultServer:
+    health_check: {}
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	expected := NewDefaultHealthCheckConfig()
+	expected.Path = "/ping"
+	expected.ExpectedCodes = []int{200, 204}
+	assert.Equal(t, expected, config.Servers["testServer"].HealthCheck)
+	assert.Equal(t, NewDefaultHealthCheckConfig(), config.Servers["defaultServer"].HealthCheck)
+}
+
+func TestParseConfig_Hedging(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users
+    hedging:
+      delay_ms: 50
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+	assert.Equal(t, &HedgingConfig{DelayMs: 50, MaxExtra: 1}, config.Apis["getUser"].Hedging)
+	assert.Nil(t, config.Apis["getOrder"].Hedging)
+}
+
+func TestParseConfig_RateLimit(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+servers:
+  testServer:
+    rate_limit:
+      rps: 50
+      burst: 10
+apis:
+  getUser:
+    path: /users
+    rate_limit:
+      rps: 2.5
+      mode: reject
+      adapt_to_headers: false
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	assert.Equal(t, &RateLimitConfig{Rps: 50, Burst: 10, Mode: RateLimitModeWait, AdaptToHeaders: true}, config.Servers["testServer"].RateLimit)
+	assert.Equal(t, &RateLimitConfig{Rps: 2.5, Burst: 3, Mode: RateLimitModeReject}, config.Apis["getUser"].RateLimit)
+	assert.Nil(t, config.Apis["getOrder"].RateLimit)
+}
+
+func TestParseConfig_AdaptiveConcurrency(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users
+    concurrency: 50
+    adaptive_concurrency:
+      algorithm: aimd
+      min_limit: 5
+  getOrder:
+    path: /orders
+    concurrency: 4
+    adaptive_concurrency:
+      initial_limit: 10
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	expected := NewDefaultAdaptiveConcurrencyConfig()
+	expected.Algorithm = AdaptiveConcurrencyAimd
+	expected.MinLimit = 5
+	expected.InitialLimit = 50
+	assert.Equal(t, expected, config.Apis["getUser"].AdaptiveConcurrency)
+
+	// Initial limit is capped to concurrency
+	expected = NewDefaultAdaptiveConcurrencyConfig()
+	expected.InitialLimit = 4
+	assert.Equal(t, expected, config.Apis["getOrder"].AdaptiveConcurrency)
+}
+
+func TestParseConfig_Cache(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    cache:
+      default_ttl_ms: 60000
+      key_query_params: [lang]
+      key_headers: [Accept-Language]
+  getOrder:
+    path: /orders
+    cache: {}
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	assert.Equal(t, &CacheConfig{MaxEntries: 1000, DefaultTtlMs: 60000, KeyQueryParams: []string{"lang"}, KeyHeaders: []string{"Accept-Language"}}, config.Apis["getUser"].Cache)
+	assert.Equal(t, NewDefaultCacheConfig(), config.Apis["getOrder"].Cache)
+}
+
+func TestParseConfig_Coalesce(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    coalesce: true
+    coalesce_key_headers: [Authorization]
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	assert.True(t, config.Apis["getUser"].Coalesce)
+	assert.Equal(t, []string{"Authorization"}, config.Apis["getUser"].CoalesceKeyHeaders)
+	assert.False(t, config.Apis["getOrder"].Coalesce)
+	assert.Nil(t, config.Apis["getOrder"].CoalesceKeyHeaders)
+}
+
+func TestParseConfig_Fallback(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    fallback:
+      triggers: [circuit_open, timeout]
+      static_body: '{"name": "unknown"}'
+      last_known_good: true
+      last_known_good_max_age_ms: 60000
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+	config.SetupDefaults()
+
+	assert.Equal(t, &FallbackConfig{
+		Triggers:              []string{FallbackTriggerCircuitOpen, FallbackTriggerTimeout},
+		StaticBody:            `{"name": "unknown"}`,
+		StaticStatusCode:      200,
+		LastKnownGood:         true,
+		LastKnownGoodMaxAgeMs: 60000,
+		MaxEntries:            1000,
+	}, config.Apis["getUser"].Fallback)
+	assert.Nil(t, config.Apis["getOrder"].Fallback)
+}
+
+func TestParseConfig_Codec(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    request_codec: application/x-www-form-urlencoded
+    response_codec: application/xml
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ContentTypeForm, config.Apis["getUser"].RequestCodec)
+	assert.Equal(t, ContentTypeXml, config.Apis["getUser"].ResponseCodec)
+	assert.Empty(t, config.Apis["getOrder"].RequestCodec)
+	assert.Empty(t, config.Apis["getOrder"].ResponseCodec)
+}
+
+func TestParseConfig_MaxResponseBytes(t *testing.T) {
+	config := Config{}
+	err := serialization.ReadYamlFromString(`
+apis:
+  getUser:
+    path: /users/{id}
+    max_response_bytes: 1048576
+  getOrder:
+    path: /orders
+`, &config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1048576, config.Apis["getUser"].MaxResponseBytes)
+	assert.Equal(t, 0, config.Apis["getOrder"].MaxResponseBytes)
+}
@@ -5,7 +5,10 @@ import (
 	"github.com/devlibx/gox-base/v2/errors"
 	"github.com/devlibx/gox-base/v2/serialization"
 	"github.com/devlibx/gox-base/v2/util"
+	"io"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -15,12 +18,20 @@ func (c *Config) SetupDefaults() {
 	// Fill defaults in servers
 	if c.Servers != nil {
 		for k, v := range c.Servers {
-			v.Name = k
+			if v.Name != k {
+				v.Name = k
+			}
 			if v.ConnectTimeout <= 0 {
-				v.ConnectTimeout = 50
+				v.ConnectTimeout = 30000
+			}
+			if v.TlsHandshakeTimeout <= 0 {
+				v.TlsHandshakeTimeout = 10000
+			}
+			if v.MaxIdleConnectionsPerHost <= 0 {
+				v.MaxIdleConnectionsPerHost = 100
 			}
-			if v.ConnectionRequestTimeout <= 0 {
-				v.ConnectionRequestTimeout = 50
+			if v.IdleConnectionTimeout <= 0 {
+				v.IdleConnectionTimeout = 90000
 			}
 			if v.Port == 0 {
 				v.Port = 80
@@ -28,13 +39,90 @@ func (c *Config) SetupDefaults() {
 			if util.IsStringEmpty(v.Host) {
 				v.Host = "localhost"
 			}
+			for _, endpoint := range v.Endpoints {
+				if endpoint.Port == 0 {
+					endpoint.Port = v.Port
+				}
+				if endpoint.Weight <= 0 {
+					endpoint.Weight = 1
+				}
+			}
+			if v.Discovery != nil {
+				defaults := NewDefaultDiscoveryConfig()
+				if v.Discovery.RefreshIntervalMs <= 0 {
+					v.Discovery.RefreshIntervalMs = defaults.RefreshIntervalMs
+				}
+				if v.Discovery.TimeoutMs <= 0 {
+					v.Discovery.TimeoutMs = defaults.TimeoutMs
+				}
+			}
+			if v.OutlierDetection != nil {
+				defaults := NewDefaultOutlierDetectionConfig()
+				if v.OutlierDetection.Consecutive5xx <= 0 {
+					v.OutlierDetection.Consecutive5xx = defaults.Consecutive5xx
+				}
+				if v.OutlierDetection.ConsecutiveConnectFailures <= 0 {
+					v.OutlierDetection.ConsecutiveConnectFailures = defaults.ConsecutiveConnectFailures
+				}
+				if v.OutlierDetection.MinRequests <= 0 {
+					v.OutlierDetection.MinRequests = defaults.MinRequests
+				}
+				if v.OutlierDetection.BaseEjectionTimeMs <= 0 {
+					v.OutlierDetection.BaseEjectionTimeMs = defaults.BaseEjectionTimeMs
+				}
+				if v.OutlierDetection.MaxEjectionTimeMs < v.OutlierDetection.BaseEjectionTimeMs {
+					v.OutlierDetection.MaxEjectionTimeMs = max(defaults.MaxEjectionTimeMs, v.OutlierDetection.BaseEjectionTimeMs)
+				}
+				if v.OutlierDetection.MaxEjectionPercent <= 0 {
+					v.OutlierDetection.MaxEjectionPercent = defaults.MaxEjectionPercent
+				}
+			}
+			if v.HealthCheck != nil {
+				defaults := NewDefaultHealthCheckConfig()
+				if util.IsStringEmpty(v.HealthCheck.Path) {
+					v.HealthCheck.Path = defaults.Path
+				}
+				if v.HealthCheck.IntervalMs <= 0 {
+					v.HealthCheck.IntervalMs = defaults.IntervalMs
+				}
+				if v.HealthCheck.TimeoutMs <= 0 {
+					v.HealthCheck.TimeoutMs = defaults.TimeoutMs
+				}
+				if v.HealthCheck.HealthyThreshold <= 0 {
+					v.HealthCheck.HealthyThreshold = defaults.HealthyThreshold
+				}
+				if v.HealthCheck.UnhealthyThreshold <= 0 {
+					v.HealthCheck.UnhealthyThreshold = defaults.UnhealthyThreshold
+				}
+				if len(v.HealthCheck.ExpectedCodes) == 0 {
+					v.HealthCheck.ExpectedCodes = defaults.ExpectedCodes
+				}
+			}
+			v.RateLimit.setupDefaults()
+			if (len(v.Endpoints) > 0 || v.Discovery != nil || v.Resolver != nil) && v.LoadBalancer == nil {
+				v.LoadBalancer = NewDefaultLoadBalancerConfig()
+			}
+			if v.LoadBalancer != nil {
+				defaults := NewDefaultLoadBalancerConfig()
+				if util.IsStringEmpty(v.LoadBalancer.Strategy) {
+					v.LoadBalancer.Strategy = defaults.Strategy
+				}
+				if v.LoadBalancer.UnhealthyThreshold <= 0 {
+					v.LoadBalancer.UnhealthyThreshold = defaults.UnhealthyThreshold
+				}
+				if v.LoadBalancer.UnhealthyDurationMs <= 0 {
+					v.LoadBalancer.UnhealthyDurationMs = defaults.UnhealthyDurationMs
+				}
+			}
 		}
 	}
 
 	// Fill defaults in apis
 	if c.Apis != nil {
 		for k, v := range c.Apis {
-			v.Name = k
+			if v.Name != k {
+				v.Name = k
+			}
 			if v.Timeout <= 0 {
 				v.Timeout = 1
 			}
@@ -43,6 +131,10 @@ func (c *Config) SetupDefaults() {
 			}
 			if v.QueueSize <= 0 {
 				v.QueueSize = 1
+				v.queueSizeDefault = true
+			}
+			if v.AsyncQueueSize <= 0 {
+				v.AsyncQueueSize = 10
 			}
 			if util.IsStringEmpty(v.Method) {
 				v.Method = "GET"
@@ -51,25 +143,99 @@ func (c *Config) SetupDefaults() {
 				v.AcceptableCodes = "200,201"
 			}
 
-			v.acceptableCodes = make([]int, 0)
+			// SetupDefaults is called again when an api is reloaded, while other APIs are in use - so fields are
+			// written only when they change
+			acceptableCodes := make([]int, 0)
 			for _, code := range strings.Split(v.AcceptableCodes, ",") {
 				code = strings.TrimSpace(code)
 				if i, err := strconv.Atoi(code); err == nil {
-					v.acceptableCodes = append(v.acceptableCodes, i)
+					acceptableCodes = append(acceptableCodes, i)
 				}
 			}
-			if len(v.acceptableCodes) == 0 {
-				v.acceptableCodes = append(v.acceptableCodes, 200)
-				v.acceptableCodes = append(v.acceptableCodes, 201)
+			if len(acceptableCodes) == 0 {
+				acceptableCodes = append(acceptableCodes, 200)
+				acceptableCodes = append(acceptableCodes, 201)
+			}
+			if !slices.Equal(acceptableCodes, v.acceptableCodes) {
+				v.acceptableCodes = acceptableCodes
 			}
 
 			if v.Headers == nil {
 				v.Headers = map[string]string{}
 			}
+
+			if v.Retry != nil {
+				defaults := NewDefaultRetryConfig()
+				if v.Retry.MaxAttempts <= 0 {
+					v.Retry.MaxAttempts = 1
+				}
+				if util.IsStringEmpty(v.Retry.Backoff) {
+					v.Retry.Backoff = defaults.Backoff
+				}
+				if v.Retry.InitialBackoffMs <= 0 {
+					v.Retry.InitialBackoffMs = defaults.InitialBackoffMs
+				}
+				if v.Retry.MaxBackoffMs < v.Retry.InitialBackoffMs {
+					v.Retry.MaxBackoffMs = v.Retry.InitialBackoffMs
+				}
+			}
+			v.RateLimit.setupDefaults()
+
+			if v.Cache != nil && v.Cache.MaxEntries <= 0 {
+				v.Cache.MaxEntries = NewDefaultCacheConfig().MaxEntries
+			}
+			if v.Fallback != nil {
+				if v.Fallback.MaxEntries <= 0 {
+					v.Fallback.MaxEntries = NewDefaultFallbackConfig().MaxEntries
+				}
+				if v.Fallback.StaticBody != "" && v.Fallback.StaticStatusCode == 0 {
+					v.Fallback.StaticStatusCode = http.StatusOK
+				}
+			}
+			if v.AdaptiveConcurrency != nil {
+				defaults := NewDefaultAdaptiveConcurrencyConfig()
+				if util.IsStringEmpty(v.AdaptiveConcurrency.Algorithm) {
+					v.AdaptiveConcurrency.Algorithm = defaults.Algorithm
+				}
+				if v.AdaptiveConcurrency.MinLimit <= 0 {
+					v.AdaptiveConcurrency.MinLimit = defaults.MinLimit
+				}
+				if v.AdaptiveConcurrency.MinLimit > v.Concurrency {
+					v.AdaptiveConcurrency.MinLimit = v.Concurrency
+				}
+				if v.AdaptiveConcurrency.InitialLimit <= 0 || v.AdaptiveConcurrency.InitialLimit > v.Concurrency {
+					v.AdaptiveConcurrency.InitialLimit = v.Concurrency
+				}
+				if v.AdaptiveConcurrency.InitialLimit < v.AdaptiveConcurrency.MinLimit {
+					v.AdaptiveConcurrency.InitialLimit = v.AdaptiveConcurrency.MinLimit
+				}
+				if v.AdaptiveConcurrency.BackoffRatio <= 0 || v.AdaptiveConcurrency.BackoffRatio >= 1 {
+					v.AdaptiveConcurrency.BackoffRatio = defaults.BackoffRatio
+				}
+				if v.AdaptiveConcurrency.Smoothing <= 0 || v.AdaptiveConcurrency.Smoothing > 1 {
+					v.AdaptiveConcurrency.Smoothing = defaults.Smoothing
+				}
+				if v.AdaptiveConcurrency.RttTolerance < 1 {
+					v.AdaptiveConcurrency.RttTolerance = defaults.RttTolerance
+				}
+			}
 		}
 	}
 }
 
+// setupDefaults fills the defaults of a rate limit config (server and api) - it is safe to call on nil
+func (r *RateLimitConfig) setupDefaults() {
+	if r == nil {
+		return
+	}
+	if util.IsStringEmpty(r.Mode) {
+		r.Mode = RateLimitModeWait
+	}
+	if r.Burst <= 0 {
+		r.Burst = max(1, int(math.Ceil(r.Rps)))
+	}
+}
+
 func (c *Config) FindServerByName(toFind string) (*Server, error) {
 	for name, server := range c.Servers {
 		if name == toFind {
@@ -89,17 +255,75 @@ func (c *Config) FindApiByName(toFind string) (*Api, error) {
 }
 
 func (a *Api) GetPath(server *Server) string {
-	if server.Https {
-		if server.Port == -1 {
-			return fmt.Sprintf("https://%s%s", server.Host, a.Path)
+	return buildUrl(server.Https, server.Host, server.Port, a.Path)
+}
+
+// GetPathForEndpoint gives the url of this api on one endpoint of a server with multiple endpoints
+func (a *Api) GetPathForEndpoint(server *Server, endpoint *Endpoint) string {
+	return buildUrl(server.Https, endpoint.Host, endpoint.Port, a.Path)
+}
+
+// GetUrlForEndpoint gives the url of a path on one endpoint of this server (e.g. health check path)
+func (s *Server) GetUrlForEndpoint(endpoint *Endpoint, path string) string {
+	return buildUrl(s.Https, endpoint.Host, endpoint.Port, path)
+}
+
+func buildUrl(https bool, host string, port int, path string) string {
+	if https {
+		if port == -1 {
+			return fmt.Sprintf("https://%s%s", host, path)
 		}
-		return fmt.Sprintf("https://%s:%d%s", server.Host, server.Port, a.Path)
+		return fmt.Sprintf("https://%s:%d%s", host, port, path)
 	} else {
-		if server.Port == -1 {
-			return fmt.Sprintf("http://%s%s", server.Host, a.Path)
+		if port == -1 {
+			return fmt.Sprintf("http://%s%s", host, path)
+		}
+		return fmt.Sprintf("http://%s:%d%s", host, port, path)
+	}
+}
+
+// GetCircuitBreakerConfig gives the circuit breaker config of this api. Properties not set in the api are taken from
+// the server, and then from defaults.
+func (a *Api) GetCircuitBreakerConfig(server *Server) *CircuitBreakerConfig {
+	config := &CircuitBreakerConfig{
+		ErrorPercentThreshold:  25,
+		RequestVolumeThreshold: 20,
+		SleepWindowMs:          5000,
+		Scope:                  CircuitBreakerScopeApi,
+		Type:                   CircuitBreakerTypeHystrix,
+		WindowMs:               10000,
+		HalfOpenProbes:         1,
+	}
+	for _, c := range []*CircuitBreakerConfig{server.CircuitBreaker, a.CircuitBreaker} {
+		if c == nil {
+			continue
+		}
+		if c.ErrorPercentThreshold > 0 {
+			config.ErrorPercentThreshold = c.ErrorPercentThreshold
+		}
+		if c.RequestVolumeThreshold > 0 {
+			config.RequestVolumeThreshold = c.RequestVolumeThreshold
+		}
+		if c.SleepWindowMs > 0 {
+			config.SleepWindowMs = c.SleepWindowMs
+		}
+		if c.TimeoutMs > 0 {
+			config.TimeoutMs = c.TimeoutMs
+		}
+		if !util.IsStringEmpty(c.Scope) {
+			config.Scope = c.Scope
+		}
+		if !util.IsStringEmpty(c.Type) {
+			config.Type = c.Type
+		}
+		if c.WindowMs > 0 {
+			config.WindowMs = c.WindowMs
+		}
+		if c.HalfOpenProbes > 0 {
+			config.HalfOpenProbes = c.HalfOpenProbes
 		}
-		return fmt.Sprintf("http://%s:%d%s", server.Host, server.Port, a.Path)
 	}
+	return config
 }
 
 func (a *Api) IsHttpCodeAcceptable(code int) bool {
@@ -111,6 +335,12 @@ func (a *Api) IsHttpCodeAcceptable(code int) bool {
 	return false
 }
 
+// HasWaitQueue is true if queue_size is set for this api (it is not a default). Only then requests above concurrency
+// wait in a bounded queue - otherwise hystrix rejects them at once, or they are not limited when hystrix is disabled.
+func (a *Api) HasWaitQueue() bool {
+	return !a.queueSizeDefault
+}
+
 type funcBasedResponseBuilder struct {
 	responseBuilderFunc func(data []byte) (interface{}, error)
 }
@@ -217,6 +447,27 @@ func (b *goxRequestBuilder) WithBody(body interface{}) *goxRequestBuilder {
 	return b
 }
 
+// WithFormField adds a form field to the multipart/form-data body of the request
+func (b *goxRequestBuilder) WithFormField(name string, value interface{}) *goxRequestBuilder {
+	str, ok := value.(string)
+	if !ok {
+		str = serialization.StringifySuppressError(value, "")
+	}
+	return b.WithMultipartPart(&MultipartPart{Name: name, Reader: strings.NewReader(str)})
+}
+
+// WithFile adds a file to the multipart/form-data body of the request, reader is streamed when the request is sent
+// (it is not read in memory)
+func (b *goxRequestBuilder) WithFile(name string, fileName string, reader io.Reader) *goxRequestBuilder {
+	return b.WithMultipartPart(&MultipartPart{Name: name, FileName: fileName, Reader: reader})
+}
+
+// WithMultipartPart adds a part to the multipart/form-data body of the request
+func (b *goxRequestBuilder) WithMultipartPart(part *MultipartPart) *goxRequestBuilder {
+	b.request.Multipart = append(b.request.Multipart, part)
+	return b
+}
+
 func (b *goxRequestBuilder) Build() *GoxRequest {
 	return b.request
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/devlibx/gox-base/v2/errors"
 	"github.com/devlibx/gox-base/v2/serialization"
+	"io"
 )
 
 type Config struct {
@@ -34,6 +35,21 @@ type HmacConfig struct {
 	// Headers to include in signature - what all headers you should include in signature
 	HeadersToIncludeInSignature  []string `json:"headers_to_include_in_signature" yaml:"headers_to_include_in_signature"`
 	ConvertHeaderKeysToLowerCase bool     `json:"convert_header_keys_to_lower_case" yaml:"convert_header_keys_to_lower_case"`
+
+	// MultipartBody is how a streamed body (multipart/form-data) is signed - "digest" signs the SHA-256 digest of the
+	// body (also sent in Content-Digest header), "exclude" signs the request without the body. A streamed body fails
+	// the request if it is not set.
+	MultipartBody string `json:"multipart_body" yaml:"multipart_body"`
+}
+
+const HmacMultipartBodyDigest = "digest"
+const HmacMultipartBodyExclude = "exclude"
+
+// DigestBody is a request body which is streamed (e.g. multipart/form-data), interceptors use its digest to sign it
+// without reading it in memory
+type DigestBody interface {
+	io.Reader
+	Sha256() ([]byte, error)
 }
 
 type Interceptor interface {
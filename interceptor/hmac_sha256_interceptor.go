@@ -44,6 +44,21 @@ func (h *hmacSha256Interceptor) interceptRestyRequest(ctx context.Context, reque
 		break
 	case nil:
 		break
+	case DigestBody:
+		switch h.config.MultipartBody {
+		case HmacMultipartBodyDigest:
+			digest, err := b.Sha256()
+			if err != nil {
+				return false, nil, errors.Wrap(err, "failed to calculate digest of streamed body for interceptor hmac-sha256")
+			}
+			encodedDigest := base64.StdEncoding.EncodeToString(digest)
+			request.SetHeader("Content-Digest", "sha-256=:"+encodedDigest+":")
+			buf.WriteString(encodedDigest)
+		case HmacMultipartBodyExclude:
+			break
+		default:
+			return false, nil, errors.New("streamed body needs hmac_config.multipart_body=digest or exclude for interceptor hmac-sha256")
+		}
 	default:
 		return false, nil, errors.New("invalid body type for interceptor hmac-sha256")
 	}
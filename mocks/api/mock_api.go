@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	command "github.com/devlibx/gox-http/v4/command"
+	httpCommand "github.com/devlibx/gox-http/v4/command/http"
 	resty "github.com/go-resty/resty/v2"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -36,6 +37,33 @@ func (m *MockGoxHttpContext) EXPECT() *MockGoxHttpContextMockRecorder {
 	return m.recorder
 }
 
+// CircuitState mocks base method.
+func (m *MockGoxHttpContext) CircuitState(api string) (httpCommand.CircuitState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CircuitState", api)
+	ret0, _ := ret[0].(httpCommand.CircuitState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CircuitState indicates an expected call of CircuitState.
+func (mr *MockGoxHttpContextMockRecorder) CircuitState(api interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CircuitState", reflect.TypeOf((*MockGoxHttpContext)(nil).CircuitState), api)
+}
+
+// Close mocks base method.
+func (m *MockGoxHttpContext) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockGoxHttpContextMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockGoxHttpContext)(nil).Close))
+}
+
 // Execute mocks base method.
 func (m *MockGoxHttpContext) Execute(ctx context.Context, request *command.GoxRequest) (*command.GoxResponse, error) {
 	m.ctrl.T.Helper()
@@ -51,6 +79,73 @@ func (mr *MockGoxHttpContextMockRecorder) Execute(ctx, request interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockGoxHttpContext)(nil).Execute), ctx, request)
 }
 
+// ExecuteAsync mocks base method.
+func (m *MockGoxHttpContext) ExecuteAsync(ctx context.Context, request *command.GoxRequest) chan *command.GoxResponse {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteAsync", ctx, request)
+	ret0, _ := ret[0].(chan *command.GoxResponse)
+	return ret0
+}
+
+// ExecuteAsync indicates an expected call of ExecuteAsync.
+func (mr *MockGoxHttpContextMockRecorder) ExecuteAsync(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteAsync", reflect.TypeOf((*MockGoxHttpContext)(nil).ExecuteAsync), ctx, request)
+}
+
+// ExecuteStream mocks base method.
+func (m *MockGoxHttpContext) ExecuteStream(ctx context.Context, request *command.GoxRequest) (*command.GoxStreamResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecuteStream", ctx, request)
+	ret0, _ := ret[0].(*command.GoxStreamResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecuteStream indicates an expected call of ExecuteStream.
+func (mr *MockGoxHttpContextMockRecorder) ExecuteStream(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteStream", reflect.TypeOf((*MockGoxHttpContext)(nil).ExecuteStream), ctx, request)
+}
+
+// Health mocks base method.
+func (m *MockGoxHttpContext) Health() *httpCommand.HealthReport {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health")
+	ret0, _ := ret[0].(*httpCommand.HealthReport)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockGoxHttpContextMockRecorder) Health() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockGoxHttpContext)(nil).Health))
+}
+
+// OnCircuitStateChange mocks base method.
+func (m *MockGoxHttpContext) OnCircuitStateChange(listener httpCommand.CircuitListener) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnCircuitStateChange", listener)
+}
+
+// OnCircuitStateChange indicates an expected call of OnCircuitStateChange.
+func (mr *MockGoxHttpContextMockRecorder) OnCircuitStateChange(listener interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnCircuitStateChange", reflect.TypeOf((*MockGoxHttpContext)(nil).OnCircuitStateChange), listener)
+}
+
+// RegisterFallback mocks base method.
+func (m *MockGoxHttpContext) RegisterFallback(api string, fallback command.FallbackFunc) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RegisterFallback", api, fallback)
+}
+
+// RegisterFallback indicates an expected call of RegisterFallback.
+func (mr *MockGoxHttpContextMockRecorder) RegisterFallback(api, fallback interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterFallback", reflect.TypeOf((*MockGoxHttpContext)(nil).RegisterFallback), api, fallback)
+}
+
 // ReloadApi mocks base method.
 func (m *MockGoxHttpContext) ReloadApi(apiToReload string) error {
 	m.ctrl.T.Helper()
@@ -102,3 +197,41 @@ func (mr *MockRestyClientProviderMockRecorder) GetRestyClient(api interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRestyClient", reflect.TypeOf((*MockRestyClientProvider)(nil).GetRestyClient), api)
 }
+
+// MockResponseCodecProvider is a mock of ResponseCodecProvider interface.
+type MockResponseCodecProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockResponseCodecProviderMockRecorder
+}
+
+// MockResponseCodecProviderMockRecorder is the mock recorder for MockResponseCodecProvider.
+type MockResponseCodecProviderMockRecorder struct {
+	mock *MockResponseCodecProvider
+}
+
+// NewMockResponseCodecProvider creates a new mock instance.
+func NewMockResponseCodecProvider(ctrl *gomock.Controller) *MockResponseCodecProvider {
+	mock := &MockResponseCodecProvider{ctrl: ctrl}
+	mock.recorder = &MockResponseCodecProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResponseCodecProvider) EXPECT() *MockResponseCodecProviderMockRecorder {
+	return m.recorder
+}
+
+// ResponseCodec mocks base method.
+func (m *MockResponseCodecProvider) ResponseCodec(api string) (command.Codec, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResponseCodec", api)
+	ret0, _ := ret[0].(command.Codec)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// ResponseCodec indicates an expected call of ResponseCodec.
+func (mr *MockResponseCodecProviderMockRecorder) ResponseCodec(api interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResponseCodec", reflect.TypeOf((*MockResponseCodecProvider)(nil).ResponseCodec), api)
+}